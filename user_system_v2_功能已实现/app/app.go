@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"user_system_v1/config"
+	"user_system_v1/logging"
+	"user_system_v1/tracing"
+)
+
+// Service 可以独立启动和优雅关闭的服务，如用户服务和HTTP网关
+type Service interface {
+	Name() string
+	// Start 运行服务直到Shutdown，之后返回nil；启动失败或异常退出时返回错误
+	Start() error
+	// Shutdown 停止接受新请求并等待处理中的请求完成，ctx到期时放弃等待
+	Shutdown(ctx context.Context) error
+}
+
+// Init 加载配置并初始化日志，之后log包的输出也使用同样的格式
+func Init() *config.Config {
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if _, err := logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	return cfg
+}
+
+// Run 初始化链路追踪后启动各个服务，收到SIGINT、SIGTERM或任一服务异常退出后，
+// 按与启动相反的顺序优雅关闭，全部步骤共用ShutdownTimeout。返回进程的退出码
+func Run(cfg *config.Config, services ...Service) int {
+	// 退出前导出剩余的span
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		return 1
+	}
+
+	var wg sync.WaitGroup
+	serviceErr := make(chan error, len(services))
+	for _, svc := range services {
+		wg.Add(1)
+		go func(svc Service) {
+			defer wg.Done()
+			if err := svc.Start(); err != nil {
+				serviceErr <- fmt.Errorf("%s: %w", svc.Name(), err)
+			}
+		}(svc)
+	}
+
+	// 等待中断信号，或任一服务异常退出
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	exitCode := 0
+	select {
+	case sig := <-sigChan:
+		slog.Info("Shutting down", "signal", sig.String())
+	case err := <-serviceErr:
+		slog.Error("Service failed, shutting down", "error", err)
+		exitCode = 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	for i := len(services) - 1; i >= 0; i-- {
+		if err := services[i].Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down", "service", services[i].Name(), "error", err)
+			exitCode = 1
+		}
+	}
+	wg.Wait()
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+
+	slog.Info("Stopped")
+	return exitCode
+}
+
+// Fatal 记录错误日志后退出
+func Fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"user_system_v1/client"
+	"user_system_v1/config"
+	"user_system_v1/metrics"
+	"user_system_v1/rpc"
+	"user_system_v1/server"
+)
+
+// Gateway HTTP网关：对外提供HTTP接口，通过RPC客户端转发到一个或多个用户服务
+type Gateway struct {
+	port           string
+	userService    string // 用户服务的地址列表或SRV名称，用于日志
+	connectTimeout time.Duration
+	rpcClient      *client.RPCClient
+	http           *server.HTTPServer
+
+	// Shutdown时取消启动阶段对用户服务的等待
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewGateway 创建RPC客户端和HTTP服务器，此时不连接用户服务
+func NewGateway(cfg *config.Config) (*Gateway, error) {
+	var tlsConfig *tls.Config
+	if cfg.RPCTLSEnabled {
+		var err error
+		tlsConfig, err = rpc.ClientTLSConfig(cfg.RPCTLSCAFile, cfg.RPCTLSClientCertFile, cfg.RPCTLSClientKeyFile, cfg.RPCTLSServerName)
+		if err != nil {
+			return nil, fmt.Errorf("load RPC client TLS config: %w", err)
+		}
+	}
+
+	opts := client.Options{
+		PoolSize:          cfg.RPCPoolSize,
+		DialTimeout:       time.Duration(cfg.RPCDialTimeout) * time.Second,
+		RequestTimeout:    time.Duration(cfg.RPCRequestTimeout) * time.Second,
+		HeartbeatInterval: time.Duration(cfg.RPCHeartbeatInterval) * time.Second,
+		MaxFrameSize:      uint32(cfg.RPCMaxFrameSize),
+		Codec:             cfg.RPCCodec,
+		TLSConfig:         tlsConfig,
+		Balancer:          cfg.RPCBalancer,
+		MaxRetries:        cfg.RPCMaxRetries,
+		EjectAfter:        cfg.RPCEjectAfter,
+		EjectDuration:     time.Duration(cfg.RPCEjectDuration) * time.Second,
+	}
+
+	// 配置了SRV记录时定期重新解析，否则使用固定的地址列表
+	var rpcClient *client.RPCClient
+	var err error
+	userService := strings.Join(cfg.RPCAddrs(), ",")
+	if cfg.UserServiceSRV != "" {
+		userService = "srv:" + cfg.UserServiceSRV
+		opts.ResolveInterval = time.Duration(cfg.RPCResolveInterval) * time.Second
+		rpcClient, err = client.NewRPCClientWithResolver(client.SRVResolver{Name: cfg.UserServiceSRV}, opts)
+	} else {
+		rpcClient, err = client.NewRPCClient(cfg.RPCAddrs(), opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create RPC client: %w", err)
+	}
+	metrics.RegisterRPCClient(rpcClient.Stats)
+
+	httpServer := server.NewHTTPServer(cfg, rpcClient)
+	httpServer.AddReadinessCheck("rpc", rpcClient.Heartbeat)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Gateway{
+		port:           cfg.HTTPServerPort,
+		userService:    userService,
+		connectTimeout: time.Duration(cfg.RPCConnectTimeout) * time.Second,
+		rpcClient:      rpcClient,
+		http:           httpServer,
+		ctx:            ctx,
+		cancel:         cancel,
+	}, nil
+}
+
+// AddReadinessChecks 单进程模式下把用户服务的依赖也加入网关的就绪检查
+func (g *Gateway) AddReadinessChecks(checks map[string]server.HealthCheck) {
+	for name, check := range checks {
+		g.http.AddReadinessCheck(name, check)
+	}
+}
+
+func (g *Gateway) Name() string { return "HTTP gateway" }
+
+// Start 等待用户服务可以连接（按指数退避重试，最长connectTimeout）后启动HTTP服务器
+func (g *Gateway) Start() error {
+	slog.Info("Connecting to user service", "user_service", g.userService)
+	ctx, cancel := context.WithTimeout(g.ctx, g.connectTimeout)
+	defer cancel()
+	if err := g.rpcClient.Connect(ctx); err != nil {
+		if g.ctx.Err() != nil {
+			return nil // 启动过程中被关闭
+		}
+		return err
+	}
+
+	return g.http.Start(g.port)
+}
+
+// Shutdown 等HTTP请求处理完后关闭到用户服务的连接
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.cancel()
+	err := g.http.Shutdown(ctx)
+	g.rpcClient.Close()
+	return err
+}
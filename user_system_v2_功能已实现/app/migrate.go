@@ -0,0 +1,76 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"user_system_v1/config"
+	"user_system_v1/database"
+)
+
+const migrateUsage = `usage: %s migrate [command]
+
+commands:
+  up [version]   执行未执行的迁移，指定version时只执行到该版本（默认）
+  down [steps]   回滚最近执行的steps个迁移，默认1个
+  status         查看迁移执行情况`
+
+// Migrate 执行 migrate 子命令，只连接MySQL，不启动服务
+func Migrate(cfg *config.Config, args []string) {
+	usage := fmt.Sprintf(migrateUsage, filepath.Base(os.Args[0]))
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	// 第二个参数为版本号或回滚步数
+	var n int64
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.ParseInt(args[1], 10, 64); err != nil || n < 0 {
+			log.Fatalf("invalid argument %q\n%s", args[1], usage)
+		}
+	}
+
+	mysqlDB, err := database.NewMySQLDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to MySQL: %v", err)
+	}
+	defer mysqlDB.Close()
+
+	switch command {
+	case "up":
+		migrations, err := mysqlDB.MigrateUp(n)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Printf("Applied %d migration(s)", len(migrations))
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		migrations, err := mysqlDB.MigrateDown(int(n))
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Printf("Reverted %d migration(s)", len(migrations))
+	case "status":
+		statuses, err := mysqlDB.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		log.Fatalf("unknown migrate command %q\n%s", command, usage)
+	}
+}
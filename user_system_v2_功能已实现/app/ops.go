@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+
+	"user_system_v1/server"
+)
+
+// Ops 单独部署的用户服务的监控指标和健康检查端口
+type Ops struct {
+	port string
+	ops  *server.OpsServer
+}
+
+func NewOps(port string, checks map[string]server.HealthCheck) *Ops {
+	ops := server.NewOpsServer()
+	for name, check := range checks {
+		ops.AddReadinessCheck(name, check)
+	}
+	return &Ops{port: port, ops: ops}
+}
+
+func (o *Ops) Name() string { return "ops server" }
+
+func (o *Ops) Start() error {
+	return o.ops.Start(o.port)
+}
+
+func (o *Ops) Shutdown(ctx context.Context) error {
+	return o.ops.Shutdown(ctx)
+}
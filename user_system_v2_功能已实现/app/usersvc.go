@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"user_system_v1/auth"
+	"user_system_v1/config"
+	"user_system_v1/database"
+	"user_system_v1/metrics"
+	"user_system_v1/models"
+	"user_system_v1/notify"
+	"user_system_v1/rpc"
+	"user_system_v1/server"
+)
+
+// UserService TCP用户服务：持有MySQL和Redis连接，处理HTTP网关转发的RPC请求
+type UserService struct {
+	port      string
+	tlsConfig *tls.Config
+	mysqlDB   *database.MySQLDB
+	redisDB   *database.RedisDB
+	tcp       *server.TCPServer
+}
+
+// NewUserService 连接MySQL和Redis，执行数据库迁移并初始化管理员，创建TCP服务器
+func NewUserService(cfg *config.Config) (svc *UserService, err error) {
+	mysqlDB, err := database.NewMySQLDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MySQL: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			mysqlDB.Close()
+		}
+	}()
+
+	redisDB, err := database.NewRedisDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Redis: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			redisDB.Close()
+		}
+	}()
+
+	hasher, err := auth.NewPasswordHasher(cfg.PasswordHashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("create password hasher: %w", err)
+	}
+
+	notifier, err := notify.New(cfg.Notifier, cfg.NotifierFile)
+	if err != nil {
+		return nil, fmt.Errorf("create notifier: %w", err)
+	}
+
+	// JWT模式下加载访问令牌的签名密钥
+	var tokenSigner *auth.JWTSigner
+	if cfg.AuthTokenMode == "jwt" {
+		if cfg.JWTPrivateKeyFile == "" {
+			slog.Warn("JWT_PRIVATE_KEY_FILE not set, using a temporary signing key")
+		}
+		tokenSigner, err = auth.LoadJWTSigner(cfg.JWTPrivateKeyFile, cfg.JWTIssuer)
+		if err != nil {
+			return nil, fmt.Errorf("load JWT signing key: %w", err)
+		}
+		for _, keyFile := range cfg.JWTVerificationKeyFiles {
+			if err := tokenSigner.LoadVerificationKey(keyFile); err != nil {
+				return nil, fmt.Errorf("load JWT verification key: %w", err)
+			}
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.RPCTLSEnabled {
+		// 只开启TLS时连接是加密的，但任何能连到端口的客户端都可以调用
+		if cfg.RPCTLSClientCAFile == "" {
+			slog.Warn("RPC_TLS_CLIENT_CA_FILE not set: client certificates are not verified and any client can call the user service")
+		}
+		tlsConfig, err = rpc.ServerTLSConfig(cfg.RPCTLSCertFile, cfg.RPCTLSKeyFile, cfg.RPCTLSClientCAFile, cfg.RPCTLSAllowedClients)
+		if err != nil {
+			return nil, fmt.Errorf("load TCP server TLS config: %w", err)
+		}
+	}
+
+	migrations, err := mysqlDB.Migrate()
+	if err != nil {
+		return nil, fmt.Errorf("migrate database: %w", err)
+	}
+	if len(migrations) > 0 {
+		slog.Info("Applied migrations", "count", len(migrations))
+	}
+
+	// 按配置初始化管理员
+	for _, username := range cfg.AdminUsernames {
+		if err := mysqlDB.GrantRoleByUsername(context.Background(), username, models.RoleAdmin); err != nil {
+			return nil, fmt.Errorf("grant admin role to %s: %w", username, err)
+		}
+	}
+
+	if err := seedTestUsers(mysqlDB, hasher); err != nil {
+		return nil, err
+	}
+
+	// 连接池状态计入监控指标
+	metrics.RegisterMySQL(mysqlDB.Stats)
+	metrics.RegisterRedis(redisDB.PoolStats)
+
+	return &UserService{
+		port:      cfg.TCPServerPort,
+		tlsConfig: tlsConfig,
+		mysqlDB:   mysqlDB,
+		redisDB:   redisDB,
+		tcp:       server.NewTCPServer(cfg, mysqlDB, redisDB, hasher, notifier, tokenSigner),
+	}, nil
+}
+
+// seedTestUsers 空库时插入测试数据，QUICK_MODE=true时只插入1000条；已有数据时升级旧的密码哈希
+func seedTestUsers(mysqlDB *database.MySQLDB, hasher auth.PasswordHasher) error {
+	count, err := mysqlDB.GetUserCount()
+	if err != nil {
+		return fmt.Errorf("get user count: %w", err)
+	}
+
+	if count > 0 {
+		slog.Info("Database already contains users", "count", count)
+
+		slog.Info("Checking password hashes")
+		if err := mysqlDB.UpdatePasswordHashes(hasher); err != nil {
+			slog.Warn("Failed to update password hashes", "error", err)
+		} else {
+			slog.Info("Password hashes updated successfully")
+		}
+		return nil
+	}
+
+	userCount := 10000000
+	if os.Getenv("QUICK_MODE") == "true" {
+		userCount = 1000
+		slog.Info("Quick mode enabled, inserting only 1000 users for testing")
+	}
+
+	slog.Info("Inserting test users", "count", userCount)
+	if err := mysqlDB.InsertTestUsers(userCount, hasher); err != nil {
+		return fmt.Errorf("insert test users: %w", err)
+	}
+	slog.Info("Inserted test users", "count", userCount)
+	return nil
+}
+
+func (s *UserService) Name() string { return "user service" }
+
+func (s *UserService) Start() error {
+	return s.tcp.Start(s.port, s.tlsConfig)
+}
+
+// Shutdown 等TCP服务器处理完在途请求后关闭Redis和MySQL连接池
+func (s *UserService) Shutdown(ctx context.Context) error {
+	err := s.tcp.Shutdown(ctx)
+	return errors.Join(err, s.redisDB.Close(), s.mysqlDB.Close())
+}
+
+// ReadinessChecks 用户服务依赖的MySQL和Redis
+func (s *UserService) ReadinessChecks() map[string]server.HealthCheck {
+	return map[string]server.HealthCheck{
+		"mysql": s.mysqlDB.Ping,
+		"redis": s.redisDB.Ping,
+	}
+}
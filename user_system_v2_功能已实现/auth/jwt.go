@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid access token")
+	ErrTokenExpired = errors.New("access token expired")
+)
+
+// jwtAlgorithm 只签发和接受RS256，拒绝alg为none或HS256等算法混淆攻击
+const jwtAlgorithm = "RS256"
+
+// 未配置私钥时临时生成的密钥长度
+const generatedKeyBits = 2048
+
+var jwtEncoding = base64.RawURLEncoding
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Claims 访问令牌中的声明
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"` // 用户ID
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+	SessionID string `json:"sid"` // 签发该令牌的会话，可用于注销会话及标识当前设备
+	UserID    int64  `json:"uid"`
+
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+}
+
+// JWK RSA公钥的JSON Web Key表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKSet JWKS端点返回的公钥集合
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWTSigner 使用RSA私钥签发RS256访问令牌，按kid选择公钥校验。
+// 更换密钥时把旧公钥加入校验密钥，旧密钥签发的令牌过期前仍然有效
+type JWTSigner struct {
+	key    *rsa.PrivateKey
+	keyID  string
+	issuer string
+
+	// 校验密钥，包括当前签名密钥；只在开始使用前通过AddVerificationKey添加
+	keys   map[string]*rsa.PublicKey
+	keyIDs []string // 添加顺序，当前签名密钥在前
+}
+
+// NewJWTSigner 创建签名器，kid取公钥指纹，更换密钥后kid随之变化
+func NewJWTSigner(key *rsa.PrivateKey, issuer string) (*JWTSigner, error) {
+	keyID, err := jwtKeyID(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTSigner{
+		key:    key,
+		keyID:  keyID,
+		issuer: issuer,
+		keys:   map[string]*rsa.PublicKey{keyID: &key.PublicKey},
+		keyIDs: []string{keyID},
+	}, nil
+}
+
+func jwtKeyID(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	fingerprint := sha256.Sum256(der)
+	return jwtEncoding.EncodeToString(fingerprint[:12]), nil
+}
+
+// AddVerificationKey 添加只用于校验的公钥，如更换前的签名密钥，并在JWKS中发布
+func (s *JWTSigner) AddVerificationKey(pub *rsa.PublicKey) error {
+	keyID, err := jwtKeyID(pub)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.keys[keyID]; !ok {
+		s.keys[keyID] = pub
+		s.keyIDs = append(s.keyIDs, keyID)
+	}
+	return nil
+}
+
+// LoadVerificationKey 从PEM文件加载RSA公钥（PKIX或PKCS#1）并添加为校验密钥
+func (s *JWTSigner) LoadVerificationKey(keyFile string) error {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read JWT verification key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+
+	var pub *rsa.PublicKey
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		var parsed interface{}
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if pub, ok = parsed.(*rsa.PublicKey); !ok {
+				err = errors.New("JWT verification key is not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse JWT verification key %s: %v", keyFile, err)
+	}
+
+	return s.AddVerificationKey(pub)
+}
+
+// LoadJWTSigner 从PEM文件加载RSA私钥（PKCS#1或PKCS#8）
+// keyFile为空时临时生成密钥，重启后之前签发的令牌全部失效，且多实例之间无法互相校验，仅用于开发环境
+func LoadJWTSigner(keyFile, issuer string) (*JWTSigner, error) {
+	if keyFile == "" {
+		key, err := rsa.GenerateKey(rand.Reader, generatedKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		return NewJWTSigner(key, issuer)
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT private key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed interface{}
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				err = errors.New("JWT private key is not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT private key: %v", err)
+	}
+
+	return NewJWTSigner(key, issuer)
+}
+
+// Sign 签发令牌，Issuer为空时使用签名器的issuer
+func (s *JWTSigner) Sign(claims *Claims) (string, error) {
+	if claims.Issuer == "" {
+		claims.Issuer = s.issuer
+	}
+
+	header, err := json.Marshal(&jwtHeader{Alg: jwtAlgorithm, Typ: "JWT", Kid: s.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + jwtEncoding.EncodeToString(signature), nil
+}
+
+// Verify 校验签名、签发者和有效期，返回令牌中的声明
+func (s *JWTSigner) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+
+	headerJSON, err := jwtEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if header.Alg != jwtAlgorithm {
+		return nil, ErrTokenInvalid
+	}
+	pub, ok := s.keys[header.Kid]
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+
+	signature, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	payload, err := jwtEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	if claims.Issuer != s.issuer || claims.UserID == 0 {
+		return nil, ErrTokenInvalid
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// JWKS 返回用于校验令牌的公钥集合，当前签名密钥在前
+func (s *JWTSigner) JWKS() *JWKSet {
+	set := &JWKSet{Keys: make([]JWK, 0, len(s.keyIDs))}
+	for _, keyID := range s.keyIDs {
+		pub := s.keys[keyID]
+		set.Keys = append(set.Keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: jwtAlgorithm,
+			Kid: keyID,
+			N:   jwtEncoding.EncodeToString(pub.N.Bytes()),
+			E:   jwtEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	return set
+}
+
+// IsJWT 判断令牌是否为JWT格式；不透明的Session Token不含'.'
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testKeysOnce sync.Once
+	testKeys     [2]*rsa.PrivateKey
+)
+
+// testSigner 两个测试用的RSA密钥只生成一次，index选择其中之一
+func testSigner(t *testing.T, index int) *JWTSigner {
+	t.Helper()
+
+	testKeysOnce.Do(func() {
+		for i := range testKeys {
+			key, err := rsa.GenerateKey(rand.Reader, generatedKeyBits)
+			if err != nil {
+				panic(err)
+			}
+			testKeys[i] = key
+		}
+	})
+	signer, err := NewJWTSigner(testKeys[index], "user_system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func testClaims(now time.Time) *Claims {
+	return &Claims{
+		Subject:     "42",
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(15 * time.Minute).Unix(),
+		ID:          "jti-1",
+		SessionID:   "sid-1",
+		UserID:      42,
+		Roles:       []string{"admin"},
+		Permissions: []string{"users:read"},
+	}
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	signer := testSigner(t, 0)
+	now := time.Now()
+
+	token, err := signer.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsJWT(token) {
+		t.Fatalf("IsJWT(%q) = false", token)
+	}
+
+	claims, err := signer.Verify(token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != "user_system" || claims.UserID != 42 || claims.SessionID != "sid-1" ||
+		len(claims.Roles) != 1 || claims.Roles[0] != "admin" || len(claims.Permissions) != 1 {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestJWTExpired(t *testing.T) {
+	signer := testSigner(t, 0)
+	now := time.Now()
+
+	token, err := signer.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Verify(token, now.Add(15*time.Minute)); err != ErrTokenExpired {
+		t.Errorf("Verify at exp: err = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestJWTTampered(t *testing.T) {
+	signer := testSigner(t, 0)
+	now := time.Now()
+
+	token, err := signer.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	// 改动声明（提升为其他用户）后签名不再匹配
+	forged := testClaims(now)
+	forged.UserID = 1
+	payload, _ := json.Marshal(forged)
+
+	signature, _ := jwtEncoding.DecodeString(parts[2])
+	signature[0] ^= 0xff
+
+	tests := map[string]string{
+		"payload":      parts[0] + "." + jwtEncoding.EncodeToString(payload) + "." + parts[2],
+		"signature":    parts[0] + "." + parts[1] + "." + jwtEncoding.EncodeToString(signature),
+		"no signature": parts[0] + "." + parts[1] + ".",
+		"two parts":    parts[0] + "." + parts[1],
+		"bad base64":   parts[0] + ".!!." + parts[2],
+	}
+	for name, tampered := range tests {
+		if _, err := signer.Verify(tampered, now); err != ErrTokenInvalid {
+			t.Errorf("%s: err = %v, want ErrTokenInvalid", name, err)
+		}
+	}
+
+	// 其他签发者的令牌
+	other, _ := NewJWTSigner(testKeys[0], "someone_else")
+	token, _ = other.Sign(testClaims(now))
+	if _, err := signer.Verify(token, now); err != ErrTokenInvalid {
+		t.Errorf("foreign issuer: err = %v, want ErrTokenInvalid", err)
+	}
+}
+
+// 拒绝alg为none，以及用公钥作为HMAC密钥伪造的HS256令牌
+func TestJWTAlgorithmConfusion(t *testing.T) {
+	signer := testSigner(t, 0)
+	now := time.Now()
+	payload, _ := json.Marshal(testClaims(now))
+
+	encode := func(alg string) string {
+		header, _ := json.Marshal(&jwtHeader{Alg: alg, Typ: "JWT", Kid: signer.keyID})
+		return jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(payload)
+	}
+
+	none := encode("none") + "."
+	if _, err := signer.Verify(none, now); err != ErrTokenInvalid {
+		t.Errorf("alg none: err = %v, want ErrTokenInvalid", err)
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(&testKeys[0].PublicKey)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	signingInput := encode("HS256")
+	mac := hmac.New(sha256.New, publicPEM)
+	mac.Write([]byte(signingInput))
+	hs256 := signingInput + "." + jwtEncoding.EncodeToString(mac.Sum(nil))
+	if _, err := signer.Verify(hs256, now); err != ErrTokenInvalid {
+		t.Errorf("HS256 with public key: err = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldSigner := testSigner(t, 0)
+	newSigner := testSigner(t, 1)
+	now := time.Now()
+
+	oldToken, err := oldSigner.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未知的kid
+	if _, err := newSigner.Verify(oldToken, now); err != ErrTokenInvalid {
+		t.Errorf("unknown kid: err = %v, want ErrTokenInvalid", err)
+	}
+
+	// 旧公钥加入校验密钥后，旧令牌在过期前仍然有效
+	der, _ := x509.MarshalPKIXPublicKey(&testKeys[0].PublicKey)
+	keyFile := filepath.Join(t.TempDir(), "old.pub.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := newSigner.LoadVerificationKey(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newSigner.Verify(oldToken, now); err != nil {
+		t.Errorf("old token after rotation: %v", err)
+	}
+
+	// 新令牌使用新密钥签名
+	newToken, _ := newSigner.Sign(testClaims(now))
+	if _, err := oldSigner.Verify(newToken, now); err != ErrTokenInvalid {
+		t.Errorf("new token with old signer: err = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := newSigner.Verify(newToken, now); err != nil {
+		t.Errorf("new token: %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	signer := testSigner(t, 1)
+	if err := signer.AddVerificationKey(&testKeys[0].PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	// 重复添加不会重复发布
+	if err := signer.AddVerificationKey(&testKeys[1].PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	set := signer.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(set.Keys))
+	}
+	if set.Keys[0].Kid != signer.keyID {
+		t.Errorf("first key %s is not the signing key %s", set.Keys[0].Kid, signer.keyID)
+	}
+
+	for i, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Use != "sig" {
+			t.Errorf("key %d: unexpected metadata %+v", i, jwk)
+		}
+		n, err := jwtEncoding.DecodeString(jwk.N)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := jwtEncoding.DecodeString(jwk.E)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if kid, _ := jwtKeyID(pub); kid != jwk.Kid {
+			t.Errorf("key %d: kid %s does not match published key %s", i, jwk.Kid, kid)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// 支持的密码哈希算法
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrInvalidHash      = errors.New("invalid password hash format")
+)
+
+// PasswordHasher 密码哈希器
+// 编码后的哈希自带算法与参数（PHC字符串格式），因此参数调整后旧哈希仍可校验
+type PasswordHasher interface {
+	// Hash 生成带随机盐的编码哈希
+	Hash(password string) (string, error)
+	// Verify 校验密码与编码哈希是否匹配（常量时间比较）
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash 判断已存储的哈希是否需要按当前算法和参数重新生成
+	NeedsRehash(encoded string) bool
+}
+
+// NewPasswordHasher 根据算法名创建哈希器
+// 返回的哈希器用指定算法生成新哈希，同时能校验bcrypt、argon2id以及历史遗留的SHA-256哈希
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	var preferred PasswordHasher
+	switch algorithm {
+	case AlgorithmBcrypt, "":
+		preferred = NewBcryptHasher(bcrypt.DefaultCost)
+	case AlgorithmArgon2id:
+		preferred = NewArgon2idHasher(DefaultArgon2idParams)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+
+	return &multiHasher{preferred: preferred}, nil
+}
+
+// multiHasher 按哈希前缀分派到对应算法进行校验
+type multiHasher struct {
+	preferred PasswordHasher
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h *multiHasher) Verify(password, encoded string) (bool, error) {
+	switch {
+	case isBcryptHash(encoded):
+		return NewBcryptHasher(bcrypt.DefaultCost).Verify(password, encoded)
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return NewArgon2idHasher(DefaultArgon2idParams).Verify(password, encoded)
+	case IsLegacySHA256(encoded):
+		return verifyLegacySHA256(password, encoded), nil
+	default:
+		return false, ErrInvalidHash
+	}
+}
+
+func (h *multiHasher) NeedsRehash(encoded string) bool {
+	return h.preferred.NeedsRehash(encoded)
+}
+
+// BcryptHasher bcrypt实现，哈希格式为 $2a$<cost>$<salt+hash>
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	if !isBcryptHash(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+	return cost != h.cost
+}
+
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// Argon2idParams argon2id参数
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams OWASP推荐的最低配置（19 MiB, t=2, p=1）
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher argon2id实现，哈希格式为 $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	// 使用哈希中记录的参数重新计算
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		uint32(len(salt)) != h.params.SaltLength ||
+		uint32(len(key)) != h.params.KeyLength
+}
+
+// 解析PHC格式的argon2id哈希
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+// IsLegacySHA256 判断是否为早期版本使用的无盐SHA-256十六进制哈希
+func IsLegacySHA256(encoded string) bool {
+	if len(encoded) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func verifyLegacySHA256(password, encoded string) bool {
+	hash := sha256.Sum256([]byte(password))
+	expected := hex.EncodeToString(hash[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(encoded))) == 1
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 测试用的低成本参数
+var testArgon2idParams = Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashAndVerify(t *testing.T) {
+	hashers := map[string]PasswordHasher{
+		"bcrypt":   NewBcryptHasher(bcrypt.MinCost),
+		"argon2id": NewArgon2idHasher(testArgon2idParams),
+	}
+
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again, _ := hasher.Hash("correct horse"); again == encoded {
+				t.Error("two hashes of the same password are identical, salt not random")
+			}
+
+			if ok, err := hasher.Verify("correct horse", encoded); err != nil || !ok {
+				t.Errorf("Verify(correct) = %v, %v", ok, err)
+			}
+			if ok, err := hasher.Verify("wrong horse", encoded); err != nil || ok {
+				t.Errorf("Verify(wrong) = %v, %v", ok, err)
+			}
+			if hasher.NeedsRehash(encoded) {
+				t.Error("fresh hash needs rehash")
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedHash(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2idParams)
+	encoded, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(encoded, "$")
+
+	tests := map[string]string{
+		"missing field":   strings.Join(parts[:5], "$"),
+		"bad version":     strings.Replace(encoded, "v=19", "v=x", 1),
+		"bad params":      strings.Replace(encoded, "m=64", "m=abc", 1),
+		"bad salt base64": strings.Join([]string{"", parts[1], parts[2], parts[3], "!!", parts[5]}, "$"),
+		"empty key":       strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], ""}, "$"),
+	}
+	for name, tampered := range tests {
+		if ok, err := hasher.Verify("secret", tampered); err == nil || ok {
+			t.Errorf("%s: Verify = %v, %v; want error", name, ok, err)
+		}
+	}
+
+	// 格式正确但哈希值被改动
+	key := []byte(parts[5])
+	if key[0] == 'A' {
+		key[0] = 'B'
+	} else {
+		key[0] = 'A'
+	}
+	parts[5] = string(key)
+	if ok, _ := hasher.Verify("secret", strings.Join(parts, "$")); ok {
+		t.Error("tampered hash verified")
+	}
+
+	multi, _ := NewPasswordHasher(AlgorithmBcrypt)
+	if _, err := multi.Verify("secret", "$md5$whatever"); err != ErrInvalidHash {
+		t.Errorf("unknown format: err = %v, want ErrInvalidHash", err)
+	}
+}
+
+func TestLegacySHA256(t *testing.T) {
+	sum := sha256.Sum256([]byte("user_1"))
+	legacy := hex.EncodeToString(sum[:])
+	if !IsLegacySHA256(legacy) || IsLegacySHA256("user_1") {
+		t.Fatal("IsLegacySHA256 misclassified input")
+	}
+
+	hasher, err := NewPasswordHasher(AlgorithmBcrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoded := range []string{legacy, strings.ToUpper(legacy)} {
+		if ok, err := hasher.Verify("user_1", encoded); err != nil || !ok {
+			t.Errorf("Verify(legacy) = %v, %v", ok, err)
+		}
+	}
+	if ok, _ := hasher.Verify("user_2", legacy); ok {
+		t.Error("wrong password verified against legacy hash")
+	}
+	// 旧哈希校验通过后应升级
+	if !hasher.NeedsRehash(legacy) {
+		t.Error("legacy hash does not need rehash")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	low, _ := NewBcryptHasher(bcrypt.MinCost).Hash("secret")
+	if !NewBcryptHasher(bcrypt.MinCost + 1).NeedsRehash(low) {
+		t.Error("bcrypt cost change not detected")
+	}
+
+	argon, _ := NewArgon2idHasher(testArgon2idParams).Hash("secret")
+	stronger := testArgon2idParams
+	stronger.Iterations++
+	if !NewArgon2idHasher(stronger).NeedsRehash(argon) {
+		t.Error("argon2id parameter change not detected")
+	}
+
+	// 切换算法后旧哈希仍可校验，但需要重新生成
+	if !NewArgon2idHasher(testArgon2idParams).NeedsRehash(low) {
+		t.Error("bcrypt hash does not need rehash under argon2id")
+	}
+	multi, _ := NewPasswordHasher(AlgorithmArgon2id)
+	if ok, err := multi.Verify("secret", low); err != nil || !ok {
+		t.Errorf("Verify(bcrypt) with argon2id preferred = %v, %v", ok, err)
+	}
+}
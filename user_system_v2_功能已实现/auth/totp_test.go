@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238附录B的SHA1测试密钥
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// RFC中的验证码为8位，6位验证码取其后6位
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		step := tt.unix / int64(TOTPPeriod.Seconds())
+		if got := totpCode(key, step); got != tt.code {
+			t.Errorf("totpCode(T=%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+		if got, ok := VerifyTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0)); !ok || got != step {
+			t.Errorf("VerifyTOTP(T=%d) = %d, %v; want %d, true", tt.unix, got, ok, step)
+		}
+	}
+
+	// 密钥大小写不敏感，验证器App常以小写显示
+	if _, ok := VerifyTOTP(strings.ToLower(rfc6238Secret), "287082", time.Unix(59, 0)); !ok {
+		t.Error("lowercase secret rejected")
+	}
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / int64(TOTPPeriod.Seconds())
+	key := []byte("12345678901234567890")
+
+	// 允许前后各偏差totpSkew个时间步
+	for offset := int64(-totpSkew - 1); offset <= totpSkew+1; offset++ {
+		code := totpCode(key, current+offset)
+		step, ok := VerifyTOTP(rfc6238Secret, code, now)
+		want := offset >= -totpSkew && offset <= totpSkew
+		if ok != want {
+			t.Errorf("offset %d: ok = %v, want %v", offset, ok, want)
+		}
+		if ok && step != current+offset {
+			t.Errorf("offset %d: step = %d, want %d", offset, step, current+offset)
+		}
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := VerifyTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("malformed code %q accepted", code)
+		}
+	}
+	if _, ok := VerifyTOTP("not base32!", "050471", now); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+// 同一验证码在有效期内的任何时刻校验都返回同一个时间步，调用方按时间步记录即可拒绝重放
+func TestVerifyTOTPReplayStep(t *testing.T) {
+	issued := time.Unix(1111111111, 0)
+	code := totpCode([]byte("12345678901234567890"), issued.Unix()/int64(TOTPPeriod.Seconds()))
+
+	first, ok := VerifyTOTP(rfc6238Secret, code, issued)
+	if !ok {
+		t.Fatal("code rejected at issue time")
+	}
+	used := map[int64]bool{first: true}
+
+	for _, later := range []time.Duration{time.Second, TOTPPeriod, TOTPPeriod + 10*time.Second} {
+		step, ok := VerifyTOTP(rfc6238Secret, code, issued.Add(later))
+		if !ok {
+			t.Fatalf("code rejected %v after issue", later)
+		}
+		if !used[step] {
+			t.Errorf("replay %v after issue matched a different step %d", later, step)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != totpSecretBytes {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+	if other, _ := GenerateTOTPSecret(); other == secret {
+		t.Error("two generated secrets are identical")
+	}
+
+	uri := TOTPURI("UserSystem", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/UserSystem:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected otpauth URI %q", uri)
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 负载均衡策略
+const (
+	BalanceRoundRobin       = "round_robin"       // 依次轮询
+	BalanceLeastOutstanding = "least_outstanding" // 选择在途请求最少的节点
+)
+
+var errNoBackend = errors.New("no rpc server available")
+
+// backend 一个用户服务节点及其健康状态
+// 连续失败（拨号失败、连接断开、请求超时、心跳失败）达到EjectAfter次后摘除EjectDuration，
+// 期间不参与负载均衡，心跳成功或到期后恢复；到期后再次失败会立即重新摘除
+type backend struct {
+	addr string
+	pool *connPool
+
+	outstanding  atomic.Int64 // 在途请求数
+	failures     atomic.Int32 // 连续失败次数
+	ejectedUntil atomic.Int64 // 摘除到期时间（UnixNano），0表示未摘除
+	ejections    atomic.Uint64
+}
+
+func newBackend(addr string, opts Options) *backend {
+	return &backend{addr: addr, pool: newConnPool(addr, opts)}
+}
+
+func (b *backend) ejected(now time.Time) bool {
+	return now.UnixNano() < b.ejectedUntil.Load()
+}
+
+func (b *backend) recordSuccess() {
+	if b.failures.Load() == 0 {
+		return
+	}
+	b.failures.Store(0)
+	if b.ejectedUntil.Swap(0) != 0 {
+		slog.Info("RPC server recovered", "addr", b.addr)
+	}
+}
+
+func (b *backend) recordFailure(opts Options, err error) {
+	failures := b.failures.Add(1)
+	if opts.EjectAfter <= 0 || int(failures) < opts.EjectAfter {
+		return
+	}
+
+	until := time.Now().Add(opts.EjectDuration).UnixNano()
+	if b.ejectedUntil.Swap(until) == 0 {
+		b.ejections.Add(1)
+		slog.Warn("RPC server ejected", "addr", b.addr, "failures", failures, "duration", opts.EjectDuration, "error", err)
+	}
+}
+
+// candidates 按负载均衡策略排列可用节点，跳过已尝试过的节点；被摘除的节点排在最后，
+// 全部节点都被摘除时仍可尝试
+func (c *RPCClient) candidates(tried []*backend) []*backend {
+	backends := c.currentBackends()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	// 从轮询位置开始排列，least_outstanding在此基础上稳定排序，在途数相同时仍然轮询
+	start := int(atomic.AddUint32(&c.next, 1) % uint32(len(backends)))
+	now := time.Now()
+	healthy := make([]*backend, 0, len(backends))
+	var ejected []*backend
+	for i := range backends {
+		b := backends[(start+i)%len(backends)]
+		switch {
+		case containsBackend(tried, b):
+		case b.ejected(now):
+			ejected = append(ejected, b)
+		default:
+			healthy = append(healthy, b)
+		}
+	}
+
+	if c.opts.Balancer == BalanceLeastOutstanding {
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].outstanding.Load() < healthy[j].outstanding.Load()
+		})
+	}
+	return append(healthy, ejected...)
+}
+
+func containsBackend(backends []*backend, b *backend) bool {
+	for _, x := range backends {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+// pick 按负载均衡策略选择节点并取一条连接，连不上时记一次失败并尝试下一个节点
+func (c *RPCClient) pick(ctx context.Context, tried []*backend) (*backend, *muxConn, error) {
+	lastErr := errNoBackend
+	for _, b := range c.candidates(tried) {
+		conn, err := b.pool.get(ctx)
+		if err == nil {
+			return b, conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, err // 调用方放弃等待，不代表节点异常
+		}
+		b.recordFailure(c.opts, err)
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"user_system_v1/rpc"
+)
+
+// fakeServer 按RPC协议（JSON编解码）回复成功的服务端，drop为true时收到请求后直接断开连接
+type fakeServer struct {
+	listener net.Listener
+	requests atomic.Int64
+	drop     atomic.Bool
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: l}
+	t.Cleanup(s.close)
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.listener.Addr().String() }
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := rpc.NewFrameReader(conn, 0)
+	writer := rpc.NewFrameWriter(conn, 0)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return
+		}
+		msg, err := rpc.DecodeMessage(rpc.DefaultCodec, frame)
+		if err != nil {
+			return
+		}
+		if s.drop.Load() {
+			return
+		}
+		s.requests.Add(1)
+
+		data, _ := rpc.EncodeResponse(rpc.DefaultCodec, &rpc.Response{Type: msg.Type, ID: msg.ID, Status: rpc.STATUS_SUCCESS})
+		if err := writer.WriteFrame(data); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) close() {
+	s.listener.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func newTestClient(t *testing.T, opts Options, servers ...*fakeServer) *RPCClient {
+	var addrs []string
+	for _, s := range servers {
+		addrs = append(addrs, s.addr())
+	}
+	opts.PoolSize = 1
+	c, err := NewRPCClient(addrs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRoundRobinAcrossBackends(t *testing.T) {
+	a, b := newFakeServer(t), newFakeServer(t)
+	c := newTestClient(t, Options{}, a, b)
+
+	for i := 0; i < 10; i++ {
+		if err := c.Heartbeat(context.Background()); err != nil {
+			t.Fatalf("Heartbeat %d: %v", i, err)
+		}
+	}
+	if a.requests.Load() != 5 || b.requests.Load() != 5 {
+		t.Errorf("requests = %d, %d; want 5 each", a.requests.Load(), b.requests.Load())
+	}
+}
+
+func TestRetryAndEjection(t *testing.T) {
+	bad, good := newFakeServer(t), newFakeServer(t)
+	bad.drop.Store(true)
+	c := newTestClient(t, Options{MaxRetries: 1, EjectAfter: 2, EjectDuration: time.Minute}, bad, good)
+
+	// 只读请求落到异常节点时换节点重试，调用方感知不到
+	for i := 0; i < 4; i++ {
+		if _, err := c.sendRequest(context.Background(), rpc.MSG_GET_PROFILE, struct{}{}); err != nil {
+			t.Fatalf("get_profile %d: %v", i, err)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Retries == 0 {
+		t.Error("no retries recorded")
+	}
+	if stats.HealthyBackends != 1 || stats.Ejections != 1 {
+		t.Errorf("stats = %+v, want bad backend ejected", stats)
+	}
+
+	// 节点被摘除后，非幂等请求也只会发到正常节点
+	for i := 0; i < 4; i++ {
+		if _, err := c.sendRequest(context.Background(), rpc.MSG_LOGOUT, struct{}{}); err != nil {
+			t.Fatalf("logout %d: %v", i, err)
+		}
+	}
+}
+
+func TestNonIdempotentRequestNotRetried(t *testing.T) {
+	bad, good := newFakeServer(t), newFakeServer(t)
+	bad.drop.Store(true)
+	c := newTestClient(t, Options{MaxRetries: 1}, bad, good)
+
+	failed := 0
+	for i := 0; i < 4; i++ {
+		if _, err := c.sendRequest(context.Background(), rpc.MSG_LOGOUT, struct{}{}); err != nil {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("%d of 4 logout requests failed, want 2", failed)
+	}
+	if got := good.requests.Load(); got != 2 {
+		t.Errorf("good backend got %d requests, want 2", got)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	a, b := newFakeServer(t), newFakeServer(t)
+	c := newTestClient(t, Options{Balancer: BalanceLeastOutstanding}, a, b)
+
+	backends := c.currentBackends()
+	backends[0].outstanding.Add(3)
+	for i := 0; i < 4; i++ {
+		if got := c.candidates(nil)[0]; got != backends[1] {
+			t.Fatalf("picked %s, want the idle backend %s", got.addr, backends[1].addr)
+		}
+	}
+}
+
+func TestSRVResolver(t *testing.T) {
+	r := SRVResolver{
+		Name: "_rpc._tcp.usersvc.internal",
+		Lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			return "", []*net.SRV{
+				{Target: "backup.internal.", Port: 9090, Priority: 20},
+				{Target: "usersvc-1.internal.", Port: 9090, Priority: 10},
+				{Target: "usersvc-2.internal.", Port: 9091, Priority: 10},
+			}, nil
+		},
+	}
+
+	addrs, err := r.Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"usersvc-1.internal:9090", "usersvc-2.internal:9091"}
+	if len(addrs) != len(want) || addrs[0] != want[0] || addrs[1] != want[1] {
+		t.Errorf("addrs = %v, want %v", addrs, want)
+	}
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"user_system_v1/rpc"
+)
+
+var errConnClosed = errors.New("rpc connection closed")
+
+// 等待握手回复的最长时间。旧版服务端不回复握手，等待时间不宜过长
+const handshakeTimeout = time.Second
+
+// muxConn 一条可被多个并发请求共享的长连接
+// 请求按Message.ID登记在pending中，由读协程根据响应ID分发给对应的调用方
+type muxConn struct {
+	conn   net.Conn
+	reader *rpc.FrameReader
+	writer *rpc.FrameWriter
+	codec  rpc.Codec
+
+	mutex   sync.Mutex
+	pending map[uint32]chan *rpc.Response
+	err     error // 连接关闭原因，非nil表示连接已不可用
+
+	done chan struct{}
+
+	legacy bool // 服务端没有回复握手，按JSON通信
+}
+
+// dialMuxConn 建立连接，handshake为false时不协商编解码器，直接使用JSON
+func dialMuxConn(ctx context.Context, addr string, opts Options, handshake bool) (*muxConn, error) {
+	conn, err := dial(ctx, addr, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server: %v", err)
+	}
+
+	mc := newMuxConn(conn, opts)
+
+	if handshake && opts.Codec != "" && opts.Codec != rpc.DefaultCodec.Name() {
+		if err := mc.handshake(ctx, opts.Codec, min(opts.DialTimeout, handshakeTimeout)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("codec handshake failed: %v", err)
+		}
+	}
+
+	go mc.readLoop()
+
+	return mc, nil
+}
+
+func newMuxConn(conn net.Conn, opts Options) *muxConn {
+	return &muxConn{
+		conn:    conn,
+		reader:  rpc.NewFrameReader(conn, opts.MaxFrameSize),
+		writer:  rpc.NewFrameWriter(conn, opts.MaxFrameSize),
+		codec:   rpc.DefaultCodec,
+		pending: make(map[uint32]chan *rpc.Response),
+		done:    make(chan struct{}),
+	}
+}
+
+// 建立TCP连接，配置了TLS时在超时内完成TLS握手；ctx结束时放弃拨号
+func dial(ctx context.Context, addr string, opts Options) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: opts.DialTimeout}
+	if opts.TLSConfig == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: opts.TLSConfig}
+	return tlsDialer.DialContext(ctx, "tcp", addr)
+}
+
+// 协商编解码器
+// 旧版服务端不认识握手帧，不会回复，超时后退回JSON继续使用这条连接
+func (mc *muxConn) handshake(ctx context.Context, codecName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	mc.conn.SetWriteDeadline(deadline)
+	if err := mc.writer.WriteFrame(rpc.EncodeHandshake(codecName)); err != nil {
+		return err
+	}
+
+	mc.conn.SetReadDeadline(deadline)
+	defer mc.conn.SetReadDeadline(time.Time{})
+
+	frame, err := mc.reader.ReadFrame()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// 调用方的deadline先到时无法判断服务端是否支持握手
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Warn("Server did not answer codec handshake", "codec", mc.codec.Name())
+			mc.legacy = true
+			return nil
+		}
+		return err
+	}
+
+	if !rpc.IsHandshake(frame) {
+		return fmt.Errorf("unexpected handshake reply")
+	}
+	mc.codec = rpc.NegotiateCodec(rpc.ParseHandshake(frame))
+
+	return nil
+}
+
+// 发送一条消息并等待对应ID的响应
+func (mc *muxConn) roundTrip(ctx context.Context, msg *rpc.Message) (*rpc.Response, error) {
+	respChan := make(chan *rpc.Response, 1)
+
+	mc.mutex.Lock()
+	if mc.err != nil {
+		err := mc.err
+		mc.mutex.Unlock()
+		return nil, err
+	}
+	mc.pending[msg.ID] = respChan
+	mc.mutex.Unlock()
+
+	defer func() {
+		mc.mutex.Lock()
+		delete(mc.pending, msg.ID)
+		mc.mutex.Unlock()
+	}()
+
+	msgData, err := rpc.EncodeMessage(mc.codec, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mc.write(ctx, msgData); err != nil {
+		// 超长的请求在写出任何字节之前就被拒绝，连接上的其他请求不受影响
+		if errors.Is(err, rpc.ErrFrameTooLarge) {
+			return nil, err
+		}
+		mc.close(err)
+		return nil, fmt.Errorf("failed to write message: %v", err)
+	}
+
+	select {
+	case resp := <-respChan:
+		return resp, nil
+	case <-mc.done:
+		return nil, fmt.Errorf("failed to read response: %v", mc.closeErr())
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (mc *muxConn) write(ctx context.Context, data []byte) error {
+	// 写超时跟随请求的deadline，避免对端不读时永久阻塞
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	mc.conn.SetWriteDeadline(deadline)
+
+	return mc.writer.WriteFrame(data)
+}
+
+// 持续读取响应并分发给等待中的请求
+func (mc *muxConn) readLoop() {
+	for {
+		frame, err := mc.reader.ReadFrame()
+		if err != nil {
+			mc.close(err)
+			return
+		}
+
+		response, err := rpc.DecodeResponse(mc.codec, frame)
+		if err != nil {
+			slog.Error("Failed to decode response", "error", err)
+			continue
+		}
+
+		mc.mutex.Lock()
+		respChan, ok := mc.pending[response.ID]
+		mc.mutex.Unlock()
+
+		// 调用方可能已超时离开，丢弃迟到的响应
+		if ok {
+			respChan <- response
+		}
+	}
+}
+
+func (mc *muxConn) close(err error) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if mc.err != nil {
+		return
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = errConnClosed
+	}
+	mc.err = err
+	close(mc.done)
+	mc.conn.Close()
+}
+
+func (mc *muxConn) closeErr() error {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	return mc.err
+}
+
+// pendingCount 等待响应的请求数
+func (mc *muxConn) pendingCount() int {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	return len(mc.pending)
+}
+
+func (mc *muxConn) isClosed() bool {
+	return mc.closeErr() != nil
+}
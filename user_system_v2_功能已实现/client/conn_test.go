@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"user_system_v1/rpc"
+)
+
+// pipeConn 返回通过内存管道相连的muxConn和服务端一侧的连接
+func pipeConn(t *testing.T) (*muxConn, net.Conn) {
+	client, server := net.Pipe()
+	mc := newMuxConn(client, Options{})
+	go mc.readLoop()
+	t.Cleanup(func() {
+		mc.close(nil)
+		server.Close()
+	})
+	return mc, server
+}
+
+func TestMuxConnMatchesResponsesByID(t *testing.T) {
+	mc, server := pipeConn(t)
+
+	// 服务端收齐两个请求后倒序回复
+	go func() {
+		reader := rpc.NewFrameReader(server, 0)
+		writer := rpc.NewFrameWriter(server, 0)
+		var msgs []*rpc.Message
+		for len(msgs) < 2 {
+			frame, err := reader.ReadFrame()
+			if err != nil {
+				return
+			}
+			msg, _ := rpc.DecodeMessage(rpc.DefaultCodec, frame)
+			msgs = append(msgs, msg)
+		}
+		for i := len(msgs) - 1; i >= 0; i-- {
+			data, _ := rpc.EncodeResponse(rpc.DefaultCodec, &rpc.Response{ID: msgs[i].ID, Message: msgs[i].RequestID})
+			writer.WriteFrame(data)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, id := range []uint32{1, 2} {
+		wg.Add(1)
+		go func(id uint32) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			want := string(rune('a' + id))
+			resp, err := mc.roundTrip(ctx, &rpc.Message{ID: id, RequestID: want})
+			if err != nil {
+				t.Errorf("request %d: %v", id, err)
+				return
+			}
+			if resp.ID != id || resp.Message != want {
+				t.Errorf("request %d got response %d %q", id, resp.ID, resp.Message)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	if n := mc.pendingCount(); n != 0 {
+		t.Errorf("%d requests still pending", n)
+	}
+}
+
+func TestMuxConnFailsPendingOnClose(t *testing.T) {
+	mc, server := pipeConn(t)
+
+	// 服务端读到请求后断开，不回复
+	go func() {
+		rpc.NewFrameReader(server, 0).ReadFrame()
+		server.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := mc.roundTrip(ctx, &rpc.Message{ID: 1})
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("roundTrip error = %v, want connection closed before the deadline", err)
+	}
+	if !mc.isClosed() {
+		t.Error("connection not marked closed")
+	}
+
+	// 之后的请求立即失败
+	if _, err := mc.roundTrip(ctx, &rpc.Message{ID: 2}); err == nil {
+		t.Error("request on closed connection succeeded")
+	}
+}
+
+func TestMuxConnOversizedRequestKeepsConnection(t *testing.T) {
+	client, server := net.Pipe()
+	mc := newMuxConn(client, Options{MaxFrameSize: 64})
+	go mc.readLoop()
+	defer mc.close(nil)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := mc.roundTrip(ctx, &rpc.Message{ID: 1, RequestID: strings.Repeat("x", 128)})
+	if !errors.Is(err, rpc.ErrFrameTooLarge) {
+		t.Fatalf("err = %v, want ErrFrameTooLarge", err)
+	}
+	if mc.isClosed() {
+		t.Error("oversized request closed the shared connection")
+	}
+}
+
+// legacyServer 不认识握手帧的旧版服务端：忽略握手，按JSON回复其他请求
+func legacyServer(t *testing.T) (string, *atomic.Int64) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	handshakes := &atomic.Int64{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader, writer := rpc.NewFrameReader(conn, 0), rpc.NewFrameWriter(conn, 0)
+				for {
+					frame, err := reader.ReadFrame()
+					if err != nil {
+						return
+					}
+					if rpc.IsHandshake(frame) {
+						handshakes.Add(1)
+						continue
+					}
+					msg, err := rpc.DecodeMessage(rpc.DefaultCodec, frame)
+					if err != nil {
+						return
+					}
+					data, _ := rpc.EncodeResponse(rpc.DefaultCodec, &rpc.Response{ID: msg.ID})
+					writer.WriteFrame(data)
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), handshakes
+}
+
+func TestHandshakeFallsBackToJSONOnce(t *testing.T) {
+	addr, handshakes := legacyServer(t)
+	pool := newConnPool(addr, Options{PoolSize: 2, DialTimeout: 5 * time.Second, Codec: rpc.CodecMsgpack})
+	defer pool.close()
+
+	start := time.Now()
+	first, err := pool.slots[0].get(context.Background(), pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("handshake fallback took %v, want about %v", elapsed, handshakeTimeout)
+	}
+	if first.codec.Name() != rpc.CodecJSON {
+		t.Errorf("codec = %s, want json fallback", first.codec.Name())
+	}
+
+	// 同一地址的后续连接不再等待握手
+	start = time.Now()
+	second, err := pool.slots[1].get(context.Background(), pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > handshakeTimeout/2 {
+		t.Errorf("second dial took %v, handshake result not cached", elapsed)
+	}
+	if handshakes.Load() != 1 {
+		t.Errorf("server saw %d handshakes, want 1", handshakes.Load())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := second.roundTrip(ctx, &rpc.Message{Type: rpc.MSG_HEARTBEAT, ID: 1}); err != nil {
+		t.Errorf("request over fallback connection: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"user_system_v1/rpc"
+)
+
+// connPool 到同一个服务端地址的一组长连接
+// 每个槽位持有一条muxConn，断开后在下次使用或心跳时重新拨号
+type connPool struct {
+	addr string
+	opts Options
+
+	slots []*connSlot
+	next  uint32
+
+	dials        atomic.Uint64 // 建立连接的次数，含重连
+	dialFailures atomic.Uint64
+
+	// 服务端不支持握手时记录到期时间（UnixNano），到期前新建的连接直接使用JSON，
+	// 不再每次等待握手超时；到期后重新协商，以便发现已升级的服务端
+	legacyUntil atomic.Int64
+}
+
+const legacyCodecTTL = 5 * time.Minute
+
+type connSlot struct {
+	mutex sync.Mutex
+	conn  *muxConn
+}
+
+func newConnPool(addr string, opts Options) *connPool {
+	size := opts.PoolSize
+	if size <= 0 {
+		size = 1
+	}
+
+	p := &connPool{
+		addr:  addr,
+		opts:  opts,
+		slots: make([]*connSlot, size),
+	}
+	for i := range p.slots {
+		p.slots[i] = &connSlot{}
+	}
+	return p
+}
+
+// 轮询选取一条可用连接，槽位上没有可用连接时在ctx内拨号
+func (p *connPool) get(ctx context.Context) (*muxConn, error) {
+	n := atomic.AddUint32(&p.next, 1)
+	return p.slots[n%uint32(len(p.slots))].get(ctx, p)
+}
+
+func (s *connSlot) get(ctx context.Context, p *connPool) (*muxConn, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn != nil && !s.conn.isClosed() {
+		return s.conn, nil
+	}
+
+	p.dials.Add(1)
+	handshake := time.Now().UnixNano() >= p.legacyUntil.Load()
+	conn, err := dialMuxConn(ctx, p.addr, p.opts, handshake)
+	if err != nil {
+		p.dialFailures.Add(1)
+		return nil, err
+	}
+	if conn.legacy {
+		p.legacyUntil.Store(time.Now().Add(legacyCodecTTL).UnixNano())
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+// 当前槽位上的连接（可能为nil），不触发拨号
+func (s *connSlot) current() *muxConn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.conn
+}
+
+// 预热：并发为每个槽位建立连接，ctx结束时放弃。失败的槽位留给后续心跳重试，
+// 返回第一个错误
+func (p *connPool) warmUp(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(p.slots))
+	for i, slot := range p.slots {
+		wg.Add(1)
+		go func(i int, slot *connSlot) {
+			defer wg.Done()
+			_, errs[i] = slot.get(ctx, p)
+		}(i, slot)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			slog.Warn("Failed to warm up RPC connection", "addr", p.addr, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// 在每条连接上发送心跳，失败的连接关闭后重新拨号，使连接池保持预热状态。
+// 所有连接都失败时返回最后一个错误
+func (p *connPool) heartbeat(msgID func() uint32, timeout time.Duration) error {
+	var lastErr error
+	ok := false
+	for _, slot := range p.slots {
+		conn, err := slot.get(context.Background(), p)
+		if err != nil {
+			slog.Warn("Failed to reconnect", "addr", p.addr, "error", err)
+			lastErr = err
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		resp, err := conn.roundTrip(ctx, &rpc.Message{
+			Type: rpc.MSG_HEARTBEAT,
+			ID:   msgID(),
+		})
+		cancel()
+
+		if err == nil && resp.Status != rpc.STATUS_SUCCESS {
+			err = fmt.Errorf("heartbeat failed: %s", resp.Message)
+		}
+		if err != nil {
+			slog.Warn("Heartbeat failed, reconnecting", "addr", p.addr, "error", err)
+			conn.close(err)
+			lastErr = err
+			continue
+		}
+		ok = true
+	}
+
+	if ok {
+		return nil
+	}
+	return lastErr
+}
+
+// stats 统计连接池状态，不触发拨号
+func (p *connPool) stats() Stats {
+	stats := Stats{
+		PoolSize:     len(p.slots),
+		Dials:        p.dials.Load(),
+		DialFailures: p.dialFailures.Load(),
+	}
+	for _, slot := range p.slots {
+		if conn := slot.current(); conn != nil && !conn.isClosed() {
+			stats.OpenConns++
+			stats.InFlight += conn.pendingCount()
+		}
+	}
+	return stats
+}
+
+func (p *connPool) close() {
+	for _, slot := range p.slots {
+		if conn := slot.current(); conn != nil {
+			conn.close(nil)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resolver 返回当前可用的用户服务地址（host:port）
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// StaticResolver 固定的地址列表
+type StaticResolver []string
+
+func (r StaticResolver) Resolve(context.Context) ([]string, error) {
+	return r, nil
+}
+
+func (r StaticResolver) String() string {
+	return strings.Join(r, ",")
+}
+
+// SRVResolver 通过DNS SRV记录发现用户服务，如Consul或Kubernetes headless service的
+// _rpc._tcp.usersvc.default.svc.cluster.local
+type SRVResolver struct {
+	Name string
+
+	// Lookup 查询SRV记录，为nil时使用net.DefaultResolver，测试时可替换
+	Lookup func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func (r SRVResolver) Resolve(ctx context.Context) ([]string, error) {
+	lookup := r.Lookup
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupSRV
+	}
+
+	_, records, err := lookup(ctx, "", "", r.Name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup SRV %s: %w", r.Name, err)
+	}
+
+	// 只使用优先级最高（Priority最小）的一组记录
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Priority < records[j].Priority })
+	var addrs []string
+	for _, srv := range records {
+		if srv.Priority != records[0].Priority {
+			break
+		}
+		host := strings.TrimSuffix(srv.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+	return addrs, nil
+}
+
+func (r SRVResolver) String() string {
+	return "srv:" + r.Name
+}
@@ -1,154 +1,530 @@
 package client
 
 import (
-	"encoding/binary"
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
-	"net"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"user_system_v1/auth"
+	"user_system_v1/logging"
 	"user_system_v1/models"
 	"user_system_v1/rpc"
+	"user_system_v1/tracing"
 )
 
+var tracer = otel.Tracer("user_system_v1/client")
+
+// Options RPC客户端参数
+type Options struct {
+	PoolSize          int           // 到每个服务端节点的长连接数
+	DialTimeout       time.Duration // 建立连接超时
+	RequestTimeout    time.Duration // 单次请求超时（调用方ctx未设置deadline时生效）
+	HeartbeatInterval time.Duration // 心跳间隔，<=0 表示不发送心跳
+	MaxFrameSize      uint32        // 单帧最大字节数，0 表示使用默认值
+	Codec             string        // 期望使用的编解码器（json/msgpack），由连接建立时握手协商
+	TLSConfig         *tls.Config   // 非nil时使用TLS连接服务端，配置客户端证书即为mTLS
+
+	Balancer        string        // 负载均衡策略：round_robin（默认）或 least_outstanding
+	MaxRetries      int           // 幂等请求因连接错误失败后换节点重试的次数，<=0 表示不重试
+	EjectAfter      int           // 节点连续失败多少次后暂时摘除，<=0 表示不摘除
+	EjectDuration   time.Duration // 节点被摘除的时长
+	ResolveInterval time.Duration // 重新解析节点地址的间隔，<=0 表示只在启动时解析
+}
+
+func DefaultOptions() Options {
+	return Options{
+		PoolSize:          8,
+		DialTimeout:       5 * time.Second,
+		RequestTimeout:    10 * time.Second,
+		HeartbeatInterval: 15 * time.Second,
+		Codec:             rpc.CodecJSON,
+		Balancer:          BalanceRoundRobin,
+		MaxRetries:        1,
+		EjectAfter:        3,
+		EjectDuration:     30 * time.Second,
+	}
+}
+
+// Stats 连接池状态，用于监控
+type Stats struct {
+	PoolSize        int    // 连接槽位数
+	OpenConns       int    // 当前可用的连接数
+	InFlight        int    // 等待响应的请求数
+	Dials           uint64 // 累计拨号次数，含重连
+	DialFailures    uint64 // 累计拨号失败次数
+	Backends        int    // 服务端节点数
+	HealthyBackends int    // 未被摘除的节点数
+	Ejections       uint64 // 累计摘除节点的次数（仅统计当前节点）
+	Retries         uint64 // 累计换节点重试的次数
+}
+
+// Connect重试建立连接的等待时间，逐次翻倍直到上限
+const (
+	connectBackoffMin = 100 * time.Millisecond
+	connectBackoffMax = 5 * time.Second
+)
+
+// RPCClient 用户服务的客户端，在一个或多个服务端节点之间负载均衡
 type RPCClient struct {
-	serverAddr string // 此处是TCP服务器的地址 即 localhost:9090
-	mutex      sync.Mutex
-	msgID      uint32
-	msgIDMutex sync.Mutex
+	resolver Resolver
+	opts     Options
+
+	mutex    sync.RWMutex
+	backends []*backend // 每个节点一个连接池，由resolver定期更新
+
+	next    uint32
+	msgID   uint32
+	retries atomic.Uint64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
 }
 
-func NewRPCClient(serverAddr string) (*RPCClient, error) {
-	return &RPCClient{
-		serverAddr: serverAddr,
-	}, nil
+// NewRPCClient 创建到固定的一个或多个用户服务地址的客户端，每个地址维护PoolSize条长连接。
+// 创建时不拨号，调用Connect等待服务端可用，否则在首次请求时建立连接
+func NewRPCClient(addrs []string, opts Options) (*RPCClient, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no rpc server address")
+	}
+	return NewRPCClientWithResolver(StaticResolver(addrs), opts)
+}
+
+// NewRPCClientWithResolver 创建通过resolver发现服务端节点的客户端。
+// 节点列表在Connect时首次解析，之后每隔ResolveInterval更新
+func NewRPCClientWithResolver(resolver Resolver, opts Options) (*RPCClient, error) {
+	defaults := DefaultOptions()
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaults.PoolSize
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = defaults.DialTimeout
+	}
+	if opts.RequestTimeout <= 0 {
+		opts.RequestTimeout = defaults.RequestTimeout
+	}
+	if opts.Codec == "" {
+		opts.Codec = defaults.Codec
+	}
+	if _, ok := rpc.CodecByName(opts.Codec); !ok {
+		return nil, fmt.Errorf("unknown rpc codec: %s", opts.Codec)
+	}
+	if opts.Balancer == "" {
+		opts.Balancer = defaults.Balancer
+	}
+	if opts.Balancer != BalanceRoundRobin && opts.Balancer != BalanceLeastOutstanding {
+		return nil, fmt.Errorf("unknown rpc balancer: %s", opts.Balancer)
+	}
+	if opts.EjectDuration <= 0 {
+		opts.EjectDuration = defaults.EjectDuration
+	}
+
+	c := &RPCClient{
+		resolver: resolver,
+		opts:     opts,
+		closed:   make(chan struct{}),
+	}
+
+	// 固定地址无需等待解析
+	if static, ok := resolver.(StaticResolver); ok {
+		c.setBackends(static)
+	}
+
+	// 由心跳保持连接可用，并探测被摘除的节点
+	if opts.HeartbeatInterval > 0 {
+		c.wg.Add(1)
+		go c.heartbeatLoop()
+	}
+	if opts.ResolveInterval > 0 {
+		c.wg.Add(1)
+		go c.resolveLoop()
+	}
+
+	return c, nil
 }
 
 func (c *RPCClient) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.wg.Wait()
+		for _, b := range c.currentBackends() {
+			b.pool.close()
+		}
+	})
 	return nil
 }
 
-// 发送RPC请求并等待响应
-func (c *RPCClient) sendRequest(msgType uint32, payload interface{}) (*rpc.Response, error) {
+// Connect 等待至少一个节点可以连接，然后在ctx内并发预热其余健康节点的连接池。
+// 服务端尚未启动或地址尚未解析出来时按指数退避重试，直到ctx结束或客户端关闭
+func (c *RPCClient) Connect(ctx context.Context) error {
+	backoff := connectBackoffMin
+	for {
+		err := c.resolve(ctx)
+		if err == nil {
+			var b *backend
+			if b, _, err = c.pick(ctx, nil); err == nil {
+				b.recordSuccess()
+				c.warmUp(ctx)
+				return nil
+			}
+		}
+
+		slog.Warn("RPC server not reachable, retrying", "servers", c.resolver, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("connect to %v: %w", c.resolver, err)
+		case <-c.closed:
+			return fmt.Errorf("rpc client closed")
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > connectBackoffMax {
+			backoff = connectBackoffMax
+		}
+	}
+}
+
+// warmUp 并发预热各节点的连接池。被摘除或刚刚连接失败的节点留给心跳探测，
+// 避免Connect在连不上的节点上等待拨号超时
+func (c *RPCClient) warmUp(ctx context.Context) {
+	now := time.Now()
+	var wg sync.WaitGroup
+	for _, b := range c.currentBackends() {
+		if b.ejected(now) || b.failures.Load() > 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			if err := b.pool.warmUp(ctx); err != nil && ctx.Err() == nil {
+				b.recordFailure(c.opts, err)
+			}
+		}(b)
+	}
+	wg.Wait()
+}
+
+// resolve 重新解析节点地址；解析失败或结果为空时保留原有节点
+func (c *RPCClient) resolve(ctx context.Context) error {
+	if _, ok := c.resolver.(StaticResolver); ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.DialTimeout)
+	defer cancel()
+	addrs, err := c.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%v: %w", c.resolver, errNoBackend)
+	}
+	c.setBackends(addrs)
+	return nil
+}
+
+// setBackends 更新节点列表，沿用仍然存在的节点的连接池和健康状态。
+// 移除的节点等待RequestTimeout后再关闭连接，让在途请求完成
+func (c *RPCClient) setBackends(addrs []string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	// 每次请求建立新TCP连接
-	conn, err := net.Dial("tcp", c.serverAddr) // 此处就是和localhost:9090建立连接
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to server: %v", err)
+	existing := make(map[string]*backend, len(c.backends))
+	for _, b := range c.backends {
+		existing[b.addr] = b
 	}
-	defer conn.Close()
 
-	// 设置连接超时
-	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	backends := make([]*backend, 0, len(addrs))
+	for _, addr := range addrs {
+		b, ok := existing[addr]
+		if ok {
+			delete(existing, addr)
+		} else {
+			b = newBackend(addr, c.opts)
+			if c.backends != nil {
+				slog.Info("RPC server added", "addr", addr)
+			}
+		}
+		backends = append(backends, b)
+	}
+	for addr, b := range existing {
+		slog.Info("RPC server removed", "addr", addr)
+		time.AfterFunc(c.opts.RequestTimeout, b.pool.close)
+	}
+	c.backends = backends
+}
 
-	// 生成消息ID
-	c.msgIDMutex.Lock()
-	c.msgID++
-	msgID := c.msgID
-	c.msgIDMutex.Unlock()
+func (c *RPCClient) currentBackends() []*backend {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.backends
+}
 
-	// 序列化payload
-	payloadData, err := json.Marshal(payload)
+// Stats 返回各节点连接池的合计状态
+func (c *RPCClient) Stats() Stats {
+	total := Stats{Retries: c.retries.Load()}
+	now := time.Now()
+	for _, b := range c.currentBackends() {
+		stats := b.pool.stats()
+		total.PoolSize += stats.PoolSize
+		total.OpenConns += stats.OpenConns
+		total.InFlight += stats.InFlight
+		total.Dials += stats.Dials
+		total.DialFailures += stats.DialFailures
+		total.Backends++
+		if !b.ejected(now) {
+			total.HealthyBackends++
+		}
+		total.Ejections += b.ejections.Load()
+	}
+	return total
+}
+
+// 每隔HeartbeatInterval检查所有节点，心跳结果计入节点的健康状态
+func (c *RPCClient) heartbeatLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, b := range c.currentBackends() {
+				if err := b.pool.heartbeat(c.nextMsgID, c.opts.RequestTimeout); err != nil {
+					b.recordFailure(c.opts, err)
+				} else {
+					b.recordSuccess()
+				}
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *RPCClient) resolveLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.opts.ResolveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.resolve(context.Background()); err != nil {
+				slog.Warn("Failed to resolve RPC servers", "servers", c.resolver, "error", err)
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// 生成消息ID，服务端原样返回用于匹配响应
+func (c *RPCClient) nextMsgID() uint32 {
+	return atomic.AddUint32(&c.msgID, 1)
+}
+
+// 发送RPC请求并等待响应
+// 多个请求通过消息ID复用同一条长连接，不再串行。幂等请求因连接错误失败时换一个节点重试，
+// 其他请求只在发出之前（拨号失败）换节点，避免重复执行
+func (c *RPCClient) sendRequest(ctx context.Context, msgType uint32, payload interface{}) (resp *rpc.Response, err error) {
+	select {
+	case <-c.closed:
+		return nil, fmt.Errorf("rpc client closed")
+	default:
+	}
+
+	ctx, span := tracer.Start(ctx, tracing.RPCSpanName(msgType),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.RPCAttributes(msgType)...),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.RequestTimeout)
+		defer cancel()
+	}
+
+	var tried []*backend
+	var lastErr error
+	for {
+		b, resp, err := c.sendTo(ctx, tried, msgType, payload)
+		if err == nil {
+			b.recordSuccess()
+			span.SetAttributes(tracing.RPCStatusKey.Int(int(resp.Status)), semconv.ServerAddress(b.addr))
+			return resp, nil
+		}
+		if b == nil {
+			// 重试时已没有其他节点，返回上一次的错误
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+		// 请求过大与节点无关，换节点也不会成功
+		if errors.Is(err, rpc.ErrFrameTooLarge) {
+			return nil, err
+		}
+		lastErr = err
+
+		// 调用方取消不代表节点异常
+		if !errors.Is(err, context.Canceled) {
+			b.recordFailure(c.opts, err)
+		}
+		tried = append(tried, b)
+		if ctx.Err() != nil || !rpc.IsIdempotent(msgType) || len(tried) > c.opts.MaxRetries {
+			return nil, err
+		}
+
+		c.retries.Add(1)
+		span.AddEvent("retry", trace.WithAttributes(semconv.ServerAddress(b.addr)))
+		slog.WarnContext(ctx, "RPC request failed, retrying on another server",
+			"type", rpc.MessageTypeName(msgType), "addr", b.addr, "error", err)
+	}
+}
+
+// sendTo 选择一个未尝试过的节点发送请求。没有可用节点或请求无法编码时返回的backend为nil
+func (c *RPCClient) sendTo(ctx context.Context, tried []*backend, msgType uint32, payload interface{}) (*backend, *rpc.Response, error) {
+	b, conn, err := c.pick(ctx, tried)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// 按连接协商出的编解码器序列化payload
+	payloadData, err := conn.codec.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// 创建消息
 	msg := &rpc.Message{
 		Type:    msgType,
-		ID:      msgID,
+		ID:      c.nextMsgID(),
 		Payload: payloadData,
+
+		RequestID: logging.RequestID(ctx),
+		Metadata:  tracing.Inject(ctx),
+	}
+
+	b.outstanding.Add(1)
+	defer b.outstanding.Add(-1)
+	resp, err := conn.roundTrip(ctx, msg)
+	return b, resp, err
+}
+
+// 登录
+func (c *RPCClient) Login(ctx context.Context, username, password string, clientInfo models.ClientInfo) (*models.LoginResponse, error) {
+	payload := &models.LoginRequest{
+		Username:   username,
+		Password:   password,
+		ClientInfo: clientInfo,
 	}
 
-	// 序列化消息
-	msgData, err := msg.Serialize()
+	response, err := c.sendRequest(ctx, rpc.MSG_LOGIN, payload)
 	if err != nil {
 		return nil, err
 	}
 
-	// 发送消息
-	_, err = conn.Write(msgData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write message: %v", err)
+	return decodeLoginResponse(response)
+}
+
+// Login2FA 提交登录挑战Token和验证码（或恢复码）完成两步登录
+func (c *RPCClient) Login2FA(ctx context.Context, challengeToken, code string) (*models.LoginResponse, error) {
+	payload := &models.TwoFactorLoginRequest{
+		ChallengeToken: challengeToken,
+		Code:           code,
 	}
 
-	// 读取响应
-	response, err := c.readResponseFromConn(conn)
+	response, err := c.sendRequest(ctx, rpc.MSG_LOGIN_2FA, payload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return nil, err
 	}
 
-	return response, nil
+	return decodeLoginResponse(response)
 }
 
-// 从指定连接读取响应
-func (c *RPCClient) readResponseFromConn(conn net.Conn) (*rpc.Response, error) {
-	// 设置读取超时
-	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+// RefreshToken 用刷新令牌换取新的访问令牌和刷新令牌（JWT模式）
+func (c *RPCClient) RefreshToken(ctx context.Context, refreshToken string) (*models.LoginResponse, error) {
+	payload := &models.RefreshTokenRequest{
+		RefreshToken: refreshToken,
+	}
 
-	// 读取长度前缀
-	lengthBuf := make([]byte, 4)
-	_, err := io.ReadFull(conn, lengthBuf)
+	response, err := c.sendRequest(ctx, rpc.MSG_REFRESH_TOKEN, payload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read length prefix: %v", err)
+		return nil, err
 	}
 
-	length := binary.BigEndian.Uint32(lengthBuf)
+	return decodeLoginResponse(response)
+}
 
-	// 读取消息体
-	messageBuf := make([]byte, length)
-	_, err = io.ReadFull(conn, messageBuf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read message body: %v", err)
+func decodeLoginResponse(response *rpc.Response) (*models.LoginResponse, error) {
+	if response.Status != rpc.STATUS_SUCCESS {
+		loginResp := &models.LoginResponse{
+			Success: false,
+			Message: response.Message,
+		}
+		// 被限流时Payload中携带重试等待时间
+		if response.Status == rpc.STATUS_RATE_LIMITED && len(response.Payload) > 0 {
+			if err := response.DecodePayload(loginResp); err != nil {
+				return nil, err
+			}
+		}
+		return loginResp, nil
 	}
 
-	// 解析响应
-	response, err := rpc.DeserializeResponse(messageBuf)
-	if err != nil {
+	var loginResp models.LoginResponse
+	if err := response.DecodePayload(&loginResp); err != nil {
 		return nil, err
 	}
 
-	return response, nil
+	return &loginResp, nil
 }
 
-// 登录
-func (c *RPCClient) Login(username, password string) (*models.LoginResponse, error) {
+// 注册
+func (c *RPCClient) Register(ctx context.Context, username, password, nickname string) (*models.RegisterResponse, error) {
 	payload := map[string]string{
 		"username": username,
 		"password": password,
+		"nickname": nickname,
 	}
 
-	response, err := c.sendRequest(rpc.MSG_LOGIN, payload)
+	response, err := c.sendRequest(ctx, rpc.MSG_REGISTER, payload)
 	if err != nil {
 		return nil, err
 	}
 
 	if response.Status != rpc.STATUS_SUCCESS {
-		return &models.LoginResponse{
+		return &models.RegisterResponse{
 			Success: false,
 			Message: response.Message,
 		}, nil
 	}
 
-	var loginResp models.LoginResponse
-	if err := json.Unmarshal(response.Payload, &loginResp); err != nil {
+	var registerResp models.RegisterResponse
+	if err := response.DecodePayload(&registerResp); err != nil {
 		return nil, err
 	}
 
-	return &loginResp, nil
+	return &registerResp, nil
 }
 
 // 获取用户信息
-func (c *RPCClient) GetProfile(token string) (*models.GetProfileResponse, error) {
+func (c *RPCClient) GetProfile(ctx context.Context, token string) (*models.GetProfileResponse, error) {
 	payload := map[string]string{
 		"token": token,
 	}
 
-	response, err := c.sendRequest(rpc.MSG_GET_PROFILE, payload)
+	response, err := c.sendRequest(ctx, rpc.MSG_GET_PROFILE, payload)
 	if err != nil {
 		return nil, err
 	}
@@ -161,7 +537,7 @@ func (c *RPCClient) GetProfile(token string) (*models.GetProfileResponse, error)
 	}
 
 	var profileResp models.GetProfileResponse
-	if err := json.Unmarshal(response.Payload, &profileResp); err != nil {
+	if err := response.DecodePayload(&profileResp); err != nil {
 		return nil, err
 	}
 
@@ -169,14 +545,14 @@ func (c *RPCClient) GetProfile(token string) (*models.GetProfileResponse, error)
 }
 
 // 更新用户信息
-func (c *RPCClient) UpdateProfile(token, nickname, profilePic string) (*models.UpdateProfileResponse, error) {
+func (c *RPCClient) UpdateProfile(ctx context.Context, token, nickname, profilePic string) (*models.UpdateProfileResponse, error) {
 	payload := map[string]string{
 		"token":       token,
 		"nickname":    nickname,
 		"profile_pic": profilePic,
 	}
 
-	response, err := c.sendRequest(rpc.MSG_UPDATE_PROFILE, payload)
+	response, err := c.sendRequest(ctx, rpc.MSG_UPDATE_PROFILE, payload)
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +565,7 @@ func (c *RPCClient) UpdateProfile(token, nickname, profilePic string) (*models.U
 	}
 
 	var updateResp models.UpdateProfileResponse
-	if err := json.Unmarshal(response.Payload, &updateResp); err != nil {
+	if err := response.DecodePayload(&updateResp); err != nil {
 		return nil, err
 	}
 
@@ -197,12 +573,12 @@ func (c *RPCClient) UpdateProfile(token, nickname, profilePic string) (*models.U
 }
 
 // 登出
-func (c *RPCClient) Logout(token string) error {
+func (c *RPCClient) Logout(ctx context.Context, token string) error {
 	payload := map[string]string{
 		"token": token,
 	}
 
-	response, err := c.sendRequest(rpc.MSG_LOGOUT, payload)
+	response, err := c.sendRequest(ctx, rpc.MSG_LOGOUT, payload)
 	if err != nil {
 		return err
 	}
@@ -214,11 +590,315 @@ func (c *RPCClient) Logout(token string) error {
 	return nil
 }
 
+// ListSessions 列出当前用户的所有有效会话
+func (c *RPCClient) ListSessions(ctx context.Context, token string) (*models.ListSessionsResponse, error) {
+	payload := map[string]string{
+		"token": token,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_LIST_SESSIONS, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status != rpc.STATUS_SUCCESS {
+		return &models.ListSessionsResponse{
+			Success: false,
+			Message: response.Message,
+		}, nil
+	}
+
+	var sessionsResp models.ListSessionsResponse
+	if err := response.DecodePayload(&sessionsResp); err != nil {
+		return nil, err
+	}
+
+	return &sessionsResp, nil
+}
+
+// RevokeSession 注销当前用户的指定会话
+func (c *RPCClient) RevokeSession(ctx context.Context, token, sessionID string) (*models.SimpleResponse, error) {
+	payload := map[string]string{
+		"token":      token,
+		"session_id": sessionID,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_REVOKE_SESSION, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SimpleResponse{
+		Success: response.Status == rpc.STATUS_SUCCESS,
+		Message: response.Message,
+	}, nil
+}
+
+// RevokeAllSessions 注销当前用户的所有会话，包括发起请求的会话
+func (c *RPCClient) RevokeAllSessions(ctx context.Context, token string) (*models.SimpleResponse, error) {
+	payload := map[string]string{
+		"token": token,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_REVOKE_ALL_SESSIONS, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SimpleResponse{
+		Success: response.Status == rpc.STATUS_SUCCESS,
+		Message: response.Message,
+	}, nil
+}
+
+// SetupTOTP 获取待绑定的TOTP密钥
+func (c *RPCClient) SetupTOTP(ctx context.Context, token string) (*models.TOTPSetupResponse, error) {
+	payload := map[string]string{
+		"token": token,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_TOTP_SETUP, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status != rpc.STATUS_SUCCESS {
+		return &models.TOTPSetupResponse{
+			Success: false,
+			Message: response.Message,
+		}, nil
+	}
+
+	var setupResp models.TOTPSetupResponse
+	if err := response.DecodePayload(&setupResp); err != nil {
+		return nil, err
+	}
+
+	return &setupResp, nil
+}
+
+// ConfirmTOTP 提交验证码确认绑定，成功时返回恢复码
+func (c *RPCClient) ConfirmTOTP(ctx context.Context, token, code string) (*models.TOTPConfirmResponse, error) {
+	payload := map[string]string{
+		"token": token,
+		"code":  code,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_TOTP_CONFIRM, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status != rpc.STATUS_SUCCESS {
+		return &models.TOTPConfirmResponse{
+			Success: false,
+			Message: response.Message,
+		}, nil
+	}
+
+	var confirmResp models.TOTPConfirmResponse
+	if err := response.DecodePayload(&confirmResp); err != nil {
+		return nil, err
+	}
+
+	return &confirmResp, nil
+}
+
+// DisableTOTP 凭验证码或恢复码关闭两步验证
+func (c *RPCClient) DisableTOTP(ctx context.Context, token, code string) (*models.SimpleResponse, error) {
+	payload := map[string]string{
+		"token": token,
+		"code":  code,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_TOTP_DISABLE, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SimpleResponse{
+		Success: response.Status == rpc.STATUS_SUCCESS,
+		Message: response.Message,
+	}, nil
+}
+
+// ChangePassword 凭当前密码修改密码，成功后该用户的所有会话失效
+func (c *RPCClient) ChangePassword(ctx context.Context, token, currentPassword, newPassword string) (*models.SimpleResponse, error) {
+	payload := map[string]string{
+		"token":            token,
+		"current_password": currentPassword,
+		"new_password":     newPassword,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_CHANGE_PASSWORD, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SimpleResponse{
+		Success: response.Status == rpc.STATUS_SUCCESS,
+		Message: response.Message,
+	}, nil
+}
+
+// RequestPasswordReset 申请重置密码，无论用户是否存在都返回成功
+func (c *RPCClient) RequestPasswordReset(ctx context.Context, username string) (*models.SimpleResponse, error) {
+	payload := &models.ForgotPasswordRequest{
+		Username: username,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_REQUEST_PASSWORD_RESET, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SimpleResponse{
+		Success: response.Status == rpc.STATUS_SUCCESS,
+		Message: response.Message,
+	}, nil
+}
+
+// ResetPassword 凭重置Token设置新密码
+func (c *RPCClient) ResetPassword(ctx context.Context, resetToken, newPassword string) (*models.SimpleResponse, error) {
+	payload := &models.ResetPasswordRequest{
+		ResetToken:  resetToken,
+		NewPassword: newPassword,
+	}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_RESET_PASSWORD, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SimpleResponse{
+		Success: response.Status == rpc.STATUS_SUCCESS,
+		Message: response.Message,
+	}, nil
+}
+
+// JWKS 获取校验访问令牌的公钥集合（JWT模式）
+func (c *RPCClient) JWKS(ctx context.Context) (*auth.JWKSet, error) {
+	payload := map[string]string{}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_JWKS, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status != rpc.STATUS_SUCCESS {
+		return nil, fmt.Errorf("get jwks failed: %s", response.Message)
+	}
+
+	var jwks auth.JWKSet
+	if err := response.DecodePayload(&jwks); err != nil {
+		return nil, err
+	}
+
+	return &jwks, nil
+}
+
+// ErrForbidden 当前会话没有调用该接口的权限
+var ErrForbidden = errors.New("permission denied")
+
+// AdminListUsers 分页列出用户及其角色，分页和搜索参数与ListUsers相同
+func (c *RPCClient) AdminListUsers(ctx context.Context, token string, req models.ListUsersRequest) (*models.AdminListUsersResponse, error) {
+	payload := struct {
+		Token string `json:"token"`
+		models.ListUsersRequest
+	}{token, req}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_ADMIN_LIST_USERS, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status == rpc.STATUS_FORBIDDEN {
+		return nil, ErrForbidden
+	}
+	if response.Status != rpc.STATUS_SUCCESS {
+		return &models.AdminListUsersResponse{
+			Success: false,
+			Message: response.Message,
+		}, nil
+	}
+
+	var listResp models.AdminListUsersResponse
+	if err := response.DecodePayload(&listResp); err != nil {
+		return nil, err
+	}
+
+	return &listResp, nil
+}
+
+// AdminGetUser 获取用户详情及其角色
+func (c *RPCClient) AdminGetUser(ctx context.Context, token string, userID int64) (*models.AdminUserResponse, error) {
+	payload := struct {
+		Token string `json:"token"`
+		models.AdminUserRequest
+	}{token, models.AdminUserRequest{UserID: userID}}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_ADMIN_GET_USER, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeAdminUserResponse(response)
+}
+
+// AdminUpdateUser 修改用户资料或角色
+func (c *RPCClient) AdminUpdateUser(ctx context.Context, token string, req *models.AdminUpdateUserRequest) (*models.AdminUserResponse, error) {
+	payload := struct {
+		Token string `json:"token"`
+		models.AdminUpdateUserRequest
+	}{token, *req}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_ADMIN_UPDATE_USER, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeAdminUserResponse(response)
+}
+
+// AdminSetUserStatus 禁用或启用用户
+func (c *RPCClient) AdminSetUserStatus(ctx context.Context, token string, userID int64, status string) (*models.AdminUserResponse, error) {
+	payload := struct {
+		Token string `json:"token"`
+		models.AdminSetUserStatusRequest
+	}{token, models.AdminSetUserStatusRequest{UserID: userID, Status: status}}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_ADMIN_SET_USER_STATUS, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeAdminUserResponse(response)
+}
+
+func decodeAdminUserResponse(response *rpc.Response) (*models.AdminUserResponse, error) {
+	if response.Status == rpc.STATUS_FORBIDDEN {
+		return nil, ErrForbidden
+	}
+	if response.Status != rpc.STATUS_SUCCESS {
+		return &models.AdminUserResponse{
+			Success: false,
+			Message: response.Message,
+		}, nil
+	}
+
+	var userResp models.AdminUserResponse
+	if err := response.DecodePayload(&userResp); err != nil {
+		return nil, err
+	}
+
+	return &userResp, nil
+}
+
 // 心跳
-func (c *RPCClient) Heartbeat() error {
+func (c *RPCClient) Heartbeat(ctx context.Context) error {
 	payload := map[string]string{}
 
-	response, err := c.sendRequest(rpc.MSG_HEARTBEAT, payload)
+	response, err := c.sendRequest(ctx, rpc.MSG_HEARTBEAT, payload)
 	if err != nil {
 		return err
 	}
@@ -229,3 +909,33 @@ func (c *RPCClient) Heartbeat() error {
 
 	return nil
 }
+
+// ListUsers 按游标分页列出用户，req.Query非空时按用户名或昵称搜索
+func (c *RPCClient) ListUsers(ctx context.Context, token string, req models.ListUsersRequest) (*models.ListUsersResponse, error) {
+	payload := struct {
+		Token string `json:"token"`
+		models.ListUsersRequest
+	}{token, req}
+
+	response, err := c.sendRequest(ctx, rpc.MSG_LIST_USERS, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status == rpc.STATUS_FORBIDDEN {
+		return nil, ErrForbidden
+	}
+	if response.Status != rpc.STATUS_SUCCESS {
+		return &models.ListUsersResponse{
+			Success: false,
+			Message: response.Message,
+		}, nil
+	}
+
+	var listResp models.ListUsersResponse
+	if err := response.DecodePayload(&listResp); err != nil {
+		return nil, err
+	}
+
+	return &listResp, nil
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// acceptAll 接受连接但不处理，只用于测试拨号
+func acceptAll(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestConnectRetriesUntilServerIsUp(t *testing.T) {
+	addr := freeAddr(t)
+	c, err := NewRPCClient([]string{addr}, Options{PoolSize: 1, DialTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 服务端晚于客户端启动
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		t.Cleanup(func() { l.Close() })
+		acceptAll(l)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if stats := c.Stats(); stats.OpenConns != 1 || stats.DialFailures == 0 {
+		t.Errorf("stats = %+v, want 1 open conn after failed dials", stats)
+	}
+}
+
+func TestConnectFailsOverAndTimesOut(t *testing.T) {
+	down := freeAddr(t)
+
+	c, err := NewRPCClient([]string{down}, Options{PoolSize: 1, DialTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if err := c.Connect(ctx); err == nil {
+		t.Error("Connect succeeded with no server")
+	}
+	c.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go acceptAll(l)
+
+	// 其中一个地址不可用时仍能连接
+	c, err = NewRPCClient([]string{down, l.Addr().String()}, Options{PoolSize: 1, DialTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < 4; i++ {
+		if _, _, err := c.pick(context.Background(), nil); err != nil {
+			t.Fatalf("conn %d: %v", i, err)
+		}
+	}
+}
+
+// 预热跳过Connect中刚刚连接失败的节点，不再对其拨号
+func TestConnectSkipsFailedBackendsWhenWarmingUp(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go acceptAll(l)
+
+	// 轮询从第二个节点开始，Connect先尝试不可用的节点
+	c, err := NewRPCClient([]string{l.Addr().String(), freeAddr(t)}, Options{PoolSize: 2, DialTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	backends := c.currentBackends()
+	if dials := backends[1].pool.dials.Load(); dials != 1 {
+		t.Errorf("failed backend dialed %d times, want 1", dials)
+	}
+	if stats := c.Stats(); stats.OpenConns != 2 {
+		t.Errorf("stats = %+v, want the healthy backend's pool warmed up", stats)
+	}
+}
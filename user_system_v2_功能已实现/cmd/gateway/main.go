@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"user_system_v1/app"
+)
+
+// HTTP网关：不访问数据库，所有请求通过RPC转发到USER_SERVICE_ADDRS或USER_SERVICE_SRV中的用户服务
+func main() {
+	cfg := app.Init()
+
+	gateway, err := app.NewGateway(cfg)
+	if err != nil {
+		app.Fatal("Failed to start HTTP gateway", "error", err)
+	}
+
+	slog.Info("Starting", "http", ":"+cfg.HTTPServerPort)
+	os.Exit(app.Run(cfg, gateway))
+}
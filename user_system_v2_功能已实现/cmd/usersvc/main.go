@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"user_system_v1/app"
+)
+
+// 用户服务：只监听TCP RPC端口，由一个或多个HTTP网关访问。
+// 监控指标和健康检查在METRICS_PORT上提供
+func main() {
+	cfg := app.Init()
+
+	// migrate子命令只执行数据库迁移
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		app.Migrate(cfg, os.Args[2:])
+		return
+	}
+
+	usersvc, err := app.NewUserService(cfg)
+	if err != nil {
+		app.Fatal("Failed to start user service", "error", err)
+	}
+	ops := app.NewOps(cfg.MetricsPort, usersvc.ReadinessChecks())
+
+	slog.Info("Starting",
+		"tcp", ":"+cfg.TCPServerPort,
+		"metrics", ":"+cfg.MetricsPort,
+	)
+	os.Exit(app.Run(cfg, ops, usersvc))
+}
@@ -1,58 +1,457 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultConfigFile 未通过CONFIG_FILE指定配置文件时，该文件存在则加载
+const DefaultConfigFile = "config/config.yaml"
+
+// Config 服务配置。yaml为配置文件中的键，env为覆盖配置文件的环境变量。
+// 时长均以秒为单位
 type Config struct {
-	MySQLHost     string
-	MySQLPort     string
-	MySQLUser     string
-	MySQLPassword string
-	MySQLDatabase string
-	
-	RedisHost     string
-	RedisPort     string
-	RedisPassword string
-	RedisDB       int
-	
-	HTTPServerPort string
-	TCPServerPort  string
-	
-	SessionExpiration int // 秒
-}
-
-func LoadConfig() *Config {
-	// 添加调试信息
-	mysqlUser := getEnv("MYSQL_USER", "user_system")  // 改为user_system
-	mysqlPassword := getEnv("MYSQL_PASSWORD", "password123")  // 改为password123
-	
-	fmt.Printf("DEBUG: MYSQL_USER from env: %s\n", mysqlUser)
-	fmt.Printf("DEBUG: MYSQL_PASSWORD from env: %s\n", mysqlPassword)
-	
+	MySQLHost         string `yaml:"mysql_host" env:"MYSQL_HOST"`
+	MySQLPort         string `yaml:"mysql_port" env:"MYSQL_PORT"`
+	MySQLUser         string `yaml:"mysql_user" env:"MYSQL_USER"`
+	MySQLPassword     string `yaml:"mysql_password" env:"MYSQL_PASSWORD"`
+	MySQLPasswordFile string `yaml:"mysql_password_file" env:"MYSQL_PASSWORD_FILE"` // 从文件读取密码，与MySQLPassword二选一
+	MySQLDatabase     string `yaml:"mysql_database" env:"MYSQL_DATABASE"`
+
+	MySQLMaxOpenConns    int `yaml:"mysql_max_open_conns" env:"MYSQL_MAX_OPEN_CONNS"`
+	MySQLMaxIdleConns    int `yaml:"mysql_max_idle_conns" env:"MYSQL_MAX_IDLE_CONNS"`
+	MySQLConnMaxLifetime int `yaml:"mysql_conn_max_lifetime" env:"MYSQL_CONN_MAX_LIFETIME"` // 秒
+
+	RedisHost         string `yaml:"redis_host" env:"REDIS_HOST"`
+	RedisPort         string `yaml:"redis_port" env:"REDIS_PORT"`
+	RedisPassword     string `yaml:"redis_password" env:"REDIS_PASSWORD"`
+	RedisPasswordFile string `yaml:"redis_password_file" env:"REDIS_PASSWORD_FILE"` // 从文件读取密码，与RedisPassword二选一
+	RedisDB           int    `yaml:"redis_db" env:"REDIS_DB"`
+	RedisPoolSize     int    `yaml:"redis_pool_size" env:"REDIS_POOL_SIZE"`
+
+	HTTPServerPort   string `yaml:"http_port" env:"HTTP_PORT"`
+	TCPServerPort    string `yaml:"tcp_port" env:"TCP_PORT"`
+	HTTPReadTimeout  int    `yaml:"http_read_timeout" env:"HTTP_READ_TIMEOUT"`   // 秒
+	HTTPWriteTimeout int    `yaml:"http_write_timeout" env:"HTTP_WRITE_TIMEOUT"` // 秒
+	HTTPIdleTimeout  int    `yaml:"http_idle_timeout" env:"HTTP_IDLE_TIMEOUT"`   // 秒
+	ShutdownTimeout  int    `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`     // 秒
+
+	UploadDir     string `yaml:"upload_dir" env:"UPLOAD_DIR"`
+	UploadMaxSize int64  `yaml:"upload_max_size" env:"UPLOAD_MAX_SIZE"` // 字节，头像文件的最大长度
+
+	SessionExpiration int `yaml:"session_expiration" env:"SESSION_EXPIRATION"` // 秒
+
+	LogLevel  string `yaml:"log_level" env:"LOG_LEVEL"`   // debug、info、warn 或 error
+	LogFormat string `yaml:"log_format" env:"LOG_FORMAT"` // text 或 json
+
+	// 链路追踪
+	TracingExporter    string  `yaml:"tracing_exporter" env:"TRACING_EXPORTER"`         // none、stdout 或 otlp
+	TracingEndpoint    string  `yaml:"tracing_endpoint" env:"TRACING_ENDPOINT"`         // OTLP/HTTP采集器地址（host:port）
+	TracingInsecure    bool    `yaml:"tracing_insecure" env:"TRACING_INSECURE"`         // 以明文HTTP连接采集器
+	TracingServiceName string  `yaml:"tracing_service_name" env:"TRACING_SERVICE_NAME"` // 上报的service.name
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio" env:"TRACING_SAMPLE_RATIO"` // 0到1，对没有上游采样决定的请求按比例采样
+
+	UserServiceAddrs     []string `yaml:"user_service_addrs" env:"USER_SERVICE_ADDRS"`         // 网关连接的用户服务地址（host:port），为空时使用 localhost:tcp_port
+	UserServiceSRV       string   `yaml:"user_service_srv" env:"USER_SERVICE_SRV"`             // 通过DNS SRV记录发现用户服务，设置后忽略user_service_addrs
+	RPCResolveInterval   int      `yaml:"rpc_resolve_interval" env:"RPC_RESOLVE_INTERVAL"`     // 秒，重新查询SRV记录的间隔
+	RPCConnectTimeout    int      `yaml:"rpc_connect_timeout" env:"RPC_CONNECT_TIMEOUT"`       // 秒，网关启动时等待用户服务可连接的最长时间
+	RPCBalancer          string   `yaml:"rpc_balancer" env:"RPC_BALANCER"`                     // 多个用户服务之间的负载均衡：round_robin 或 least_outstanding
+	RPCMaxRetries        int      `yaml:"rpc_max_retries" env:"RPC_MAX_RETRIES"`               // 只读请求因连接错误失败后换节点重试的次数，0表示不重试
+	RPCEjectAfter        int      `yaml:"rpc_eject_after" env:"RPC_EJECT_AFTER"`               // 用户服务连续失败多少次后暂时摘除，0表示不摘除
+	RPCEjectDuration     int      `yaml:"rpc_eject_duration" env:"RPC_EJECT_DURATION"`         // 秒，摘除的时长，期间心跳成功则提前恢复
+	MetricsPort          string   `yaml:"metrics_port" env:"METRICS_PORT"`                     // 单独部署的用户服务提供监控指标和健康检查的HTTP端口
+	RPCPoolSize          int      `yaml:"rpc_pool_size" env:"RPC_POOL_SIZE"`                   // HTTP网关到每个用户服务地址的长连接数
+	RPCDialTimeout       int      `yaml:"rpc_dial_timeout" env:"RPC_DIAL_TIMEOUT"`             // 秒
+	RPCRequestTimeout    int      `yaml:"rpc_request_timeout" env:"RPC_REQUEST_TIMEOUT"`       // 秒
+	RPCHeartbeatInterval int      `yaml:"rpc_heartbeat_interval" env:"RPC_HEARTBEAT_INTERVAL"` // 秒
+	RPCIdleTimeout       int      `yaml:"rpc_idle_timeout" env:"RPC_IDLE_TIMEOUT"`             // 秒，TCP服务器关闭空闲连接的时间，应大于心跳间隔
+	RPCMaxFrameSize      int      `yaml:"rpc_max_frame_size" env:"RPC_MAX_FRAME_SIZE"`         // 字节，单个RPC帧的最大长度
+	RPCCodec             string   `yaml:"rpc_codec" env:"RPC_CODEC"`                           // HTTP网关与TCP服务器之间的编解码器：json 或 msgpack
+
+	PasswordHashAlgorithm string `yaml:"password_hash_algorithm" env:"PASSWORD_HASH_ALGORITHM"` // bcrypt 或 argon2id
+
+	// 登录防暴力破解
+	LoginMaxFailures     int `yaml:"login_max_failures" env:"LOGIN_MAX_FAILURES"`         // 同一用户名失败多少次后锁定，0表示不限制
+	LoginIPMaxFailures   int `yaml:"login_ip_max_failures" env:"LOGIN_IP_MAX_FAILURES"`   // 同一IP失败多少次后锁定，0表示不限制
+	LoginDelayAfter      int `yaml:"login_delay_after" env:"LOGIN_DELAY_AFTER"`           // 同一用户名失败多少次后开始递增延迟，0表示不延迟
+	LoginMaxDelay        int `yaml:"login_max_delay" env:"LOGIN_MAX_DELAY"`               // 秒，递增延迟的上限
+	LoginFailureWindow   int `yaml:"login_failure_window" env:"LOGIN_FAILURE_WINDOW"`     // 秒，该时间内没有新的失败则清零计数
+	LoginLockoutDuration int `yaml:"login_lockout_duration" env:"LOGIN_LOCKOUT_DURATION"` // 秒
+
+	// 密码重置
+	PasswordResetURL        string `yaml:"password_reset_url" env:"PASSWORD_RESET_URL"`               // 重置链接前缀，Token追加在其后
+	PasswordResetExpiration int    `yaml:"password_reset_expiration" env:"PASSWORD_RESET_EXPIRATION"` // 秒
+	Notifier                string `yaml:"notifier" env:"NOTIFIER"`                                   // 通知方式：log 或 file
+	NotifierFile            string `yaml:"notifier_file" env:"NOTIFIER_FILE"`                         // file方式的输出文件
+
+	// 登录令牌
+	AuthTokenMode           string   `yaml:"auth_token_mode" env:"AUTH_TOKEN_MODE"`                       // session：不透明Session Token；jwt：JWT访问令牌 + 轮换的刷新令牌
+	JWTPrivateKeyFile       string   `yaml:"jwt_private_key_file" env:"JWT_PRIVATE_KEY_FILE"`             // RS256私钥，为空时启动时临时生成
+	JWTVerificationKeyFiles []string `yaml:"jwt_verification_key_files" env:"JWT_VERIFICATION_KEY_FILES"` // 更换密钥后仍接受的旧公钥，旧令牌全部过期后即可移除
+	JWTIssuer               string   `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	JWTAccessTokenTTL       int      `yaml:"jwt_access_token_ttl" env:"JWT_ACCESS_TOKEN_TTL"` // 秒
+	RefreshTokenTTL         int      `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`       // 秒
+
+	AdminUsernames []string `yaml:"admin_usernames" env:"ADMIN_USERNAMES"` // 启动时授予admin角色的用户名
+
+	// 用户资料缓存
+	ProfileCacheTTL    int `yaml:"profile_cache_ttl" env:"PROFILE_CACHE_TTL"`       // 秒，0表示不缓存
+	ProfileCacheJitter int `yaml:"profile_cache_jitter" env:"PROFILE_CACHE_JITTER"` // 秒，在TTL基础上随机增加的最大时长
+
+	// TCP RPC端口的TLS配置
+	RPCTLSEnabled        bool     `yaml:"rpc_tls_enabled" env:"RPC_TLS_ENABLED"`
+	RPCTLSCertFile       string   `yaml:"rpc_tls_cert_file" env:"RPC_TLS_CERT_FILE"`               // 服务端证书
+	RPCTLSKeyFile        string   `yaml:"rpc_tls_key_file" env:"RPC_TLS_KEY_FILE"`                 // 服务端私钥
+	RPCTLSClientCAFile   string   `yaml:"rpc_tls_client_ca_file" env:"RPC_TLS_CLIENT_CA_FILE"`     // 校验客户端证书的CA，设置后开启mTLS
+	RPCTLSAllowedClients []string `yaml:"rpc_tls_allowed_clients" env:"RPC_TLS_ALLOWED_CLIENTS"`   // 允许的客户端证书CN/DNS名称，为空时只校验证书链
+	RPCTLSCAFile         string   `yaml:"rpc_tls_ca_file" env:"RPC_TLS_CA_FILE"`                   // 客户端校验服务端证书的CA
+	RPCTLSClientCertFile string   `yaml:"rpc_tls_client_cert_file" env:"RPC_TLS_CLIENT_CERT_FILE"` // 客户端证书（mTLS）
+	RPCTLSClientKeyFile  string   `yaml:"rpc_tls_client_key_file" env:"RPC_TLS_CLIENT_KEY_FILE"`   // 客户端私钥（mTLS）
+	RPCTLSServerName     string   `yaml:"rpc_tls_server_name" env:"RPC_TLS_SERVER_NAME"`           // 客户端校验的服务端证书名称
+}
+
+// Default 返回默认配置
+func Default() *Config {
 	return &Config{
-		MySQLHost:     getEnv("MYSQL_HOST", "localhost"),
-		MySQLPort:     getEnv("MYSQL_PORT", "3306"),
-		MySQLUser:     mysqlUser,
-		MySQLPassword: mysqlPassword,
-		MySQLDatabase: getEnv("MYSQL_DATABASE", "user_system"),
-		
-		RedisHost:     getEnv("REDIS_HOST", "localhost"),
-		RedisPort:     getEnv("REDIS_PORT", "6379"),
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
+		MySQLHost:     "localhost",
+		MySQLPort:     "3306",
+		MySQLUser:     "user_system",
+		MySQLPassword: "password123",
+		MySQLDatabase: "user_system",
+
+		MySQLMaxOpenConns:    100,
+		MySQLMaxIdleConns:    10,
+		MySQLConnMaxLifetime: 3600,
+
+		RedisHost:     "localhost",
+		RedisPort:     "6379",
 		RedisDB:       0,
-		
-		HTTPServerPort: getEnv("HTTP_PORT", "8080"),
-		TCPServerPort:  getEnv("TCP_PORT", "9090"),
-		
+		RedisPoolSize: 100,
+
+		HTTPServerPort:   "8080",
+		TCPServerPort:    "9090",
+		HTTPReadTimeout:  15,
+		HTTPWriteTimeout: 30,
+		HTTPIdleTimeout:  120,
+		ShutdownTimeout:  10,
+
+		UploadDir:     "uploads",
+		UploadMaxSize: 2 << 20,
+
 		SessionExpiration: 3600, // 1小时
+
+		LogLevel:  "info",
+		LogFormat: "text",
+
+		TracingExporter:    "none",
+		TracingEndpoint:    "localhost:4318",
+		TracingInsecure:    true,
+		TracingServiceName: "user_system",
+		TracingSampleRatio: 1,
+
+		RPCResolveInterval:   30,
+		RPCConnectTimeout:    30,
+		RPCBalancer:          "round_robin",
+		RPCMaxRetries:        1,
+		RPCEjectAfter:        3,
+		RPCEjectDuration:     30,
+		MetricsPort:          "9091",
+		RPCPoolSize:          8,
+		RPCDialTimeout:       5,
+		RPCRequestTimeout:    10,
+		RPCHeartbeatInterval: 15,
+		RPCIdleTimeout:       60,
+		RPCMaxFrameSize:      1 << 20,
+		RPCCodec:             "json",
+
+		PasswordHashAlgorithm: "bcrypt",
+
+		LoginMaxFailures:     5,
+		LoginIPMaxFailures:   50,
+		LoginDelayAfter:      3,
+		LoginMaxDelay:        30,
+		LoginFailureWindow:   900,
+		LoginLockoutDuration: 900,
+
+		PasswordResetURL:        "http://localhost:8080/?reset_token=",
+		PasswordResetExpiration: 1800,
+		Notifier:                "log",
+		NotifierFile:            "notifications.log",
+
+		AuthTokenMode:     "session",
+		JWTIssuer:         "user_system",
+		JWTAccessTokenTTL: 900,
+		RefreshTokenTTL:   7 * 24 * 3600,
+
+		ProfileCacheTTL:    300,
+		ProfileCacheJitter: 60,
+
+		RPCTLSServerName: "localhost",
 	}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Load 依次加载默认值、配置文件、环境变量，后者覆盖前者，然后校验并读取密码文件。
+// path为空时使用CONFIG_FILE环境变量，仍为空且DefaultConfigFile存在时加载该文件
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	// 默认密码由loadSecrets在既没有密码也没有密码文件时补上，避免被当作同时设置了两者
+	cfg.MySQLPassword, cfg.RedisPassword = "", ""
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		if _, err := os.Stat(DefaultConfigFile); err == nil {
+			path = DefaultConfigFile
+		}
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	// 先校验再读取密码文件，Validate据此判断密码和密码文件是否同时设置
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
-	return defaultValue
-} 
\ No newline at end of file
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile 读取YAML配置文件，未知的键视为错误，避免拼写错误被静默忽略
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// loadEnv 用env标签对应的环境变量覆盖配置，值为空的环境变量视为未设置
+func (c *Config) loadEnv() error {
+	var errs []error
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("env")
+		value := os.Getenv(key)
+		if key == "" || value == "" {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", key, value))
+				continue
+			}
+			field.SetInt(n)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid number %q", key, value))
+				continue
+			}
+			field.SetFloat(f)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid boolean %q", key, value))
+				continue
+			}
+			field.SetBool(b)
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(splitList(value)))
+		default:
+			panic(fmt.Sprintf("config: unsupported field type %s", field.Type()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadSecrets 从 *_FILE 指定的文件读取密码（如Docker/Kubernetes挂载的secret），去掉末尾换行；
+// 两者都没有设置时使用默认密码
+func (c *Config) loadSecrets() error {
+	defaults := Default()
+	secrets := []struct {
+		name     string
+		file     string
+		password *string
+		fallback string
+	}{
+		{"mysql_password", c.MySQLPasswordFile, &c.MySQLPassword, defaults.MySQLPassword},
+		{"redis_password", c.RedisPasswordFile, &c.RedisPassword, defaults.RedisPassword},
+	}
+
+	for _, secret := range secrets {
+		if secret.file == "" {
+			if *secret.password == "" {
+				*secret.password = secret.fallback
+			}
+			continue
+		}
+		data, err := os.ReadFile(secret.file)
+		if err != nil {
+			return fmt.Errorf("%s_file: %w", secret.name, err)
+		}
+		*secret.password = strings.TrimRight(string(data), "\r\n")
+	}
+	return nil
+}
+
+// Validate 检查配置是否有效，返回的错误列出所有问题
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.MySQLHost != "", "mysql_host is required")
+	check(validPort(c.MySQLPort), "mysql_port: invalid port %q", c.MySQLPort)
+	check(c.MySQLUser != "", "mysql_user is required")
+	check(c.MySQLDatabase != "", "mysql_database is required")
+	check(c.MySQLPassword == "" || c.MySQLPasswordFile == "", "mysql_password and mysql_password_file are mutually exclusive")
+	check(c.RedisPassword == "" || c.RedisPasswordFile == "", "redis_password and redis_password_file are mutually exclusive")
+	check(c.MySQLMaxOpenConns > 0, "mysql_max_open_conns must be positive")
+	check(c.MySQLMaxIdleConns >= 0 && c.MySQLMaxIdleConns <= c.MySQLMaxOpenConns,
+		"mysql_max_idle_conns must be between 0 and mysql_max_open_conns")
+	check(c.MySQLConnMaxLifetime >= 0, "mysql_conn_max_lifetime must not be negative")
+
+	check(c.RedisHost != "", "redis_host is required")
+	check(validPort(c.RedisPort), "redis_port: invalid port %q", c.RedisPort)
+	check(c.RedisDB >= 0, "redis_db must not be negative")
+	check(c.RedisPoolSize > 0, "redis_pool_size must be positive")
+
+	check(validPort(c.HTTPServerPort), "http_port: invalid port %q", c.HTTPServerPort)
+	check(validPort(c.TCPServerPort), "tcp_port: invalid port %q", c.TCPServerPort)
+	check(c.HTTPReadTimeout >= 0 && c.HTTPWriteTimeout >= 0 && c.HTTPIdleTimeout >= 0,
+		"http timeouts must not be negative")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+
+	check(c.UploadDir != "", "upload_dir is required")
+	check(c.UploadMaxSize > 0, "upload_max_size must be positive")
+
+	check(c.SessionExpiration > 0, "session_expiration must be positive")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log_level: must be debug, info, warn or error, got %q", c.LogLevel)
+	check(oneOf(c.LogFormat, "text", "json"), "log_format: must be text or json, got %q", c.LogFormat)
+
+	check(oneOf(c.TracingExporter, "none", "stdout", "otlp"),
+		"tracing_exporter: must be none, stdout or otlp, got %q", c.TracingExporter)
+	check(c.TracingExporter != "otlp" || c.TracingEndpoint != "", "tracing_endpoint is required when tracing_exporter is otlp")
+	check(c.TracingServiceName != "", "tracing_service_name is required")
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "tracing_sample_ratio must be between 0 and 1")
+
+	for _, addr := range c.UserServiceAddrs {
+		_, port, err := net.SplitHostPort(addr)
+		check(err == nil && validPort(port), "user_service_addrs: invalid address %q, want host:port", addr)
+	}
+	check(c.RPCResolveInterval > 0, "rpc_resolve_interval must be positive")
+	check(c.RPCConnectTimeout > 0, "rpc_connect_timeout must be positive")
+	check(oneOf(c.RPCBalancer, "round_robin", "least_outstanding"), "rpc_balancer: must be round_robin or least_outstanding, got %q", c.RPCBalancer)
+	check(c.RPCMaxRetries >= 0, "rpc_max_retries must not be negative")
+	check(c.RPCEjectAfter >= 0, "rpc_eject_after must not be negative")
+	check(c.RPCEjectDuration > 0, "rpc_eject_duration must be positive")
+	check(validPort(c.MetricsPort), "metrics_port: invalid port %q", c.MetricsPort)
+	check(c.RPCPoolSize > 0, "rpc_pool_size must be positive")
+	check(c.RPCDialTimeout > 0, "rpc_dial_timeout must be positive")
+	check(c.RPCRequestTimeout > 0, "rpc_request_timeout must be positive")
+	check(c.RPCHeartbeatInterval >= 0, "rpc_heartbeat_interval must not be negative")
+	check(c.RPCIdleTimeout == 0 || c.RPCIdleTimeout > c.RPCHeartbeatInterval,
+		"rpc_idle_timeout (%d) must be greater than rpc_heartbeat_interval (%d)", c.RPCIdleTimeout, c.RPCHeartbeatInterval)
+	check(c.RPCMaxFrameSize > 0, "rpc_max_frame_size must be positive")
+	check(oneOf(c.RPCCodec, "json", "msgpack"), "rpc_codec: must be json or msgpack, got %q", c.RPCCodec)
+
+	check(oneOf(c.PasswordHashAlgorithm, "bcrypt", "argon2id"),
+		"password_hash_algorithm: must be bcrypt or argon2id, got %q", c.PasswordHashAlgorithm)
+
+	check(c.LoginMaxFailures >= 0 && c.LoginIPMaxFailures >= 0 && c.LoginDelayAfter >= 0,
+		"login failure limits must not be negative")
+	check(c.LoginMaxDelay >= 0, "login_max_delay must not be negative")
+	check(c.LoginFailureWindow > 0, "login_failure_window must be positive")
+	check(c.LoginLockoutDuration > 0, "login_lockout_duration must be positive")
+
+	check(c.PasswordResetExpiration > 0, "password_reset_expiration must be positive")
+	check(oneOf(c.Notifier, "log", "file"), "notifier: must be log or file, got %q", c.Notifier)
+	check(c.Notifier != "file" || c.NotifierFile != "", "notifier_file is required when notifier is file")
+
+	check(oneOf(c.AuthTokenMode, "session", "jwt"), "auth_token_mode: must be session or jwt, got %q", c.AuthTokenMode)
+	check(c.JWTAccessTokenTTL > 0, "jwt_access_token_ttl must be positive")
+	check(c.RefreshTokenTTL > 0, "refresh_token_ttl must be positive")
+
+	check(c.ProfileCacheTTL >= 0 && c.ProfileCacheJitter >= 0, "profile cache durations must not be negative")
+
+	if c.RPCTLSEnabled {
+		check(c.RPCTLSCertFile != "" && c.RPCTLSKeyFile != "",
+			"rpc_tls_cert_file and rpc_tls_key_file are required when rpc_tls_enabled is true")
+		check((c.RPCTLSClientCertFile == "") == (c.RPCTLSClientKeyFile == ""),
+			"rpc_tls_client_cert_file and rpc_tls_client_key_file must be set together")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+func oneOf(value string, options ...string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+// RPCAddrs 网关连接的用户服务地址，未配置时为同一主机上的TCP端口
+func (c *Config) RPCAddrs() []string {
+	if len(c.UserServiceAddrs) > 0 {
+		return c.UserServiceAddrs
+	}
+	return []string{"localhost:" + c.TCPServerPort}
+}
+
+// 逗号分隔的列表
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
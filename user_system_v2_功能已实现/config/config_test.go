@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "config.yaml", "mysql_host: db.internal\nredis_pool_size: 20\nsession_expiration: 7200\n")
+	secret := writeFile(t, "mysql_password", "s3cret\n")
+
+	t.Setenv("SESSION_EXPIRATION", "1800")
+	t.Setenv("MYSQL_PASSWORD_FILE", secret)
+	t.Setenv("ADMIN_USERNAMES", "alice, bob")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MySQLHost != "db.internal" || cfg.RedisPoolSize != 20 {
+		t.Errorf("file values not applied: host %q, pool %d", cfg.MySQLHost, cfg.RedisPoolSize)
+	}
+	if cfg.SessionExpiration != 1800 {
+		t.Errorf("env should override file: session_expiration %d", cfg.SessionExpiration)
+	}
+	if cfg.MySQLPassword != "s3cret" {
+		t.Errorf("password file not applied: %q", cfg.MySQLPassword)
+	}
+	if len(cfg.AdminUsernames) != 2 || cfg.AdminUsernames[1] != "bob" {
+		t.Errorf("admin usernames: %v", cfg.AdminUsernames)
+	}
+	if cfg.TracingSampleRatio != 0.25 {
+		t.Errorf("float env not applied: tracing_sample_ratio %v", cfg.TracingSampleRatio)
+	}
+	if cfg.MySQLPort != "3306" {
+		t.Errorf("default not kept: mysql_port %q", cfg.MySQLPort)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr []string
+	}{
+		{
+			name:    "unknown key",
+			file:    "mysql_hots: localhost\n",
+			wantErr: []string{"mysql_hots"},
+		},
+		{
+			name:    "invalid env",
+			env:     map[string]string{"RPC_POOL_SIZE": "eight"},
+			wantErr: []string{"RPC_POOL_SIZE"},
+		},
+		{
+			name: "password and password file",
+			file: "mysql_password: inline\nredis_password: inline\n",
+			env:  map[string]string{"MYSQL_PASSWORD_FILE": "/run/secrets/mysql", "REDIS_PASSWORD_FILE": "/run/secrets/redis"},
+			wantErr: []string{
+				"mysql_password and mysql_password_file",
+				"redis_password and redis_password_file",
+			},
+		},
+		{
+			name:    "missing secret file",
+			env:     map[string]string{"REDIS_PASSWORD_FILE": "/nonexistent/redis_password"},
+			wantErr: []string{"redis_password_file"},
+		},
+		{
+			name: "validation",
+			file: "rpc_codec: xml\nsession_expiration: 0\nrpc_idle_timeout: 10\nrpc_tls_enabled: true\ntracing_sample_ratio: 2\nrpc_balancer: random\n",
+			wantErr: []string{
+				"rpc_codec",
+				"rpc_balancer",
+				"tracing_sample_ratio",
+				"session_expiration",
+				"rpc_idle_timeout",
+				"rpc_tls_cert_file",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			path := writeFile(t, "config.yaml", tt.file)
+
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+// 示例配置文件中的键必须都能识别，且与默认值一起通过校验
+func TestExampleConfig(t *testing.T) {
+	cfg, err := Load("config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有设置密码和密码文件时使用默认密码
+	if cfg.MySQLPassword != Default().MySQLPassword {
+		t.Errorf("default password not kept: %q", cfg.MySQLPassword)
+	}
+}
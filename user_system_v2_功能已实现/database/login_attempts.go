@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 登录失败计数，subject形如 user:<用户名> 或 ip:<IP>
+func loginFailuresKey(subject string) string {
+	return "login_failures:" + subject
+}
+
+// 登录锁定标记，键的剩余过期时间即剩余锁定时间
+func loginLockKey(subject string) string {
+	return "login_lock:" + subject
+}
+
+// RecordLoginFailure 登录失败次数加一并返回累计次数，window内没有新的失败时计数自动清零
+func (r *RedisDB) RecordLoginFailure(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, loginFailuresKey(subject))
+		pipe.Expire(ctx, loginFailuresKey(subject), window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// revertLoginFailure 计数存在且大于0时减一，保留原有的过期时间；
+// 计数已被清除或过期时不做处理，避免留下没有过期时间的负数计数
+var revertLoginFailure = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// RevertLoginFailure 撤销一次RecordLoginFailure，用于预占了计数但最终没有失败的尝试
+func (r *RedisDB) RevertLoginFailure(ctx context.Context, subject string) error {
+	return revertLoginFailure.Run(ctx, r.client, []string{loginFailuresKey(subject)}).Err()
+}
+
+// LockLogin 在duration内拒绝subject的登录请求
+func (r *RedisDB) LockLogin(ctx context.Context, subject string, duration time.Duration) error {
+	return r.client.Set(ctx, loginLockKey(subject), 1, duration).Err()
+}
+
+// TryLockLogin 未锁定时锁定duration并返回true，已锁定时不做处理并返回false
+func (r *RedisDB) TryLockLogin(ctx context.Context, subject string, duration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, loginLockKey(subject), 1, duration).Result()
+}
+
+// UnlockLogin 解除锁定，保留失败计数
+func (r *RedisDB) UnlockLogin(ctx context.Context, subject string) error {
+	return r.client.Del(ctx, loginLockKey(subject)).Err()
+}
+
+// LoginLockRemaining 返回多个subject中最长的剩余锁定时间，均未锁定时返回0
+func (r *RedisDB) LoginLockRemaining(ctx context.Context, subjects ...string) (time.Duration, error) {
+	cmds := make([]*redis.DurationCmd, len(subjects))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, subject := range subjects {
+			cmds[i] = pipe.PTTL(ctx, loginLockKey(subject))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// 键不存在时PTTL返回负值
+	var remaining time.Duration
+	for _, cmd := range cmds {
+		if ttl := cmd.Val(); ttl > remaining {
+			remaining = ttl
+		}
+	}
+	return remaining, nil
+}
+
+// ClearLoginFailures 清除subject的失败计数和锁定
+func (r *RedisDB) ClearLoginFailures(ctx context.Context, subject string) error {
+	return r.client.Del(ctx, loginFailuresKey(subject), loginLockKey(subject)).Err()
+}
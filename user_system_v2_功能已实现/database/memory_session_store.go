@@ -0,0 +1,472 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"user_system_v1/models"
+)
+
+// memoryItem 带过期时间的值，expiresAt为零值表示不过期
+type memoryItem struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// MemorySessionStore SessionStore的内存实现，用于测试和本地开发。
+// 与RedisDB使用相同的键，过期的键在访问时惰性删除
+type MemorySessionStore struct {
+	mu    sync.Mutex
+	items map[string]*memoryItem
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		items: make(map[string]*memoryItem),
+	}
+}
+
+// 以下辅助方法需在持有锁时调用
+
+func (m *MemorySessionStore) get(key string) (interface{}, bool) {
+	item, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !item.expiresAt.IsZero() && !time.Now().Before(item.expiresAt) {
+		delete(m.items, key)
+		return nil, false
+	}
+	return item.value, true
+}
+
+// set 写入值，expiration为0时不过期，与Redis的SET一致
+func (m *MemorySessionStore) set(key string, value interface{}, expiration time.Duration) {
+	item := &memoryItem{value: value}
+	if expiration > 0 {
+		item.expiresAt = time.Now().Add(expiration)
+	}
+	m.items[key] = item
+}
+
+func (m *MemorySessionStore) expire(key string, expiration time.Duration) {
+	if _, ok := m.get(key); ok {
+		m.items[key].expiresAt = time.Now().Add(expiration)
+	}
+}
+
+func (m *MemorySessionStore) ttl(key string) time.Duration {
+	if _, ok := m.get(key); !ok {
+		return 0
+	}
+	if expiresAt := m.items[key].expiresAt; !expiresAt.IsZero() {
+		return time.Until(expiresAt)
+	}
+	return 0
+}
+
+// incr 计数加一并刷新过期时间，对应RecordLoginFailure等使用的INCR + EXPIRE
+func (m *MemorySessionStore) incr(key string, expiration time.Duration) int64 {
+	count, _ := m.get(key)
+	n, _ := count.(int64)
+	n++
+	m.set(key, n, expiration)
+	return n
+}
+
+// setNX 键不存在时写入并返回true
+func (m *MemorySessionStore) setNX(key string, value interface{}, expiration time.Duration) bool {
+	if _, ok := m.get(key); ok {
+		return false
+	}
+	m.set(key, value, expiration)
+	return true
+}
+
+func (m *MemorySessionStore) del(keys ...string) int {
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := m.get(key); ok {
+			delete(m.items, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// userSessionIDs 返回用户Session索引，不存在时创建
+func (m *MemorySessionStore) userSessionIDs(userID int64, expiration time.Duration) map[string]bool {
+	if value, ok := m.get(userSessionsKey(userID)); ok {
+		m.expire(userSessionsKey(userID), expiration)
+		return value.(map[string]bool)
+	}
+	ids := make(map[string]bool)
+	m.set(userSessionsKey(userID), ids, expiration)
+	return ids
+}
+
+func (m *MemorySessionStore) StoreSession(ctx context.Context, token string, session *models.Session, expiration time.Duration) error {
+	session.ID = HashSessionToken(token)
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(sessionKey(session.ID), *session, expiration)
+	m.userSessionIDs(session.UserID, expiration)[session.ID] = true
+	return nil
+}
+
+func (m *MemorySessionStore) GetSession(ctx context.Context, token string) (*models.Session, error) {
+	return m.GetSessionByID(ctx, HashSessionToken(token))
+}
+
+func (m *MemorySessionStore) GetSessionByID(ctx context.Context, sessionID string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(sessionKey(sessionID))
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	session := value.(models.Session)
+	return &session, nil
+}
+
+func (m *MemorySessionStore) DeleteSession(ctx context.Context, token string) error {
+	session, err := m.GetSession(ctx, token)
+	if err != nil {
+		if err == ErrSessionNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return m.DeleteSessionByID(ctx, session.UserID, session.ID)
+}
+
+func (m *MemorySessionStore) DeleteSessionByID(ctx context.Context, userID int64, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(userSessionsKey(userID))
+	if !ok || !value.(map[string]bool)[sessionID] {
+		return ErrSessionNotFound
+	}
+
+	delete(value.(map[string]bool), sessionID)
+	m.del(sessionKey(sessionID))
+	m.set(revokedSessionKey(sessionID), true, 0)
+	return nil
+}
+
+func (m *MemorySessionStore) DeleteUserSessions(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if value, ok := m.get(userSessionsKey(userID)); ok {
+		for id := range value.(map[string]bool) {
+			m.del(sessionKey(id))
+			m.set(revokedSessionKey(id), true, 0)
+		}
+	}
+	m.del(userSessionsKey(userID))
+	return nil
+}
+
+// IsSessionRevoked 内存实现中注销标记不过期，会话ID是随机值，不会被误判
+func (m *MemorySessionStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.get(revokedSessionKey(sessionID))
+	return ok, nil
+}
+
+func (m *MemorySessionStore) ListSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(userSessionsKey(userID))
+	if !ok {
+		return nil, nil
+	}
+
+	ids := value.(map[string]bool)
+	var sessions []*models.Session
+	for id := range ids {
+		value, ok := m.get(sessionKey(id))
+		if !ok {
+			delete(ids, id)
+			continue
+		}
+		session := value.(models.Session)
+		sessions = append(sessions, &session)
+	}
+	return sessions, nil
+}
+
+func (m *MemorySessionStore) RefreshSession(ctx context.Context, session *models.Session, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(sessionKey(session.ID), expiration)
+	m.expire(userSessionsKey(session.UserID), expiration)
+	return nil
+}
+
+func (m *MemorySessionStore) SessionExists(ctx context.Context, token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.get(sessionKey(HashSessionToken(token)))
+	return ok, nil
+}
+
+func (m *MemorySessionStore) RecordLoginFailure(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.incr(loginFailuresKey(subject), window), nil
+}
+
+func (m *MemorySessionStore) RevertLoginFailure(ctx context.Context, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if count, ok := m.get(loginFailuresKey(subject)); ok && count.(int64) > 0 {
+		m.items[loginFailuresKey(subject)].value = count.(int64) - 1
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) LockLogin(ctx context.Context, subject string, duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(loginLockKey(subject), true, duration)
+	return nil
+}
+
+func (m *MemorySessionStore) TryLockLogin(ctx context.Context, subject string, duration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setNX(loginLockKey(subject), true, duration), nil
+}
+
+func (m *MemorySessionStore) UnlockLogin(ctx context.Context, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.del(loginLockKey(subject))
+	return nil
+}
+
+func (m *MemorySessionStore) LoginLockRemaining(ctx context.Context, subjects ...string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var remaining time.Duration
+	for _, subject := range subjects {
+		if ttl := m.ttl(loginLockKey(subject)); ttl > remaining {
+			remaining = ttl
+		}
+	}
+	return remaining, nil
+}
+
+func (m *MemorySessionStore) ClearLoginFailures(ctx context.Context, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.del(loginFailuresKey(subject), loginLockKey(subject))
+	return nil
+}
+
+func (m *MemorySessionStore) StoreLoginChallenge(ctx context.Context, token string, challenge *models.LoginChallenge, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(loginChallengeKey(token), *challenge, expiration)
+	return nil
+}
+
+func (m *MemorySessionStore) GetLoginChallenge(ctx context.Context, token string) (*models.LoginChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(loginChallengeKey(token))
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
+	challenge := value.(models.LoginChallenge)
+	return &challenge, nil
+}
+
+func (m *MemorySessionStore) IncrLoginChallengeAttempts(ctx context.Context, token string, expiration time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.incr(loginChallengeAttemptsKey(token), expiration), nil
+}
+
+func (m *MemorySessionStore) DeleteLoginChallenge(ctx context.Context, token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.del(loginChallengeKey(token), loginChallengeAttemptsKey(token)) > 0, nil
+}
+
+func (m *MemorySessionStore) StorePendingTOTPSecret(ctx context.Context, userID int64, secret string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(pendingTOTPKey(userID), secret, expiration)
+	return nil
+}
+
+func (m *MemorySessionStore) GetPendingTOTPSecret(ctx context.Context, userID int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(pendingTOTPKey(userID))
+	if !ok {
+		return "", ErrNoPendingTOTP
+	}
+	return value.(string), nil
+}
+
+func (m *MemorySessionStore) DeletePendingTOTPSecret(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.del(pendingTOTPKey(userID))
+	return nil
+}
+
+func (m *MemorySessionStore) MarkTOTPStepUsed(ctx context.Context, userID int64, step int64, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setNX(fmt.Sprintf("totp_used:%d:%d", userID, step), true, expiration), nil
+}
+
+func (m *MemorySessionStore) StorePasswordResetToken(ctx context.Context, token string, userID int64, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(passwordResetKey(token), userID, expiration)
+	return nil
+}
+
+func (m *MemorySessionStore) GetPasswordResetToken(ctx context.Context, token string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(passwordResetKey(token))
+	if !ok {
+		return 0, ErrResetTokenInvalid
+	}
+	return value.(int64), nil
+}
+
+func (m *MemorySessionStore) ConsumePasswordResetToken(ctx context.Context, token string, userID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if value, ok := m.get(passwordResetKey(token)); !ok || value.(int64) != userID {
+		return false, nil
+	}
+	m.del(passwordResetKey(token))
+	return true, nil
+}
+
+func (m *MemorySessionStore) AcquirePasswordResetCooldown(ctx context.Context, userID int64, cooldown time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setNX(passwordResetCooldownKey(userID), true, cooldown), nil
+}
+
+func (m *MemorySessionStore) StoreRefreshToken(ctx context.Context, token string, refresh *models.RefreshToken, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(refreshTokenKey(token), *refresh, expiration)
+	return nil
+}
+
+func (m *MemorySessionStore) ConsumeRefreshToken(ctx context.Context, token string, expiration time.Duration) (*models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(refreshTokenKey(token))
+	if !ok {
+		value, ok = m.get(usedRefreshTokenKey(token))
+		if !ok {
+			return nil, ErrRefreshTokenInvalid
+		}
+		refresh := value.(models.RefreshToken)
+		return &refresh, ErrRefreshTokenReused
+	}
+
+	m.del(refreshTokenKey(token))
+	m.set(usedRefreshTokenKey(token), value, expiration)
+	refresh := value.(models.RefreshToken)
+	return &refresh, nil
+}
+
+func (m *MemorySessionStore) GetCachedUser(ctx context.Context, userID int64) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.get(profileCacheKey(userID))
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	user := value.(models.User)
+	return &user, nil
+}
+
+func (m *MemorySessionStore) CachedUserVersion(ctx context.Context, userID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	version, _ := m.get(profileVersionKey(userID))
+	n, _ := version.(int64)
+	return n, nil
+}
+
+// CacheUser 与RedisDB一样不缓存密码哈希
+func (m *MemorySessionStore) CacheUser(ctx context.Context, user *models.User, version int64, ttl, jitter time.Duration) (bool, error) {
+	if jitter > 0 {
+		ttl += time.Duration(rand.Int63n(int64(jitter)))
+	}
+
+	cached := *user
+	cached.PasswordHash = ""
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, _ := m.get(profileVersionKey(user.ID))
+	if n, _ := current.(int64); n != version {
+		return false, nil
+	}
+	return m.setNX(profileCacheKey(user.ID), cached, ttl), nil
+}
+
+func (m *MemorySessionStore) InvalidateCachedUser(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.del(profileCacheKey(userID))
+	m.incr(profileVersionKey(userID), profileVersionTTL)
+	return nil
+}
@@ -0,0 +1,353 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"user_system_v1/auth"
+	"user_system_v1/models"
+)
+
+// MemoryUserStore UserStore的内存实现，用于测试和本地开发，行为与MySQLDB保持一致：
+// 用户名不区分大小写唯一，不存在的用户返回sql.ErrNoRows
+type MemoryUserStore struct {
+	mu            sync.RWMutex
+	nextID        int64
+	users         map[int64]*models.User
+	usernames     map[string]int64 // 小写用户名 -> ID
+	totpSecrets   map[int64]string
+	recoveryCodes map[int64]map[string]bool // 恢复码哈希 -> 是否已使用
+	userRoles     map[int64][]string
+	roles         map[string][]string // 角色 -> 权限
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	roles := make(map[string][]string, len(models.DefaultRolePermissions))
+	for role, permissions := range models.DefaultRolePermissions {
+		roles[role] = append([]string(nil), permissions...)
+	}
+
+	return &MemoryUserStore{
+		users:         make(map[int64]*models.User),
+		usernames:     make(map[string]int64),
+		totpSecrets:   make(map[int64]string),
+		recoveryCodes: make(map[int64]map[string]bool),
+		userRoles:     make(map[int64][]string),
+		roles:         roles,
+	}
+}
+
+// 返回副本，避免调用方修改存储中的数据
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	return &copied
+}
+
+func (m *MemoryUserStore) CreateUser(ctx context.Context, username, password, nickname string, hasher auth.PasswordHasher) (*models.User, error) {
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := ValidatePassword(password); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if nickname == "" {
+		nickname = username
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := strings.ToLower(username)
+	if _, exists := m.usernames[key]; exists {
+		return nil, ErrUsernameTaken
+	}
+
+	m.nextID++
+	now := time.Now()
+	user := &models.User{
+		ID:           m.nextID,
+		Username:     username,
+		PasswordHash: passwordHash,
+		Nickname:     nickname,
+		Status:       models.UserStatusActive,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	m.users[user.ID] = user
+	m.usernames[key] = user.ID
+
+	return copyUser(user), nil
+}
+
+func (m *MemoryUserStore) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyUser(user), nil
+}
+
+func (m *MemoryUserStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.usernames[strings.ToLower(username)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyUser(m.users[id]), nil
+}
+
+// 与MySQL的UPDATE一致，用户不存在时不报错
+func (m *MemoryUserStore) UpdateUser(ctx context.Context, id int64, nickname, profilePic string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[id]; ok {
+		user.Nickname = nickname
+		user.ProfilePic = profilePic
+		user.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryUserStore) UpdatePasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[id]; ok {
+		user.PasswordHash = passwordHash
+	}
+	return nil
+}
+
+func (m *MemoryUserStore) SetPassword(ctx context.Context, id int64, password string, hasher auth.PasswordHasher) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+
+	passwordHash, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return m.UpdatePasswordHash(ctx, id, passwordHash)
+}
+
+// ListUsers 匹配规则、排列顺序和游标与MySQLDB.ListUsers相同，不区分大小写
+func (m *MemoryUserStore) ListUsers(ctx context.Context, query, match string, after UserCursor, limit int) ([]*models.User, *UserCursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	contains := match == models.UserMatchContains && utf8.RuneCountInString(query) >= minContainsQueryLen
+	matches := func(s string) bool {
+		s = strings.ToLower(s)
+		if contains {
+			return strings.Contains(s, query)
+		}
+		return strings.HasPrefix(s, query)
+	}
+
+	if query == "" || contains {
+		var users []*models.User
+		for _, user := range m.users {
+			if user.ID <= after.ID {
+				continue
+			}
+			if query != "" && !matches(user.Username) && !matches(user.Nickname) {
+				continue
+			}
+			users = append(users, copyUser(user))
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+		return pageByID(users, limit)
+	}
+
+	// 前缀搜索：用户名匹配的一段按(用户名, ID)排列，只有昵称匹配的一段按(昵称, ID)排列
+	var byUsername, byNickname []*models.User
+	for _, user := range m.users {
+		switch {
+		case matches(user.Username):
+			byUsername = append(byUsername, copyUser(user))
+		case matches(user.Nickname):
+			byNickname = append(byNickname, copyUser(user))
+		}
+	}
+	sortUsersBy(byUsername, func(u *models.User) string { return u.Username })
+	sortUsersBy(byNickname, func(u *models.User) string { return u.Nickname })
+
+	afterKey := func(users []*models.User, key func(*models.User) string) []*models.User {
+		cursorKey := strings.ToLower(after.Key)
+		for i, user := range users {
+			k := strings.ToLower(key(user))
+			if k > cursorKey || (k == cursorKey && user.ID > after.ID) {
+				return users[i:]
+			}
+		}
+		return nil
+	}
+	switch after.Field {
+	case UserCursorUsername:
+		byUsername = afterKey(byUsername, func(u *models.User) string { return u.Username })
+	case UserCursorNickname:
+		byUsername = nil
+		byNickname = afterKey(byNickname, func(u *models.User) string { return u.Nickname })
+	}
+	return pageByPrefix(append(byUsername, byNickname...), len(byUsername), limit)
+}
+
+// sortUsersBy 按key（不区分大小写）和ID排序
+func sortUsersBy(users []*models.User, key func(*models.User) string) {
+	sort.Slice(users, func(i, j int) bool {
+		ki, kj := strings.ToLower(key(users[i])), strings.ToLower(key(users[j]))
+		if ki != kj {
+			return ki < kj
+		}
+		return users[i].ID < users[j].ID
+	})
+}
+
+func (m *MemoryUserStore) GetTOTPSecret(ctx context.Context, userID int64) (string, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	secret, ok := m.totpSecrets[userID]
+	return secret, ok, nil
+}
+
+func (m *MemoryUserStore) EnableTOTP(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+	m.totpSecrets[userID] = secret
+	m.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (m *MemoryUserStore) DisableTOTP(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.totpSecrets, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *MemoryUserStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[userID][codeHash] = true
+	return true, nil
+}
+
+func (m *MemoryUserStore) GetUserRoles(ctx context.Context, userID int64) ([]string, []string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roles := append([]string(nil), m.userRoles[userID]...)
+	seen := make(map[string]bool)
+	var permissions []string
+	for _, role := range roles {
+		for _, permission := range m.roles[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return roles, permissions, nil
+}
+
+func (m *MemoryUserStore) GetRolesForUsers(ctx context.Context, userIDs []int64) (map[int64][]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[int64][]string, len(userIDs))
+	for _, id := range userIDs {
+		if roles := m.userRoles[id]; len(roles) > 0 {
+			result[id] = append([]string(nil), roles...)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryUserStore) SetUserRoles(ctx context.Context, userID int64, roles []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]bool, len(roles))
+	var assigned []string
+	for _, role := range roles {
+		if seen[role] {
+			continue
+		}
+		seen[role] = true
+		if _, ok := m.roles[role]; !ok {
+			return ErrUnknownRole
+		}
+		assigned = append(assigned, role)
+	}
+	sort.Strings(assigned)
+
+	m.userRoles[userID] = assigned
+	return nil
+}
+
+// 用户或角色不存在时忽略，与MySQLDB一致
+func (m *MemoryUserStore) GrantRoleByUsername(ctx context.Context, username, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.usernames[strings.ToLower(username)]
+	if !ok {
+		return nil
+	}
+	if _, ok := m.roles[role]; !ok {
+		return nil
+	}
+	for _, r := range m.userRoles[id] {
+		if r == role {
+			return nil
+		}
+	}
+	m.userRoles[id] = append(m.userRoles[id], role)
+	sort.Strings(m.userRoles[id])
+	return nil
+}
+
+func (m *MemoryUserStore) SetUserStatus(ctx context.Context, userID int64, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Status = status
+	return nil
+}
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 迁移文件命名为 <版本号>_<名称>.up.sql 和 <版本号>_<名称>.down.sql，按版本号顺序执行。
+// 已发布的迁移文件不能再修改，修改表结构需要新增迁移
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrUnknownMigration = errors.New("database has a migration unknown to this build")
+	ErrIrreversible     = errors.New("migration has no down script")
+)
+
+const (
+	// migrationLockName 多个实例同时启动时只有一个执行迁移
+	migrationLockName    = "user_system.schema_migrations"
+	migrationLockTimeout = 300 // 秒
+)
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration 一个版本的表结构变更
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // up脚本的SHA-256，用于发现已执行的迁移被改动
+}
+
+// MigrationStatus 迁移及其在数据库中的执行情况
+type MigrationStatus struct {
+	*Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// appliedMigration schema_migrations中的一行
+type appliedMigration struct {
+	version   int64
+	checksum  string
+	appliedAt time.Time
+}
+
+// LoadMigrations 读取内嵌的迁移文件并按版本号排序
+func LoadMigrations() ([]*Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements 按行尾的分号拆分语句并去掉分号，跳过 -- 注释行。
+// 驱动默认不允许一次执行多条语句，迁移脚本中的字符串不能包含行尾分号
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(current.String()), ";")
+			statements = append(statements, statement)
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Migrate 执行所有未执行的迁移，服务启动时调用
+func (m *MySQLDB) Migrate() ([]*Migration, error) {
+	return m.MigrateUp(0)
+}
+
+// MigrateUp 依次执行版本号不超过target的未执行迁移，target为0表示全部。
+// MySQL的DDL会隐式提交，迁移中途失败时已执行的语句不会回滚，需要人工处理后重试
+func (m *MySQLDB) MigrateUp(target int64) ([]*Migration, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var executed []*Migration
+	err = m.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := verifyMigrations(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if target > 0 && migration.Version > target {
+				break
+			}
+
+			slog.Info("Applying migration", "version", migration.Version, "name", migration.Name)
+			if err := execScript(ctx, conn, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`,
+				migration.Version, migration.Name, migration.Checksum); err != nil {
+				return err
+			}
+			executed = append(executed, migration)
+		}
+		return nil
+	})
+	return executed, err
+}
+
+// MigrateDown 按版本号从大到小回滚最近执行的steps个迁移
+func (m *MySQLDB) MigrateDown(steps int) ([]*Migration, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []*Migration
+	err = m.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := verifyMigrations(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrIrreversible, migration.Version, migration.Name)
+			}
+
+			slog.Info("Reverting migration", "version", migration.Version, "name", migration.Name)
+			if err := execScript(ctx, conn, migration.Down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus 列出所有迁移及其执行情况，同时校验已执行迁移的checksum
+func (m *MySQLDB) MigrationStatus() ([]*MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []*MigrationStatus
+	err = m.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := verifyMigrations(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			row, ok := applied[migration.Version]
+			statuses = append(statuses, &MigrationStatus{Migration: migration, Applied: ok, AppliedAt: row.appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withMigrationLock 在持有MySQL命名锁的连接上执行fn，并确保schema_migrations表存在
+func (m *MySQLDB) withMigrationLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// 命名锁属于连接，必须在同一连接上加锁和释放
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, migrationLockName, migrationLockTimeout).Scan(&locked); err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return errors.New("timed out waiting for migration lock")
+	}
+	defer conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, migrationLockName)
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return err
+	}
+
+	return fn(ctx, conn)
+}
+
+// verifyMigrations 读取已执行的迁移，并确认它们与当前版本内嵌的迁移文件一致
+func verifyMigrations(ctx context.Context, conn *sql.Conn, migrations []*Migration) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var row appliedMigration
+		if err := rows.Scan(&row.version, &row.checksum, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[row.version] = row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]*Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+	for version, row := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+		}
+		if row.checksum != migration.Checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, migration.Version, migration.Name)
+		}
+	}
+	return applied, nil
+}
+
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
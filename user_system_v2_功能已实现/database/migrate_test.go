@@ -0,0 +1,55 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: versions should be consecutive from 1", migration.Version, migration.Name)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+		if len(migration.Checksum) != 64 {
+			t.Errorf("migration %d_%s: bad checksum %q", migration.Version, migration.Name, migration.Checksum)
+		}
+		if len(splitStatements(migration.Up)) == 0 {
+			t.Errorf("migration %d_%s: empty up script", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- 注释
+CREATE TABLE a (
+	id BIGINT
+);
+
+INSERT INTO a VALUES (1), (2);
+DROP TABLE b`
+
+	statements := splitStatements(script)
+	want := []string{
+		"CREATE TABLE a (\n\tid BIGINT\n)",
+		"INSERT INTO a VALUES (1), (2)",
+		"DROP TABLE b",
+	}
+	if len(statements) != len(want) {
+		t.Fatalf("got %d statements: %q", len(statements), statements)
+	}
+	for i := range want {
+		if statements[i] != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, statements[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,36 @@
+ALTER TABLE users ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active' AFTER profile_pic;
+
+CREATE TABLE roles (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(50) UNIQUE NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE permissions (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) UNIQUE NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE role_permissions (
+	role_id BIGINT NOT NULL,
+	permission_id BIGINT NOT NULL,
+	PRIMARY KEY (role_id, permission_id),
+	FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+	FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE user_roles (
+	user_id BIGINT NOT NULL,
+	role_id BIGINT NOT NULL,
+	PRIMARY KEY (user_id, role_id),
+	INDEX idx_role (role_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 内置角色，与models.DefaultRolePermissions一致
+INSERT INTO roles (name) VALUES ('admin'), ('support');
+INSERT INTO permissions (name) VALUES ('users:read'), ('users:write');
+INSERT INTO role_permissions (role_id, permission_id)
+	SELECT r.id, p.id FROM roles r JOIN permissions p
+	WHERE (r.name = 'admin' AND p.name IN ('users:read', 'users:write'))
+	   OR (r.name = 'support' AND p.name = 'users:read');
@@ -0,0 +1,3 @@
+-- 用户搜索所需的索引，大表上耗时较长
+ALTER TABLE users ADD INDEX idx_nickname (nickname);
+ALTER TABLE users ADD FULLTEXT INDEX ft_users_search (username, nickname) WITH PARSER ngram;
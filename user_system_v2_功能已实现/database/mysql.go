@@ -1,19 +1,21 @@
 package database
 
 import (
-	"crypto/sha256"
+	"context"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 	
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"user_system_v1/auth"
 	"user_system_v1/config"
 	"user_system_v1/models"
 )
 
 type MySQLDB struct {
-	db *sql.DB
+	db tracedDB
 }
 
 func NewMySQLDB(cfg *config.Config) (*MySQLDB, error) {
@@ -31,54 +33,49 @@ func NewMySQLDB(cfg *config.Config) (*MySQLDB, error) {
 	}
 	
 	// 设置连接池参数
-	db.SetMaxOpenConns(100)
-	db.SetMaxIdleConns(10)
-	db.SetConnMaxLifetime(time.Hour)
+	db.SetMaxOpenConns(cfg.MySQLMaxOpenConns)
+	db.SetMaxIdleConns(cfg.MySQLMaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.MySQLConnMaxLifetime) * time.Second)
 	
 	// 测试连接
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
 	
-	return &MySQLDB{db: db}, nil
+	return &MySQLDB{db: tracedDB{db}}, nil
 }
 
 func (m *MySQLDB) Close() error {
 	return m.db.Close()
 }
 
-// 创建用户表
-func (m *MySQLDB) CreateTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id BIGINT AUTO_INCREMENT PRIMARY KEY,
-		username VARCHAR(50) UNIQUE NOT NULL,
-		password_hash VARCHAR(255) NOT NULL,
-		nickname VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci,
-		profile_pic TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		INDEX idx_username (username),
-		INDEX idx_id (id)
-	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
-	`
-	
-	_, err := m.db.Exec(query)
-	return err
+// Ping 检查MySQL是否可用，用于就绪检查
+func (m *MySQLDB) Ping(ctx context.Context) error {
+	return m.db.PingContext(ctx)
 }
 
-// 根据用户名获取用户
-func (m *MySQLDB) GetUserByUsername(username string) (*models.User, error) {
-	query := `SELECT id, username, password_hash, nickname, profile_pic, created_at, updated_at 
-			  FROM users WHERE username = ?`
-	
+// Stats 连接池状态，用于监控
+func (m *MySQLDB) Stats() sql.DBStats {
+	return m.db.Stats()
+}
+
+// userColumns 与scanUser的字段顺序一致
+const userColumns = `id, username, password_hash, nickname, profile_pic, status, created_at, updated_at`
+
+// rowScanner 兼容*sql.Row和*sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
 	var user models.User
-	err := m.db.QueryRow(query, username).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.Username,
 		&user.PasswordHash,
 		&user.Nickname,
 		&user.ProfilePic,
+		&user.Status,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -90,40 +87,91 @@ func (m *MySQLDB) GetUserByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+// 根据用户名获取用户
+func (m *MySQLDB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	
+	return scanUser(m.db.QueryRowContext(ctx, query, username))
+}
+
 // 根据ID获取用户
-func (m *MySQLDB) GetUserByID(id int64) (*models.User, error) {
-	query := `SELECT id, username, password_hash, nickname, profile_pic, created_at, updated_at 
-			  FROM users WHERE id = ?`
+func (m *MySQLDB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
 	
-	var user models.User
-	err := m.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.Nickname,
-		&user.ProfilePic,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	return scanUser(m.db.QueryRowContext(ctx, query, id))
+}
+
+// 创建用户（注册）
+func (m *MySQLDB) CreateUser(ctx context.Context, username, password, nickname string, hasher auth.PasswordHasher) (*models.User, error) {
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := ValidatePassword(password); err != nil {
+		return nil, err
+	}
 	
+	passwordHash, err := hasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
 	
-	return &user, nil
+	if nickname == "" {
+		nickname = username
+	}
+	
+	query := `INSERT INTO users (username, password_hash, nickname, profile_pic) VALUES (?, ?, ?, '')`
+	
+	result, err := m.db.ExecContext(ctx, query, username, passwordHash, nickname)
+	if err != nil {
+		// 用户名唯一约束冲突
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+	
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	
+	return m.GetUserByID(ctx, id)
 }
 
 // 更新用户信息
-func (m *MySQLDB) UpdateUser(id int64, nickname, profilePic string) error {
+func (m *MySQLDB) UpdateUser(ctx context.Context, id int64, nickname, profilePic string) error {
 	query := `UPDATE users SET nickname = ?, profile_pic = ?, updated_at = CURRENT_TIMESTAMP 
 			  WHERE id = ?`
 	
-	_, err := m.db.Exec(query, nickname, profilePic, id)
+	_, err := m.db.ExecContext(ctx, query, nickname, profilePic, id)
+	return err
+}
+
+// 更新用户密码哈希
+func (m *MySQLDB) UpdatePasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	query := `UPDATE users SET password_hash = ? WHERE id = ?`
+	
+	_, err := m.db.ExecContext(ctx, query, passwordHash, id)
 	return err
 }
 
+// SetPassword 校验密码强度后保存新密码
+func (m *MySQLDB) SetPassword(ctx context.Context, id int64, password string, hasher auth.PasswordHasher) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	
+	passwordHash, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	
+	return m.UpdatePasswordHash(ctx, id, passwordHash)
+}
+
 // 批量插入测试用户数据
-func (m *MySQLDB) InsertTestUsers(count int) error {
+func (m *MySQLDB) InsertTestUsers(count int, hasher auth.PasswordHasher) error {
 	// 优化MySQL配置
 	_, err := m.db.Exec("SET autocommit = 0")
 	if err != nil {
@@ -160,11 +208,12 @@ func (m *MySQLDB) InsertTestUsers(count int) error {
 	// 批量插入，增加批次大小
 	batchSize := 10000 // 增加到10000条一批
 	
-	// 生成正确的密码哈希
-	password := "password"
-	passwordHash := ""
-	hash := sha256.Sum256([]byte(password))
-	passwordHash = hex.EncodeToString(hash[:])
+	// 生成密码哈希
+	// 千万级数据无法逐条计算慢哈希，测试用户共用同一个哈希值（同一个盐）
+	passwordHash, err := hasher.Hash("password")
+	if err != nil {
+		return err
+	}
 	
 	for i := 1; i <= count; i++ {
 		username := fmt.Sprintf("user_%d", i)
@@ -194,7 +243,7 @@ func (m *MySQLDB) InsertTestUsers(count int) error {
 			}
 			
 			// 打印进度
-			fmt.Printf("Inserted %d users...\n", i)
+			slog.Info("Inserting test users", "inserted", i)
 		}
 	}
 	
@@ -231,33 +280,18 @@ func (m *MySQLDB) GetUserCount() (int, error) {
 
 // 随机获取用户（用于性能测试）
 func (m *MySQLDB) GetRandomUser() (*models.User, error) {
-	query := `SELECT id, username, password_hash, nickname, profile_pic, created_at, updated_at 
-			  FROM users ORDER BY RAND() LIMIT 1`
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY RAND() LIMIT 1`
 	
-	var user models.User
-	err := m.db.QueryRow(query).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.Nickname,
-		&user.ProfilePic,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	
-	if err != nil {
-		return nil, err
-	}
-	
-	return &user, nil
+	return scanUser(m.db.QueryRow(query))
 }
 
 // 更新密码哈希
-func (m *MySQLDB) UpdatePasswordHashes() error {
+func (m *MySQLDB) UpdatePasswordHashes(hasher auth.PasswordHasher) error {
 	// 生成正确的密码哈希
-	password := "password"
-	hash := sha256.Sum256([]byte(password))
-	passwordHash := hex.EncodeToString(hash[:])
+	passwordHash, err := hasher.Hash("password")
+	if err != nil {
+		return err
+	}
 	
 	// 更新所有用户的密码哈希
 	query := `UPDATE users SET password_hash = ? WHERE password_hash LIKE 'hash_%'`
@@ -273,7 +307,7 @@ func (m *MySQLDB) UpdatePasswordHashes() error {
 	}
 	
 	if rowsAffected > 0 {
-		fmt.Printf("Updated %d user password hashes\n", rowsAffected)
+		slog.Info("Updated user password hashes", "count", rowsAffected)
 	}
 	
 	return nil
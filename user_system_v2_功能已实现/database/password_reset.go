@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrResetTokenInvalid = errors.New("password reset token invalid or expired")
+
+// 重置Token同样只保存哈希
+func passwordResetKey(token string) string {
+	return "password_reset:" + HashSessionToken(token)
+}
+
+func passwordResetCooldownKey(userID int64) string {
+	return fmt.Sprintf("password_reset_cooldown:%d", userID)
+}
+
+// StorePasswordResetToken 保存密码重置Token
+func (r *RedisDB) StorePasswordResetToken(ctx context.Context, token string, userID int64, expiration time.Duration) error {
+	return r.client.Set(ctx, passwordResetKey(token), userID, expiration).Err()
+}
+
+// GetPasswordResetToken 返回重置Token对应的用户ID，不删除Token，
+// 密码修改成功后再调用ConsumePasswordResetToken，中途出错时Token仍然可用
+func (r *RedisDB) GetPasswordResetToken(ctx context.Context, token string) (int64, error) {
+	value, err := r.client.Get(ctx, passwordResetKey(token)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, ErrResetTokenInvalid
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// consumePasswordResetToken Token仍属于该用户时删除
+var consumePasswordResetToken = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// ConsumePasswordResetToken 删除重置Token，每个Token只能使用一次；
+// 返回false表示Token已被并发的请求使用或已过期
+func (r *RedisDB) ConsumePasswordResetToken(ctx context.Context, token string, userID int64) (bool, error) {
+	deleted, err := consumePasswordResetToken.Run(ctx, r.client, []string{passwordResetKey(token)}, userID).Int()
+	return deleted == 1, err
+}
+
+// AcquirePasswordResetCooldown 限制同一用户申请重置的频率，冷却期内返回false
+func (r *RedisDB) AcquirePasswordResetCooldown(ctx context.Context, userID int64, cooldown time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, passwordResetCooldownKey(userID), 1, cooldown).Result()
+}
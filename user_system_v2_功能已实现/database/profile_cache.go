@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"user_system_v1/models"
+)
+
+var ErrCacheMiss = errors.New("cache miss")
+
+func profileCacheKey(userID int64) string {
+	return fmt.Sprintf("user_profile:%d", userID)
+}
+
+// 用户资料的版本号，每次修改资料时加一。回源前读取版本号，写回缓存时版本号已变化
+// 说明回源期间资料被修改过，读到的可能是旧数据，放弃写入
+func profileVersionKey(userID int64) string {
+	return fmt.Sprintf("user_profile_version:%d", userID)
+}
+
+// profileVersionTTL 版本号的保留时间，远大于一次回源的耗时即可
+const profileVersionTTL = time.Hour
+
+// GetCachedUser 读取缓存的用户资料，未命中时返回ErrCacheMiss。
+// 缓存中不含密码哈希，只能用于展示，不能用于登录校验
+func (r *RedisDB) GetCachedUser(ctx context.Context, userID int64) (*models.User, error) {
+	data, err := r.client.Get(ctx, profileCacheKey(userID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+
+	var user models.User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CachedUserVersion 返回用户资料的当前版本号，回源前调用，结果传给CacheUser
+func (r *RedisDB) CachedUserVersion(ctx context.Context, userID int64) (int64, error) {
+	version, err := r.client.Get(ctx, profileVersionKey(userID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, err
+}
+
+// cacheUser 版本号未变且缓存不存在时写入
+var cacheUser = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[1] then
+	return 0
+end
+if redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3], 'NX') then
+	return 1
+end
+return 0
+`)
+
+// CacheUser 把回源读到的用户资料写回缓存，过期时间在ttl基础上随机增加[0, jitter)，避免同一批缓存同时过期。
+// 只在版本号仍为version且缓存不存在时写入，返回false表示放弃写入
+func (r *RedisDB) CacheUser(ctx context.Context, user *models.User, version int64, ttl, jitter time.Duration) (bool, error) {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return false, err
+	}
+
+	if jitter > 0 {
+		ttl += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	keys := []string{profileCacheKey(user.ID), profileVersionKey(user.ID)}
+	written, err := cacheUser.Run(ctx, r.client, keys, version, data, ttl.Milliseconds()).Int()
+	return written == 1, err
+}
+
+// InvalidateCachedUser 修改用户资料后删除缓存并增加版本号，正在回源的请求不会再写回旧数据
+func (r *RedisDB) InvalidateCachedUser(ctx context.Context, userID int64) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, profileCacheKey(userID))
+		pipe.Incr(ctx, profileVersionKey(userID))
+		pipe.Expire(ctx, profileVersionKey(userID), profileVersionTTL)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// GetUserRoles 返回用户的角色及这些角色拥有的权限（去重）
+func (m *MySQLDB) GetUserRoles(ctx context.Context, userID int64) (roles []string, permissions []string, err error) {
+	query := `SELECT r.name, p.name FROM user_roles ur
+			  JOIN roles r ON r.id = ur.role_id
+			  LEFT JOIN role_permissions rp ON rp.role_id = r.id
+			  LEFT JOIN permissions p ON p.id = rp.permission_id
+			  WHERE ur.user_id = ?
+			  ORDER BY r.name, p.name`
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	seenRoles := make(map[string]bool)
+	seenPermissions := make(map[string]bool)
+	for rows.Next() {
+		var role string
+		var permission sql.NullString
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, nil, err
+		}
+		if !seenRoles[role] {
+			seenRoles[role] = true
+			roles = append(roles, role)
+		}
+		if permission.Valid && !seenPermissions[permission.String] {
+			seenPermissions[permission.String] = true
+			permissions = append(permissions, permission.String)
+		}
+	}
+
+	return roles, permissions, rows.Err()
+}
+
+// GetRolesForUsers 批量查询多个用户的角色，避免列表中逐个查询
+func (m *MySQLDB) GetRolesForUsers(ctx context.Context, userIDs []int64) (map[int64][]string, error) {
+	result := make(map[int64][]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(userIDs)), ",")
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+
+	query := `SELECT ur.user_id, r.name FROM user_roles ur
+			  JOIN roles r ON r.id = ur.role_id
+			  WHERE ur.user_id IN (` + placeholders + `)
+			  ORDER BY r.name`
+
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, err
+		}
+		result[userID] = append(result[userID], role)
+	}
+
+	return result, rows.Err()
+}
+
+// SetUserRoles 用roles替换用户的全部角色，包含不存在的角色时返回ErrUnknownRole
+func (m *MySQLDB) SetUserRoles(ctx context.Context, userID int64, roles []string) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		if seen[role] {
+			continue
+		}
+		seen[role] = true
+
+		result, err := tx.ExecContext(ctx, `INSERT INTO user_roles (user_id, role_id)
+				  SELECT ?, id FROM roles WHERE name = ?`, userID, role)
+		if err != nil {
+			return err
+		}
+		// 角色不存在时SELECT没有结果，不会插入任何行
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUnknownRole
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GrantRoleByUsername 为指定用户名授予角色，用于按配置初始化管理员
+func (m *MySQLDB) GrantRoleByUsername(ctx context.Context, username, role string) error {
+	query := `INSERT IGNORE INTO user_roles (user_id, role_id)
+			  SELECT u.id, r.id FROM users u, roles r WHERE u.username = ? AND r.name = ?`
+
+	_, err := m.db.ExecContext(ctx, query, username, role)
+	return err
+}
+
+// SetUserStatus 修改用户状态
+func (m *MySQLDB) SetUserStatus(ctx context.Context, userID int64, status string) error {
+	result, err := m.db.ExecContext(ctx, `UPDATE users SET status = ? WHERE id = ?`, status, userID)
+	if err != nil {
+		return err
+	}
+
+	// 状态未变化时RowsAffected同样为0，这里只关心用户是否存在
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		if _, err := m.GetUserByID(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
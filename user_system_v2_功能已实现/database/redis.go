@@ -2,17 +2,25 @@ package database
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 	
 	"github.com/go-redis/redis/v8"
 	"user_system_v1/config"
+	"user_system_v1/models"
 )
 
 type RedisDB struct {
 	client *redis.Client
-	ctx    context.Context
+	
+	// JWT模式下访问令牌的有效期，注销会话时按此保留会话ID，为0时不记录
+	revokedSessionTTL time.Duration
 }
 
 func NewRedisDB(cfg *config.Config) (*RedisDB, error) {
@@ -20,7 +28,7 @@ func NewRedisDB(cfg *config.Config) (*RedisDB, error) {
 		Addr:     fmt.Sprintf("%s:%s", cfg.RedisHost, cfg.RedisPort),
 		Password: cfg.RedisPassword,
 		DB:       cfg.RedisDB,
-		PoolSize: 100,
+		PoolSize: cfg.RedisPoolSize,
 	})
 	
 	ctx := context.Background()
@@ -30,76 +38,249 @@ func NewRedisDB(cfg *config.Config) (*RedisDB, error) {
 		return nil, err
 	}
 	
-	return &RedisDB{
+	// 每条命令创建span，挂在调用方ctx中的span下
+	client.AddHook(redisTracingHook{})
+	
+	db := &RedisDB{
 		client: client,
-		ctx:    ctx,
-	}, nil
+	}
+	if cfg.AuthTokenMode == "jwt" {
+		db.revokedSessionTTL = time.Duration(cfg.JWTAccessTokenTTL) * time.Second
+	}
+	return db, nil
 }
 
 func (r *RedisDB) Close() error {
 	return r.client.Close()
 }
 
+// Ping 检查Redis是否可用，用于就绪检查
+func (r *RedisDB) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// PoolStats 连接池状态，用于监控
+func (r *RedisDB) PoolStats() *redis.PoolStats {
+	return r.client.PoolStats()
+}
+
+// sessionTokenBytes Session Token的随机字节数（256位）
+const sessionTokenBytes = 32
+
 // 生成Session Token
-func (r *RedisDB) GenerateSessionToken(userID int64) (string, error) {
-	// 使用UUID生成token
-	token := fmt.Sprintf("session_%d_%d", userID, time.Now().UnixNano())
-	return token, nil
+// Token是不透明的随机串，不包含用户ID等任何可推测的信息
+func GenerateSessionToken() (string, error) {
+	buf := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashSessionToken 计算Token的哈希，Redis中只保存哈希，泄露Redis数据也无法得到可用的Token
+func HashSessionToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+// 用户的Session索引，集合中保存该用户所有Session的ID
+func userSessionsKey(userID int64) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+// 已注销的Session，JWT访问令牌不查询Session，注销后靠它在令牌过期前拒绝该会话签发的令牌
+func revokedSessionKey(sessionID string) string {
+	return fmt.Sprintf("session_revoked:%s", sessionID)
 }
 
-// 存储Session
-func (r *RedisDB) StoreSession(token string, userID int64, expiration time.Duration) error {
-	sessionData := map[string]interface{}{
-		"user_id": userID,
-		"created": time.Now().Unix(),
+// 在pipe中标记会话已注销
+func (r *RedisDB) revokeSessions(ctx context.Context, pipe redis.Pipeliner, sessionIDs ...string) {
+	if r.revokedSessionTTL <= 0 {
+		return
+	}
+	for _, id := range sessionIDs {
+		pipe.Set(ctx, revokedSessionKey(id), 1, r.revokedSessionTTL)
+	}
+}
+
+// IsSessionRevoked 判断会话是否已被注销，用于校验JWT访问令牌中的sid
+func (r *RedisDB) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := r.client.Exists(ctx, revokedSessionKey(sessionID)).Result()
+	return n > 0, err
+}
+
+// 存储Session，并加入用户的Session索引
+func (r *RedisDB) StoreSession(ctx context.Context, token string, session *models.Session, expiration time.Duration) error {
+	session.ID = HashSessionToken(token)
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
 	}
 	
-	data, err := json.Marshal(sessionData)
+	data, err := json.Marshal(session)
 	if err != nil {
 		return err
 	}
 	
-	key := fmt.Sprintf("session:%s", token)
-	return r.client.Set(r.ctx, key, data, expiration).Err()
+	indexKey := userSessionsKey(session.UserID)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(session.ID), data, expiration)
+		pipe.SAdd(ctx, indexKey, session.ID)
+		// 所有Session的有效期相同，索引跟随最近一次写入/刷新的Session过期
+		pipe.Expire(ctx, indexKey, expiration)
+		return nil
+	})
+	return err
 }
 
 // 获取Session
-func (r *RedisDB) GetSession(token string) (int64, error) {
-	key := fmt.Sprintf("session:%s", token)
-	
-	data, err := r.client.Get(r.ctx, key).Bytes()
+func (r *RedisDB) GetSession(ctx context.Context, token string) (*models.Session, error) {
+	return r.GetSessionByID(ctx, HashSessionToken(token))
+}
+
+func (r *RedisDB) GetSessionByID(ctx context.Context, sessionID string) (*models.Session, error) {
+	data, err := r.client.Get(ctx, sessionKey(sessionID)).Bytes()
 	if err != nil {
-		return 0, err
+		if err == redis.Nil {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
 	}
 	
-	var sessionData map[string]interface{}
-	if err := json.Unmarshal(data, &sessionData); err != nil {
-		return 0, err
+	var session models.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
 	}
 	
-	userID, ok := sessionData["user_id"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("invalid session data")
+	if session.UserID == 0 {
+		return nil, fmt.Errorf("invalid session data")
 	}
 	
-	return int64(userID), nil
+	return &session, nil
 }
 
 // 删除Session
-func (r *RedisDB) DeleteSession(token string) error {
-	key := fmt.Sprintf("session:%s", token)
-	return r.client.Del(r.ctx, key).Err()
+func (r *RedisDB) DeleteSession(ctx context.Context, token string) error {
+	session, err := r.GetSession(ctx, token)
+	if err != nil {
+		if err == ErrSessionNotFound {
+			return nil
+		}
+		return err
+	}
+	
+	return r.DeleteSessionByID(ctx, session.UserID, session.ID)
+}
+
+// 按ID删除指定用户的Session，ID不属于该用户时返回ErrSessionNotFound
+func (r *RedisDB) DeleteSessionByID(ctx context.Context, userID int64, sessionID string) error {
+	indexKey := userSessionsKey(userID)
+	
+	isMember, err := r.client.SIsMember(ctx, indexKey, sessionID).Result()
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrSessionNotFound
+	}
+	
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(sessionID))
+		pipe.SRem(ctx, indexKey, sessionID)
+		r.revokeSessions(ctx, pipe, sessionID)
+		return nil
+	})
+	return err
+}
+
+// 删除用户的所有Session（在所有设备上登出）
+func (r *RedisDB) DeleteUserSessions(ctx context.Context, userID int64) error {
+	indexKey := userSessionsKey(userID)
+	
+	sessionIDs, err := r.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return err
+	}
+	
+	keys := make([]string, 0, len(sessionIDs)+1)
+	for _, id := range sessionIDs {
+		keys = append(keys, sessionKey(id))
+	}
+	keys = append(keys, indexKey)
+	
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		r.revokeSessions(ctx, pipe, sessionIDs...)
+		return nil
+	})
+	return err
+}
+
+// 列出用户当前有效的Session，顺带清理索引中已过期的ID
+func (r *RedisDB) ListSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	indexKey := userSessionsKey(userID)
+	
+	sessionIDs, err := r.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+	
+	keys := make([]string, len(sessionIDs))
+	for i, id := range sessionIDs {
+		keys[i] = sessionKey(id)
+	}
+	
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	
+	sessions := make([]*models.Session, 0, len(values))
+	var expired []interface{}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			expired = append(expired, sessionIDs[i])
+			continue
+		}
+		
+		var session models.Session
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	
+	if len(expired) > 0 {
+		r.client.SRem(ctx, indexKey, expired...)
+	}
+	
+	return sessions, nil
 }
 
 // 刷新Session过期时间
-func (r *RedisDB) RefreshSession(token string, expiration time.Duration) error {
-	key := fmt.Sprintf("session:%s", token)
-	return r.client.Expire(r.ctx, key, expiration).Err()
+func (r *RedisDB) RefreshSession(ctx context.Context, session *models.Session, expiration time.Duration) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, sessionKey(session.ID), expiration)
+		pipe.Expire(ctx, userSessionsKey(session.UserID), expiration)
+		return nil
+	})
+	return err
 }
 
 // 检查Session是否存在
-func (r *RedisDB) SessionExists(token string) (bool, error) {
-	key := fmt.Sprintf("session:%s", token)
-	result := r.client.Exists(r.ctx, key).Val()
+func (r *RedisDB) SessionExists(ctx context.Context, token string) (bool, error) {
+	result, err := r.client.Exists(ctx, sessionKey(HashSessionToken(token))).Result()
+	if err != nil {
+		return false, err
+	}
 	return result > 0, nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"user_system_v1/models"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid or expired")
+	// ErrRefreshTokenReused 已轮换掉的刷新令牌被再次使用，通常意味着令牌泄露
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// 刷新令牌只保存哈希
+func refreshTokenKey(token string) string {
+	return "refresh_token:" + HashSessionToken(token)
+}
+
+// 已轮换的刷新令牌，保留到原有效期结束，用于发现重放
+func usedRefreshTokenKey(token string) string {
+	return "refresh_token_used:" + HashSessionToken(token)
+}
+
+// StoreRefreshToken 保存刷新令牌及其所属会话
+func (r *RedisDB) StoreRefreshToken(ctx context.Context, token string, refresh *models.RefreshToken, expiration time.Duration) error {
+	data, err := json.Marshal(refresh)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, refreshTokenKey(token), data, expiration).Err()
+}
+
+// ConsumeRefreshToken 取出并作废刷新令牌，每个令牌只能轮换一次。
+// 令牌已被使用过时返回其所属会话和ErrRefreshTokenReused，调用方应注销整个会话
+func (r *RedisDB) ConsumeRefreshToken(ctx context.Context, token string, expiration time.Duration) (*models.RefreshToken, error) {
+	data, err := r.client.GetDel(ctx, refreshTokenKey(token)).Bytes()
+	if err == redis.Nil {
+		data, err = r.client.Get(ctx, usedRefreshTokenKey(token)).Bytes()
+		if err == redis.Nil {
+			return nil, ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var refresh models.RefreshToken
+		if err := json.Unmarshal(data, &refresh); err != nil {
+			return nil, err
+		}
+		return &refresh, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var refresh models.RefreshToken
+	if err := json.Unmarshal(data, &refresh); err != nil {
+		return nil, err
+	}
+
+	if err := r.client.Set(ctx, usedRefreshTokenKey(token), data, expiration).Err(); err != nil {
+		return nil, err
+	}
+	return &refresh, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"user_system_v1/auth"
+	"user_system_v1/models"
+)
+
+// UserStore 用户数据的持久化存储，由MySQLDB实现，测试时可使用MemoryUserStore。
+// 用户不存在时查询方法返回sql.ErrNoRows。各方法的ctx用于取消请求和关联trace
+type UserStore interface {
+	CreateUser(ctx context.Context, username, password, nickname string, hasher auth.PasswordHasher) (*models.User, error)
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	UpdateUser(ctx context.Context, id int64, nickname, profilePic string) error
+	UpdatePasswordHash(ctx context.Context, id int64, passwordHash string) error
+	SetPassword(ctx context.Context, id int64, password string, hasher auth.PasswordHasher) error
+	ListUsers(ctx context.Context, query, match string, after UserCursor, limit int) ([]*models.User, *UserCursor, error)
+
+	// 两步验证
+	GetTOTPSecret(ctx context.Context, userID int64) (secret string, enabled bool, err error)
+	EnableTOTP(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+
+	// 角色与权限
+	GetUserRoles(ctx context.Context, userID int64) (roles []string, permissions []string, err error)
+	GetRolesForUsers(ctx context.Context, userIDs []int64) (map[int64][]string, error)
+	SetUserRoles(ctx context.Context, userID int64, roles []string) error
+	GrantRoleByUsername(ctx context.Context, username, role string) error
+	SetUserStatus(ctx context.Context, userID int64, status string) error
+}
+
+// SessionStore 会话及其他带过期时间的临时数据，由RedisDB实现，测试时可使用MemorySessionStore
+type SessionStore interface {
+	StoreSession(ctx context.Context, token string, session *models.Session, expiration time.Duration) error
+	GetSession(ctx context.Context, token string) (*models.Session, error)
+	GetSessionByID(ctx context.Context, sessionID string) (*models.Session, error)
+	DeleteSession(ctx context.Context, token string) error
+	DeleteSessionByID(ctx context.Context, userID int64, sessionID string) error
+	DeleteUserSessions(ctx context.Context, userID int64) error
+	ListSessions(ctx context.Context, userID int64) ([]*models.Session, error)
+	RefreshSession(ctx context.Context, session *models.Session, expiration time.Duration) error
+	SessionExists(ctx context.Context, token string) (bool, error)
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+
+	// 登录防暴力破解
+	RecordLoginFailure(ctx context.Context, subject string, window time.Duration) (int64, error)
+	RevertLoginFailure(ctx context.Context, subject string) error
+	LockLogin(ctx context.Context, subject string, duration time.Duration) error
+	TryLockLogin(ctx context.Context, subject string, duration time.Duration) (bool, error)
+	UnlockLogin(ctx context.Context, subject string) error
+	LoginLockRemaining(ctx context.Context, subjects ...string) (time.Duration, error)
+	ClearLoginFailures(ctx context.Context, subject string) error
+
+	// 两步验证
+	StoreLoginChallenge(ctx context.Context, token string, challenge *models.LoginChallenge, expiration time.Duration) error
+	GetLoginChallenge(ctx context.Context, token string) (*models.LoginChallenge, error)
+	IncrLoginChallengeAttempts(ctx context.Context, token string, expiration time.Duration) (int64, error)
+	DeleteLoginChallenge(ctx context.Context, token string) (bool, error)
+	StorePendingTOTPSecret(ctx context.Context, userID int64, secret string, expiration time.Duration) error
+	GetPendingTOTPSecret(ctx context.Context, userID int64) (string, error)
+	DeletePendingTOTPSecret(ctx context.Context, userID int64) error
+	MarkTOTPStepUsed(ctx context.Context, userID int64, step int64, expiration time.Duration) (bool, error)
+
+	// 密码重置
+	StorePasswordResetToken(ctx context.Context, token string, userID int64, expiration time.Duration) error
+	GetPasswordResetToken(ctx context.Context, token string) (int64, error)
+	ConsumePasswordResetToken(ctx context.Context, token string, userID int64) (bool, error)
+	AcquirePasswordResetCooldown(ctx context.Context, userID int64, cooldown time.Duration) (bool, error)
+
+	// JWT刷新令牌
+	StoreRefreshToken(ctx context.Context, token string, refresh *models.RefreshToken, expiration time.Duration) error
+	ConsumeRefreshToken(ctx context.Context, token string, expiration time.Duration) (*models.RefreshToken, error)
+
+	// 用户资料缓存
+	GetCachedUser(ctx context.Context, userID int64) (*models.User, error)
+	CachedUserVersion(ctx context.Context, userID int64) (int64, error)
+	CacheUser(ctx context.Context, user *models.User, version int64, ttl, jitter time.Duration) (bool, error)
+	InvalidateCachedUser(ctx context.Context, userID int64) error
+}
+
+var (
+	_ UserStore    = (*MySQLDB)(nil)
+	_ SessionStore = (*RedisDB)(nil)
+	_ UserStore    = (*MemoryUserStore)(nil)
+	_ SessionStore = (*MemorySessionStore)(nil)
+)
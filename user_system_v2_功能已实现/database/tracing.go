@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"user_system_v1/tracing"
+)
+
+var tracer = otel.Tracer("user_system_v1/database")
+
+// tracedDB 为带ctx的查询和事务内的语句创建span，其余方法直接使用*sql.DB
+type tracedDB struct {
+	*sql.DB
+}
+
+func (db tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*tracedRows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	return newTracedRows(span, rows, err)
+}
+
+func (db tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+func (db tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (db tracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (tracedTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	return tracedTx{tx}, err
+}
+
+// tracedTx 事务内的语句同样创建span
+type tracedTx struct {
+	*sql.Tx
+}
+
+func (tx tracedTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*tracedRows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	rows, err := tx.Tx.QueryContext(ctx, query, args...)
+	return newTracedRows(span, rows, err)
+}
+
+func (tx tracedTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	row := tx.Tx.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+func (tx tracedTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+// tracedRows 结果集读完关闭时才结束span，span的耗时包含逐行读取，读取中的错误也记录在span上
+type tracedRows struct {
+	*sql.Rows
+	span trace.Span
+}
+
+func newTracedRows(span trace.Span, rows *sql.Rows, err error) (*tracedRows, error) {
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+// Close 可以重复调用，只在第一次结束span
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if r.span != nil {
+		tracing.End(r.span, r.Rows.Err())
+		r.span = nil
+	}
+	return err
+}
+
+// startQuerySpan 以SQL的第一个关键字命名span；语句中的参数都是占位符，可以完整记录
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := "QUERY"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracer.Start(ctx, "mysql "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBOperation(operation),
+			semconv.DBStatement(strings.Join(strings.Fields(query), " ")),
+		),
+	)
+}
+
+// redisTracingHook 为每条Redis命令或每个管道创建span。
+// 键中含有Session Token等敏感信息，只记录命令名，不记录参数
+type redisTracingHook struct{}
+
+func (redisTracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = tracer.Start(ctx, "redis "+cmd.Name(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(cmd.Name())),
+	)
+	return ctx, nil
+}
+
+func (redisTracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	tracing.End(trace.SpanFromContext(ctx), redisErr(cmd.Err()))
+	return nil
+}
+
+func (redisTracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	ctx, _ = tracer.Start(ctx, "redis pipeline",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperation(strings.Join(names, " ")),
+			attribute.Int("db.redis.num_cmd", len(cmds)),
+		),
+	)
+	return ctx, nil
+}
+
+func (redisTracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = redisErr(cmd.Err()); err != nil {
+			break
+		}
+	}
+	tracing.End(trace.SpanFromContext(ctx), err)
+	return nil
+}
+
+// redis.Nil表示键不存在，不算失败
+func redisErr(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
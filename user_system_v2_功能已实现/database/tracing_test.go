@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// stubDriver 每条查询都返回rowCount行单列结果，用来得到真实的*sql.Rows
+type stubDriver struct{ rowCount int }
+
+func (d stubDriver) Open(string) (driver.Conn, error) { return stubConn(d), nil }
+
+type stubConn stubDriver
+
+func (c stubConn) Prepare(string) (driver.Stmt, error) { return stubStmt(c), nil }
+func (stubConn) Close() error                          { return nil }
+func (stubConn) Begin() (driver.Tx, error)             { return nil, driver.ErrSkip }
+
+type stubStmt stubConn
+
+func (stubStmt) Close() error                               { return nil }
+func (stubStmt) NumInput() int                              { return -1 }
+func (stubStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (s stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &stubRows{left: s.rowCount}, nil
+}
+
+type stubRows struct{ left int }
+
+func (*stubRows) Columns() []string { return []string{"id"} }
+func (*stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	dest[0] = int64(r.left)
+	return nil
+}
+
+func init() {
+	sql.Register("tracing_stub", stubDriver{rowCount: 3})
+}
+
+// 查询的span在结果集关闭时才结束，覆盖逐行读取的耗时
+func TestTracedRowsEndSpanOnClose(t *testing.T) {
+	db, err := sql.Open("tracing_stub", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "mysql SELECT")
+	raw, err := db.QueryContext(context.Background(), "SELECT id FROM users")
+	rows, err := newTracedRows(span, raw, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("read %d rows, want 3", n)
+	}
+	if ended := len(recorder.Ended()); ended != 0 {
+		t.Fatalf("%d spans ended before the rows were closed", ended)
+	}
+
+	rows.Close()
+	rows.Close()
+	if ended := len(recorder.Ended()); ended != 1 {
+		t.Fatalf("%d spans ended after closing the rows, want 1", ended)
+	}
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"user_system_v1/models"
+)
+
+var (
+	ErrChallengeNotFound = errors.New("login challenge not found")
+	ErrNoPendingTOTP     = errors.New("no pending totp enrollment")
+)
+
+// GetTOTPSecret 返回用户已启用的TOTP密钥，未启用两步验证时enabled为false
+func (m *MySQLDB) GetTOTPSecret(ctx context.Context, userID int64) (secret string, enabled bool, err error) {
+	query := `SELECT secret FROM user_totp WHERE user_id = ?`
+
+	err = m.db.QueryRowContext(ctx, query, userID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+// EnableTOTP 保存TOTP密钥，并用新的恢复码替换旧的恢复码
+func (m *MySQLDB) EnableTOTP(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `REPLACE INTO user_totp (user_id, secret) VALUES (?, ?)`, userID, secret); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP 删除用户的TOTP密钥和恢复码
+func (m *MySQLDB) DisableTOTP(ctx context.Context, userID int64) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode 核销一个恢复码，恢复码不存在或已使用时返回false
+func (m *MySQLDB) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = NOW() 
+			  WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+
+	result, err := m.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// 登录挑战，Token同样只保存哈希
+func loginChallengeKey(token string) string {
+	return "login_challenge:" + HashSessionToken(token)
+}
+
+func loginChallengeAttemptsKey(token string) string {
+	return "login_challenge_attempts:" + HashSessionToken(token)
+}
+
+// StoreLoginChallenge 保存密码校验通过、等待输入验证码的登录挑战
+func (r *RedisDB) StoreLoginChallenge(ctx context.Context, token string, challenge *models.LoginChallenge, expiration time.Duration) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, loginChallengeKey(token), data, expiration).Err()
+}
+
+func (r *RedisDB) GetLoginChallenge(ctx context.Context, token string) (*models.LoginChallenge, error) {
+	data, err := r.client.Get(ctx, loginChallengeKey(token)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+
+	var challenge models.LoginChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, err
+	}
+
+	if challenge.UserID == 0 {
+		return nil, fmt.Errorf("invalid login challenge data")
+	}
+
+	return &challenge, nil
+}
+
+// IncrLoginChallengeAttempts 记录一次验证码尝试并返回累计次数
+func (r *RedisDB) IncrLoginChallengeAttempts(ctx context.Context, token string, expiration time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, loginChallengeAttemptsKey(token))
+		pipe.Expire(ctx, loginChallengeAttemptsKey(token), expiration)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// DeleteLoginChallenge 删除登录挑战，返回false表示挑战已被使用或已过期
+func (r *RedisDB) DeleteLoginChallenge(ctx context.Context, token string) (bool, error) {
+	n, err := r.client.Del(ctx, loginChallengeKey(token), loginChallengeAttemptsKey(token)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// 尚未确认的TOTP密钥
+func pendingTOTPKey(userID int64) string {
+	return fmt.Sprintf("totp_pending:%d", userID)
+}
+
+// StorePendingTOTPSecret 保存待确认的TOTP密钥，用户输入正确的验证码后才写入MySQL
+func (r *RedisDB) StorePendingTOTPSecret(ctx context.Context, userID int64, secret string, expiration time.Duration) error {
+	return r.client.Set(ctx, pendingTOTPKey(userID), secret, expiration).Err()
+}
+
+func (r *RedisDB) GetPendingTOTPSecret(ctx context.Context, userID int64) (string, error) {
+	secret, err := r.client.Get(ctx, pendingTOTPKey(userID)).Result()
+	if err == redis.Nil {
+		return "", ErrNoPendingTOTP
+	}
+	return secret, err
+}
+
+func (r *RedisDB) DeletePendingTOTPSecret(ctx context.Context, userID int64) error {
+	return r.client.Del(ctx, pendingTOTPKey(userID)).Err()
+}
+
+// MarkTOTPStepUsed 标记用户已使用某个时间步的验证码，返回false表示该验证码已被使用过
+func (r *RedisDB) MarkTOTPStepUsed(ctx context.Context, userID int64, step int64, expiration time.Duration) (bool, error) {
+	key := fmt.Sprintf("totp_used:%d:%d", userID, step)
+	return r.client.SetNX(ctx, key, 1, expiration).Result()
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"user_system_v1/models"
+)
+
+// minContainsQueryLen 全文索引使用ngram分词（默认ngram_token_size=2），更短的关键词退化为前缀匹配
+const minContainsQueryLen = 2
+
+// 前缀搜索的两段，先列出用户名匹配的用户，再列出只有昵称匹配的用户
+const (
+	UserCursorUsername = "username"
+	UserCursorNickname = "nickname"
+)
+
+// UserCursor 上一页最后一行的排序位置。按ID排列时只用ID；前缀搜索时Field为所在的段，
+// Key为该行在这一段的排序列（用户名或昵称）上的值
+type UserCursor struct {
+	Field string `json:"f,omitempty"`
+	Key   string `json:"k,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+// Valid 判断从调用方传回的游标是否合法
+func (c UserCursor) Valid() bool {
+	switch c.Field {
+	case "":
+		return c.Key == "" && c.ID >= 0
+	case UserCursorUsername, UserCursorNickname:
+		return c.ID > 0
+	}
+	return false
+}
+
+// ListUsers 游标分页，返回after之后的一页用户和下一页的游标，没有下一页时游标为nil。
+// query为空时按ID排列；prefix先按(username, id)列出用户名匹配的用户，再按(nickname, id)列出
+// 只有昵称匹配的用户，两段都沿idx_username/idx_nickname的顺序扫描（InnoDB二级索引隐含主键），
+// 不需要对匹配的行排序；contains走ngram全文索引ft_users_search，避免在大表上做 LIKE '%q%' 全表扫描
+func (m *MySQLDB) ListUsers(ctx context.Context, query, match string, after UserCursor, limit int) ([]*models.User, *UserCursor, error) {
+	switch {
+	case query == "":
+		users, err := m.queryUsers(ctx, `SELECT `+userColumns+` FROM users WHERE id > ? ORDER BY id LIMIT ?`,
+			after.ID, limit+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pageByID(users, limit)
+	case match == models.UserMatchContains && utf8.RuneCountInString(query) >= minContainsQueryLen:
+		users, err := m.queryUsers(ctx, `SELECT `+userColumns+` FROM users
+			WHERE MATCH(username, nickname) AGAINST (? IN BOOLEAN MODE) AND id > ?
+			ORDER BY id LIMIT ?`,
+			fulltextPhrase(query), after.ID, limit+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pageByID(users, limit)
+	default:
+		return m.listUsersByPrefix(ctx, query, after, limit)
+	}
+}
+
+func (m *MySQLDB) listUsersByPrefix(ctx context.Context, query string, after UserCursor, limit int) ([]*models.User, *UserCursor, error) {
+	pattern := escapeLike(query) + "%"
+
+	// 多取一行判断是否还有下一页；第一段不足一页时由第二段补齐
+	var users []*models.User
+	if after.Field != UserCursorNickname {
+		var err error
+		users, err = m.queryUsers(ctx, `SELECT `+userColumns+` FROM users
+			WHERE username LIKE ? AND username >= ? AND (username > ? OR id > ?)
+			ORDER BY username, id LIMIT ?`,
+			pattern, after.Key, after.Key, after.ID, limit+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = UserCursor{Field: UserCursorNickname}
+	}
+	byUsername := len(users)
+
+	if byUsername <= limit {
+		more, err := m.queryUsers(ctx, `SELECT `+userColumns+` FROM users
+			WHERE nickname LIKE ? AND nickname >= ? AND (nickname > ? OR id > ?) AND username NOT LIKE ?
+			ORDER BY nickname, id LIMIT ?`,
+			pattern, after.Key, after.Key, after.ID, pattern, limit+1-byUsername)
+		if err != nil {
+			return nil, nil, err
+		}
+		users = append(users, more...)
+	}
+	return pageByPrefix(users, byUsername, limit)
+}
+
+// pageByID 截取一页，游标为最后一行的ID
+func pageByID(users []*models.User, limit int) ([]*models.User, *UserCursor, error) {
+	if len(users) <= limit {
+		return users, nil, nil
+	}
+	users = users[:limit]
+	return users, &UserCursor{ID: users[limit-1].ID}, nil
+}
+
+// pageByPrefix 截取一页，前byUsername行来自用户名一段，游标按最后一行所在的段记录位置
+func pageByPrefix(users []*models.User, byUsername, limit int) ([]*models.User, *UserCursor, error) {
+	if len(users) <= limit {
+		return users, nil, nil
+	}
+	users = users[:limit]
+	last := users[limit-1]
+	if limit <= byUsername {
+		return users, &UserCursor{Field: UserCursorUsername, Key: last.Username, ID: last.ID}, nil
+	}
+	return users, &UserCursor{Field: UserCursorNickname, Key: last.Nickname, ID: last.ID}, nil
+}
+
+func (m *MySQLDB) queryUsers(ctx context.Context, query string, args ...interface{}) ([]*models.User, error) {
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// fulltextPhrase 把关键词转成布尔模式下的短语查询，ngram分词后相当于子串匹配
+func fulltextPhrase(query string) string {
+	return `"` + strings.ReplaceAll(query, `"`, " ") + `"`
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"user_system_v1/auth"
+	"user_system_v1/models"
+)
+
+// listAll 按limit逐页读取，返回所有用户名
+func listAll(t *testing.T, store UserStore, query, match string, limit int) []string {
+	t.Helper()
+
+	var names []string
+	var after UserCursor
+	for page := 0; ; page++ {
+		if page > 20 {
+			t.Fatal("pagination does not terminate")
+		}
+		users, next, err := store.ListUsers(context.Background(), query, match, after, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) > limit {
+			t.Fatalf("page %d has %d users, limit %d", page, len(users), limit)
+		}
+		for _, user := range users {
+			names = append(names, user.Username)
+		}
+		if next == nil {
+			return names
+		}
+		if !next.Valid() {
+			t.Fatalf("invalid cursor %+v", next)
+		}
+		after = *next
+	}
+}
+
+func TestListUsersByPrefix(t *testing.T) {
+	store := NewMemoryUserStore()
+	hasher := auth.NewBcryptHasher(bcrypt.MinCost)
+	// 创建顺序与用户名顺序不同，确认按(用户名, ID)而不是ID排列
+	for _, u := range []struct{ username, nickname string }{
+		{"bob", "Annie"},
+		{"anna", ""},
+		{"carl", "andy"},
+		{"Andrew", "Bob"},
+		{"dave", "ann"},
+		{"alice", "Carol"},
+		{"erin", "Eve"},
+	} {
+		if _, err := store.CreateUser(context.Background(), u.username, "secret123", u.nickname, hasher); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 先是用户名匹配的用户，再是只有昵称匹配的用户，各自按排序列（不区分大小写）和ID排列
+	want := []string{"Andrew", "anna", "carl", "dave", "bob"}
+	for limit := 1; limit <= len(want)+1; limit++ {
+		got := listAll(t, store, "an", models.UserMatchPrefix, limit)
+		if !equalStrings(got, want) {
+			t.Errorf("limit %d: got %v, want %v", limit, got, want)
+		}
+	}
+
+	// 不搜索时按ID排列
+	all := listAll(t, store, "", "", 3)
+	if !equalStrings(all, []string{"bob", "anna", "carl", "Andrew", "dave", "alice", "erin"}) {
+		t.Errorf("list all: %v", all)
+	}
+}
+
+func TestUserCursorValid(t *testing.T) {
+	tests := []struct {
+		cursor UserCursor
+		want   bool
+	}{
+		{UserCursor{}, true},
+		{UserCursor{ID: 42}, true},
+		{UserCursor{ID: -1}, false},
+		{UserCursor{Key: "bob", ID: 42}, false},
+		{UserCursor{Field: UserCursorUsername, Key: "bob", ID: 42}, true},
+		{UserCursor{Field: UserCursorNickname, Key: "", ID: 42}, true},
+		{UserCursor{Field: UserCursorNickname, Key: "bob"}, false},
+		{UserCursor{Field: "password_hash", Key: "x", ID: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cursor.Valid(); got != tt.want {
+			t.Errorf("%+v.Valid() = %v, want %v", tt.cursor, got, tt.want)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
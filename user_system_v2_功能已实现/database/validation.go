@@ -0,0 +1,56 @@
+package database
+
+import (
+	"errors"
+	"regexp"
+	"unicode"
+)
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 50 // 与users.username列宽一致
+
+	MinPasswordLength = 8
+	MaxPasswordLength = 72 // bcrypt只处理前72字节
+)
+
+var (
+	ErrUsernameTaken   = errors.New("username already exists")
+	ErrInvalidUsername = errors.New("username must be 3-50 characters of letters, digits or underscores, starting with a letter")
+	ErrWeakPassword    = errors.New("password must be 8-72 characters and contain both letters and digits")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// ValidateUsername 校验用户名规则
+func ValidateUsername(username string) error {
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength {
+		return ErrInvalidUsername
+	}
+	if !usernamePattern.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	return nil
+}
+
+// ValidatePassword 校验密码强度
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return ErrWeakPassword
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return ErrWeakPassword
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactionAndRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type loginRequest struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	logger.InfoContext(ctx, "login",
+		"username", "alice",
+		"password", "secret123",
+		"session_token", "tok",
+		"request", &loginRequest{Username: "alice", Password: "secret123"},
+		"headers", map[string]string{"Authorization": "Bearer tok"},
+	)
+	logger.DebugContext(ctx, "filtered by level")
+
+	if strings.Contains(buf.String(), "secret123") || strings.Contains(buf.String(), "tok\"") {
+		t.Fatalf("sensitive value logged: %s", buf.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON line: %v\n%s", err, buf.String())
+	}
+	if entry[RequestIDKey] != "req-1" || entry["username"] != "alice" {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+	if entry["password"] != Redacted || entry["session_token"] != Redacted {
+		t.Fatalf("top-level fields not redacted: %v", entry)
+	}
+	request := entry["request"].(map[string]interface{})
+	if request["password"] != Redacted || request["username"] != "alice" {
+		t.Fatalf("nested fields not redacted: %v", request)
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "verbose", FormatText); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if _, err := New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// Redacted 替换敏感字段的值
+const Redacted = "[REDACTED]"
+
+// sensitiveKeyParts 字段名（去掉下划线和连字符后）包含这些片段时视为敏感
+var sensitiveKeyParts = []string{
+	"password",
+	"passwd",
+	"token",
+	"secret",
+	"hash",
+	"authorization",
+	"cookie",
+	"recoverycode",
+	"privatekey",
+}
+
+// sensitiveKeys 需要完全匹配的敏感字段名，如两步验证码
+var sensitiveKeys = map[string]bool{
+	"code": true,
+}
+
+// IsSensitiveKey 判断字段名是否可能包含密码、令牌或哈希
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	key = strings.NewReplacer("_", "", "-", "").Replace(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAttr 作为HandlerOptions.ReplaceAttr，替换敏感字段；
+// 结构体、map等复合值按JSON字段名逐层检查
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if IsSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		a.Value = redactValue(a.Value.Any())
+	}
+	return a
+}
+
+func redactValue(v interface{}) slog.Value {
+	if _, ok := v.(error); ok || !isComposite(v) {
+		return slog.AnyValue(v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return slog.AnyValue(v)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return slog.AnyValue(v)
+	}
+	return slog.AnyValue(redactJSON(decoded))
+}
+
+func isComposite(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if IsSensitiveKey(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactJSON(value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"user_system_v1/client"
+)
+
+// statMetric 从一次统计快照中取出的一项指标
+type statMetric[T any] struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(T) float64
+}
+
+func gauge[T any](subsystem, name, help string, value func(T) float64) statMetric[T] {
+	return statMetric[T]{
+		desc:      prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, nil, nil),
+		valueType: prometheus.GaugeValue,
+		value:     value,
+	}
+}
+
+func counter[T any](subsystem, name, help string, value func(T) float64) statMetric[T] {
+	return statMetric[T]{
+		desc:      prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, nil, nil),
+		valueType: prometheus.CounterValue,
+		value:     value,
+	}
+}
+
+// statsCollector 每次采集时读取一次统计快照，同一次采集中的各项指标相互一致
+type statsCollector[T any] struct {
+	stats   func() T
+	metrics []statMetric[T]
+}
+
+func (c *statsCollector[T]) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics {
+		ch <- m.desc
+	}
+}
+
+func (c *statsCollector[T]) Collect(ch chan<- prometheus.Metric) {
+	snapshot := c.stats()
+	for _, m := range c.metrics {
+		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value(snapshot))
+	}
+}
+
+// RegisterMySQL 采集MySQL连接池状态
+func RegisterMySQL(stats func() sql.DBStats) {
+	Registry.MustRegister(&statsCollector[sql.DBStats]{stats: stats, metrics: []statMetric[sql.DBStats]{
+		gauge("mysql", "max_open_connections", "Maximum number of open connections.",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }),
+		gauge("mysql", "open_connections", "Established connections, in use and idle.",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }),
+		gauge("mysql", "in_use_connections", "Connections currently in use.",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }),
+		gauge("mysql", "idle_connections", "Idle connections.",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }),
+		counter("mysql", "wait_count_total", "Connections waited for.",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }),
+		counter("mysql", "wait_duration_seconds_total", "Time spent waiting for a connection.",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }),
+		counter("mysql", "max_idle_closed_total", "Connections closed due to the idle limit.",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }),
+		counter("mysql", "max_lifetime_closed_total", "Connections closed due to the maximum lifetime.",
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }),
+	}})
+}
+
+// RegisterRedis 采集Redis连接池状态
+func RegisterRedis(stats func() *redis.PoolStats) {
+	Registry.MustRegister(&statsCollector[*redis.PoolStats]{stats: stats, metrics: []statMetric[*redis.PoolStats]{
+		gauge("redis", "total_connections", "Connections in the pool.",
+			func(s *redis.PoolStats) float64 { return float64(s.TotalConns) }),
+		gauge("redis", "idle_connections", "Idle connections in the pool.",
+			func(s *redis.PoolStats) float64 { return float64(s.IdleConns) }),
+		counter("redis", "pool_hits_total", "Times a free connection was found in the pool.",
+			func(s *redis.PoolStats) float64 { return float64(s.Hits) }),
+		counter("redis", "pool_misses_total", "Times a free connection was not found in the pool.",
+			func(s *redis.PoolStats) float64 { return float64(s.Misses) }),
+		counter("redis", "pool_timeouts_total", "Times waiting for a connection timed out.",
+			func(s *redis.PoolStats) float64 { return float64(s.Timeouts) }),
+		counter("redis", "stale_connections_total", "Stale connections removed from the pool.",
+			func(s *redis.PoolStats) float64 { return float64(s.StaleConns) }),
+	}})
+}
+
+// RegisterRPCClient 采集HTTP网关到TCP服务器的连接池状态
+func RegisterRPCClient(stats func() client.Stats) {
+	Registry.MustRegister(&statsCollector[client.Stats]{stats: stats, metrics: []statMetric[client.Stats]{
+		gauge("rpc_client", "pool_size", "Configured number of connections.",
+			func(s client.Stats) float64 { return float64(s.PoolSize) }),
+		gauge("rpc_client", "open_connections", "Connections currently usable.",
+			func(s client.Stats) float64 { return float64(s.OpenConns) }),
+		gauge("rpc_client", "in_flight_requests", "Requests waiting for a response.",
+			func(s client.Stats) float64 { return float64(s.InFlight) }),
+		counter("rpc_client", "dials_total", "Connection attempts, including reconnects.",
+			func(s client.Stats) float64 { return float64(s.Dials) }),
+		counter("rpc_client", "dial_failures_total", "Failed connection attempts.",
+			func(s client.Stats) float64 { return float64(s.DialFailures) }),
+		gauge("rpc_client", "backends", "User service instances known to the client.",
+			func(s client.Stats) float64 { return float64(s.Backends) }),
+		gauge("rpc_client", "healthy_backends", "User service instances not currently ejected.",
+			func(s client.Stats) float64 { return float64(s.HealthyBackends) }),
+		counter("rpc_client", "ejections_total", "Times an instance was ejected after consecutive failures.",
+			func(s client.Stats) float64 { return float64(s.Ejections) }),
+		counter("rpc_client", "retries_total", "Idempotent requests retried on another instance.",
+			func(s client.Stats) float64 { return float64(s.Retries) }),
+	}})
+}
@@ -0,0 +1,62 @@
+package models
+
+// 用户状态
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+)
+
+// 内置角色
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// 权限
+const (
+	PermUsersRead  = "users:read"  // 查看、搜索用户
+	PermUsersWrite = "users:write" // 编辑、禁用用户及分配角色
+)
+
+// DefaultRolePermissions 内置角色及其权限，与数据库迁移0003_roles写入的数据一致
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin:   {PermUsersRead, PermUsersWrite},
+	RoleSupport: {PermUsersRead},
+}
+
+// AdminUser 管理接口返回的用户信息，附带角色
+type AdminUser struct {
+	User
+	Roles []string `json:"roles"`
+}
+
+// AdminListUsersResponse 分页方式与ListUsersResponse相同
+type AdminListUsersResponse struct {
+	Success    bool         `json:"success"`
+	Message    string       `json:"message"`
+	Users      []*AdminUser `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+type AdminUserRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// AdminUpdateUserRequest 字段为nil表示不修改
+type AdminUpdateUserRequest struct {
+	UserID     int64     `json:"user_id"`
+	Nickname   *string   `json:"nickname,omitempty"`
+	ProfilePic *string   `json:"profile_pic,omitempty"`
+	Roles      *[]string `json:"roles,omitempty"`
+}
+
+type AdminSetUserStatusRequest struct {
+	UserID int64  `json:"user_id"`
+	Status string `json:"status"`
+}
+
+type AdminUserResponse struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message"`
+	User    *AdminUser `json:"user,omitempty"`
+}
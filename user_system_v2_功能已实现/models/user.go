@@ -10,6 +10,7 @@ type User struct {
 	PasswordHash string    `json:"-" db:"password_hash"` // 隐藏密码
 	Nickname     string    `json:"nickname" db:"nickname"`
 	ProfilePic   string    `json:"profile_pic" db:"profile_pic"`
+	Status       string    `json:"status" db:"status"` // active 或 disabled
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -17,11 +18,62 @@ type User struct {
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	ClientInfo
+}
+
+// ClientInfo 发起请求的客户端信息，由HTTP网关填写，记录在Session中
+type ClientInfo struct {
+	IP        string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Session 登录会话，存储在Redis中
+type Session struct {
+	ID        string    `json:"id"` // Token的哈希，可用于标识会话，但不能用于认证
+	UserID    int64     `json:"user_id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 登录时从数据库加载，角色变更时该用户的所有会话被注销，重新登录后生效
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// HasPermission 判断会话是否拥有指定权限
+func (s *Session) HasPermission(permission string) bool {
+	for _, p := range s.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
 }
 
 type LoginResponse struct {
+	Success    bool   `json:"success"`
+	Token      string `json:"token,omitempty"`
+	Message    string `json:"message"`
+	User       *User  `json:"user,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // 秒，登录被限制时需等待的时间
+
+	// 开启两步验证的用户密码校验通过后返回挑战Token，凭它和验证码完成登录
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+
+	// JWT模式下Token为访问令牌，凭RefreshToken换取新的令牌对
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"` // 秒，访问令牌的有效期
+}
+
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Nickname string `json:"nickname"`
+}
+
+type RegisterResponse struct {
 	Success bool   `json:"success"`
-	Token   string `json:"token,omitempty"`
 	Message string `json:"message"`
 	User    *User  `json:"user,omitempty"`
 }
@@ -42,3 +94,102 @@ type GetProfileResponse struct {
 	Message string `json:"message"`
 	User    *User  `json:"user,omitempty"`
 }
+
+// SessionInfo 会话列表中的一项
+type SessionInfo struct {
+	Session
+	Current bool `json:"current"` // 是否为发起请求的当前会话
+}
+
+type ListSessionsResponse struct {
+	Success  bool           `json:"success"`
+	Message  string         `json:"message"`
+	Sessions []*SessionInfo `json:"sessions"`
+}
+
+type RevokeSessionRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+// SimpleResponse 不携带业务数据的通用响应
+type SimpleResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// TwoFactorLoginRequest 两步登录的第二步，Code可以是TOTP验证码或恢复码
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// LoginChallenge 保存在Redis中的登录挑战
+type LoginChallenge struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	ClientInfo
+}
+
+type TOTPSetupResponse struct {
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	Secret     string `json:"secret,omitempty"`
+	OTPAuthURI string `json:"otpauth_uri,omitempty"`
+}
+
+// TOTPCodeRequest 确认绑定或关闭两步验证时提交的验证码
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPConfirmResponse struct {
+	Success       bool     `json:"success"`
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+// ResetPasswordRequest 凭通知中收到的重置Token设置新密码
+type ResetPasswordRequest struct {
+	ResetToken  string `json:"reset_token"`
+	NewPassword string `json:"new_password"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken 保存在Redis中的刷新令牌，同一会话轮换出的令牌属于同一族
+type RefreshToken struct {
+	SessionID string `json:"session_id"`
+	UserID    int64  `json:"user_id"`
+}
+
+// 用户搜索的匹配方式
+const (
+	UserMatchPrefix   = "prefix"   // 用户名或昵称以关键词开头（默认）
+	UserMatchContains = "contains" // 用户名或昵称包含关键词
+)
+
+// ListUsersRequest Cursor为上一页返回的NextCursor，为空时从第一页开始
+type ListUsersRequest struct {
+	Query  string `json:"q"`
+	Match  string `json:"match,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type ListUsersResponse struct {
+	Success    bool    `json:"success"`
+	Message    string  `json:"message"`
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"next_cursor,omitempty"` // 为空表示没有下一页
+}
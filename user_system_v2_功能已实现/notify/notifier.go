@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// 通知方式名称
+	KindLog  = "log"
+	KindFile = "file"
+)
+
+// Message 发送给用户的一条通知
+// 用户表中还没有邮箱或手机号字段，To暂时为用户名，由具体实现决定如何投递
+type Message struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Notifier 用户通知的投递方式，接入邮件或短信服务时实现该接口即可
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// New 按名称创建Notifier，file方式需要指定输出文件
+func New(kind, path string) (Notifier, error) {
+	switch kind {
+	case KindLog:
+		return LogNotifier{}, nil
+	case KindFile:
+		if path == "" {
+			return nil, fmt.Errorf("notifier %q requires a file path", kind)
+		}
+		return NewFileNotifier(path), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier: %q", kind)
+	}
+}
+
+// LogNotifier 只把通知的收件人和标题写入服务日志，用于开发环境。
+// 正文中可能有重置链接等凭据，不写入日志；开发时需要正文请使用file方式
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, msg *Message) error {
+	slog.InfoContext(ctx, "Notification", "to", msg.To, "subject", msg.Subject, "body_bytes", len(msg.Body))
+	return nil
+}
+
+// FileNotifier 把通知以JSON行追加到文件中，便于测试脚本读取
+type FileNotifier struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(ctx context.Context, msg *Message) error {
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now()
+	}
+
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// 编解码器名称
+	CodecJSON    = "json"
+	CodecMsgpack = "msgpack"
+)
+
+// Codec 消息编解码器
+// 同一连接上的消息信封（Message/Response）与其中的业务Payload使用同一个编解码器
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// DefaultCodec 未经握手协商的连接使用JSON，兼容旧客户端
+	DefaultCodec Codec = jsonCodec{}
+
+	codecs = map[string]Codec{
+		CodecJSON:    jsonCodec{},
+		CodecMsgpack: newMsgpackCodec(),
+	}
+)
+
+// CodecByName 按名称查找编解码器
+func CodecByName(name string) (Codec, bool) {
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return CodecJSON }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackCodec MessagePack二进制编码
+// 沿用结构体上的json标签，models中的结构体无需额外声明msgpack标签
+type msgpackCodec struct {
+	encoders sync.Pool
+}
+
+func newMsgpackCodec() *msgpackCodec {
+	return &msgpackCodec{
+		encoders: sync.Pool{
+			New: func() interface{} {
+				buf := &bytes.Buffer{}
+				enc := msgpack.NewEncoder(buf)
+				enc.SetCustomStructTag("json")
+				enc.SetOmitEmpty(true)
+				return enc
+			},
+		},
+	}
+}
+
+func (c *msgpackCodec) Name() string { return CodecMsgpack }
+
+func (c *msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	enc := c.encoders.Get().(*msgpack.Encoder)
+	defer c.encoders.Put(enc)
+
+	buf := enc.Writer().(*bytes.Buffer)
+	buf.Reset()
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	return data, nil
+}
+
+func (c *msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+
+	// Reset会清空解码选项，需在其后设置标签
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
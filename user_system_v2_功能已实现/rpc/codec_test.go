@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"testing"
+)
+
+type testPayload struct {
+	Username string            `json:"username"`
+	Age      int               `json:"age"`
+	Tags     []string          `json:"tags"`
+	Extra    map[string]string `json:"extra"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, name := range []string{CodecJSON, CodecMsgpack} {
+		t.Run(name, func(t *testing.T) {
+			codec, ok := CodecByName(name)
+			if !ok {
+				t.Fatalf("codec %s not registered", name)
+			}
+
+			want := testPayload{Username: "user_1", Age: 30, Tags: []string{"a", "b"}, Extra: map[string]string{"k": "v"}}
+			payload, err := codec.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := EncodeMessage(codec, &Message{Type: MSG_GET_PROFILE, ID: 42, Payload: payload, RequestID: "req-1", Metadata: map[string]string{"traceparent": "tp"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := DecodeMessage(codec, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type != MSG_GET_PROFILE || msg.ID != 42 || msg.RequestID != "req-1" || msg.Metadata["traceparent"] != "tp" {
+				t.Errorf("message = %+v", msg)
+			}
+			var got testPayload
+			if err := msg.DecodePayload(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Username != want.Username || got.Age != want.Age || len(got.Tags) != 2 || got.Extra["k"] != "v" {
+				t.Errorf("payload = %+v, want %+v", got, want)
+			}
+
+			// 响应的Payload与信封使用同一编解码器
+			respPayload, _ := msg.EncodePayload(want)
+			data, err = EncodeResponse(codec, &Response{Type: msg.Type, ID: msg.ID, Status: STATUS_SUCCESS, Payload: respPayload})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := DecodeResponse(codec, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = testPayload{}
+			if err := resp.DecodePayload(&got); err != nil || resp.ID != 42 || got.Username != want.Username {
+				t.Errorf("response = %+v, payload %+v, err %v", resp, got, err)
+			}
+		})
+	}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	tests := []struct {
+		offered []string
+		want    string
+	}{
+		{[]string{CodecMsgpack, CodecJSON}, CodecMsgpack},
+		{[]string{"protobuf", CodecMsgpack}, CodecMsgpack},
+		{[]string{"protobuf"}, CodecJSON}, // 都不认识时回退到JSON
+		{nil, CodecJSON},
+	}
+	for _, tt := range tests {
+		frame := EncodeHandshake(tt.offered...)
+		if !IsHandshake(frame) {
+			t.Fatalf("%v: not recognised as handshake", tt.offered)
+		}
+		if got := NegotiateCodec(ParseHandshake(frame)).Name(); got != tt.want {
+			t.Errorf("NegotiateCodec(%v) = %s, want %s", tt.offered, got, tt.want)
+		}
+	}
+
+	// JSON消息体不会被误认为握手
+	data, _ := EncodeMessage(DefaultCodec, &Message{Type: MSG_HEARTBEAT})
+	if IsHandshake(data) {
+		t.Error("JSON message recognised as handshake")
+	}
+}
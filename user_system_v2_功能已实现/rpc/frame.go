@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// 帧格式 [4字节长度前缀（大端序）][消息体]
+	frameHeaderSize = 4
+
+	// 默认最大帧大小 1MB
+	DefaultMaxFrameSize = 1 << 20
+)
+
+var ErrFrameTooLarge = errors.New("rpc frame exceeds maximum size")
+
+// FrameReader 从字节流中逐帧读取消息体
+// 内部带缓冲，同一连接上背靠背发送的多个帧可被连续读出
+type FrameReader struct {
+	r       *bufio.Reader
+	maxSize uint32
+	header  [frameHeaderSize]byte
+}
+
+func NewFrameReader(r io.Reader, maxSize uint32) *FrameReader {
+	if maxSize == 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &FrameReader{
+		r:       bufio.NewReader(r),
+		maxSize: maxSize,
+	}
+}
+
+// ReadFrame 读取一帧并返回消息体
+// 超过最大帧大小时返回ErrFrameTooLarge，此时流已无法继续解析，调用方应关闭连接
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	if _, err := io.ReadFull(fr.r, fr.header[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(fr.header[:])
+	if length > fr.maxSize {
+		return nil, fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, length, fr.maxSize)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(fr.r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// FrameWriter 写入带长度前缀的帧，可被多个协程并发使用
+type FrameWriter struct {
+	mutex   sync.Mutex
+	w       io.Writer
+	maxSize uint32
+}
+
+func NewFrameWriter(w io.Writer, maxSize uint32) *FrameWriter {
+	if maxSize == 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &FrameWriter{
+		w:       w,
+		maxSize: maxSize,
+	}
+}
+
+// WriteFrame 写入一帧，长度前缀与消息体一次写出，保证并发写入时帧不会交错
+func (fw *FrameWriter) WriteFrame(body []byte) error {
+	if uint64(len(body)) > uint64(fw.maxSize) {
+		return fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, len(body), fw.maxSize)
+	}
+
+	buf := make([]byte, frameHeaderSize+len(body))
+	binary.BigEndian.PutUint32(buf[:frameHeaderSize], uint32(len(body)))
+	copy(buf[frameHeaderSize:], body)
+
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	_, err := fw.w.Write(buf)
+	return err
+}
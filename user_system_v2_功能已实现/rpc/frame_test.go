@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFramesBackToBack(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewFrameWriter(&buf, 0)
+	bodies := []string{"first", "", "third frame"}
+	for _, body := range bodies {
+		if err := writer.WriteFrame([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 多个帧在同一次读取中到达，逐个读出
+	reader := NewFrameReader(&buf, 0)
+	for _, want := range bodies {
+		got, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("frame = %q, want %q", got, want)
+		}
+	}
+	if _, err := reader.ReadFrame(); err != io.EOF {
+		t.Errorf("after last frame: err = %v, want EOF", err)
+	}
+}
+
+func TestFrameSplitAcrossReads(t *testing.T) {
+	var buf bytes.Buffer
+	NewFrameWriter(&buf, 0).WriteFrame([]byte("split into single bytes"))
+	NewFrameWriter(&buf, 0).WriteFrame([]byte("and another"))
+
+	// 每次Read只返回一个字节，长度前缀和消息体都被拆开
+	reader := NewFrameReader(iotest.OneByteReader(&buf), 0)
+	for _, want := range []string{"split into single bytes", "and another"} {
+		got, err := reader.ReadFrame()
+		if err != nil || string(got) != want {
+			t.Fatalf("frame = %q, %v; want %q", got, err, want)
+		}
+	}
+}
+
+func TestFrameTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	NewFrameWriter(&buf, 0).WriteFrame([]byte("truncated"))
+	buf.Truncate(buf.Len() - 2)
+
+	if _, err := NewFrameReader(&buf, 0).ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Errorf("err = %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewFrameWriter(&buf, 8)
+	if err := writer.WriteFrame(make([]byte, 9)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("write: err = %v, want ErrFrameTooLarge", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("oversized frame wrote %d bytes", buf.Len())
+	}
+	if err := writer.WriteFrame(make([]byte, 8)); err != nil {
+		t.Fatalf("write at the limit: %v", err)
+	}
+
+	// 读端的限制比写端小时拒绝该帧
+	if _, err := NewFrameReader(bytes.NewReader(buf.Bytes()), 4).ReadFrame(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("read: err = %v, want ErrFrameTooLarge", err)
+	}
+	if body, err := NewFrameReader(bytes.NewReader(buf.Bytes()), 8).ReadFrame(); err != nil || len(body) != 8 {
+		t.Errorf("read at the limit: %d bytes, %v", len(body), err)
+	}
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"bytes"
+	"strings"
+)
+
+// 握手帧格式 [魔数"URPC"][1字节版本][逗号分隔的编解码器名称]
+// 客户端在连接建立后的第一帧发送按优先级排列的候选编解码器，服务端回复选中的一个。
+// JSON消息体总以'{'开头，不会与魔数冲突，因此未握手的旧客户端直接按JSON处理。
+const handshakeVersion = 1
+
+var handshakeMagic = []byte("URPC")
+
+// EncodeHandshake 生成握手帧消息体
+func EncodeHandshake(codecNames ...string) []byte {
+	buf := make([]byte, 0, len(handshakeMagic)+1+16)
+	buf = append(buf, handshakeMagic...)
+	buf = append(buf, handshakeVersion)
+	buf = append(buf, strings.Join(codecNames, ",")...)
+	return buf
+}
+
+// IsHandshake 判断一帧是否为握手帧
+func IsHandshake(frame []byte) bool {
+	return len(frame) > len(handshakeMagic) && bytes.HasPrefix(frame, handshakeMagic)
+}
+
+// ParseHandshake 解析握手帧中的编解码器名称列表
+func ParseHandshake(frame []byte) []string {
+	if !IsHandshake(frame) || frame[len(handshakeMagic)] != handshakeVersion {
+		return nil
+	}
+	names := string(frame[len(handshakeMagic)+1:])
+	if names == "" {
+		return nil
+	}
+	return strings.Split(names, ",")
+}
+
+// NegotiateCodec 从客户端候选列表中选出第一个本端支持的编解码器，都不支持时回退到JSON
+func NegotiateCodec(names []string) Codec {
+	for _, name := range names {
+		if codec, ok := CodecByName(name); ok {
+			return codec
+		}
+	}
+	return DefaultCodec
+}
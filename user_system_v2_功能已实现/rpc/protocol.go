@@ -1,7 +1,6 @@
 package rpc
 
 import (
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 )
@@ -13,18 +12,111 @@ const (
 	MSG_UPDATE_PROFILE = 3
 	MSG_LOGOUT         = 4
 	MSG_HEARTBEAT      = 5
+	MSG_REGISTER       = 6
+
+	// 会话管理
+	MSG_LIST_SESSIONS       = 7
+	MSG_REVOKE_SESSION      = 8
+	MSG_REVOKE_ALL_SESSIONS = 9
+
+	// 两步验证
+	MSG_LOGIN_2FA    = 10
+	MSG_TOTP_SETUP   = 11
+	MSG_TOTP_CONFIRM = 12
+	MSG_TOTP_DISABLE = 13
+
+	// 密码管理
+	MSG_CHANGE_PASSWORD        = 14
+	MSG_REQUEST_PASSWORD_RESET = 15
+	MSG_RESET_PASSWORD         = 16
+
+	// JWT令牌
+	MSG_REFRESH_TOKEN = 17
+	MSG_JWKS          = 18
+
+	// 用户管理（需要相应权限）
+	MSG_ADMIN_LIST_USERS      = 19
+	MSG_ADMIN_GET_USER        = 20
+	MSG_ADMIN_UPDATE_USER     = 21
+	MSG_ADMIN_SET_USER_STATUS = 22
+
+	// 用户列表与搜索
+	MSG_LIST_USERS = 23
 
 	// 响应状态
-	STATUS_SUCCESS = 0
-	STATUS_ERROR   = 1
+	STATUS_SUCCESS      = 0
+	STATUS_ERROR        = 1
+	STATUS_RATE_LIMITED = 2 // 请求过于频繁，Payload中可携带重试等待时间
+	STATUS_FORBIDDEN    = 3 // 已登录但缺少所需权限
 )
 
+var messageTypeNames = map[uint32]string{
+	MSG_LOGIN:          "login",
+	MSG_GET_PROFILE:    "get_profile",
+	MSG_UPDATE_PROFILE: "update_profile",
+	MSG_LOGOUT:         "logout",
+	MSG_HEARTBEAT:      "heartbeat",
+	MSG_REGISTER:       "register",
+
+	MSG_LIST_SESSIONS:       "list_sessions",
+	MSG_REVOKE_SESSION:      "revoke_session",
+	MSG_REVOKE_ALL_SESSIONS: "revoke_all_sessions",
+
+	MSG_LOGIN_2FA:    "login_2fa",
+	MSG_TOTP_SETUP:   "totp_setup",
+	MSG_TOTP_CONFIRM: "totp_confirm",
+	MSG_TOTP_DISABLE: "totp_disable",
+
+	MSG_CHANGE_PASSWORD:        "change_password",
+	MSG_REQUEST_PASSWORD_RESET: "request_password_reset",
+	MSG_RESET_PASSWORD:         "reset_password",
+
+	MSG_REFRESH_TOKEN: "refresh_token",
+	MSG_JWKS:          "jwks",
+
+	MSG_ADMIN_LIST_USERS:      "admin_list_users",
+	MSG_ADMIN_GET_USER:        "admin_get_user",
+	MSG_ADMIN_UPDATE_USER:     "admin_update_user",
+	MSG_ADMIN_SET_USER_STATUS: "admin_set_user_status",
+
+	MSG_LIST_USERS: "list_users",
+}
+
+// MessageTypeName 消息类型名称，用于日志
+func MessageTypeName(msgType uint32) string {
+	if name, ok := messageTypeNames[msgType]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", msgType)
+}
+
+// 只读的消息类型，重复执行没有副作用，客户端可以在连接失败后换一个服务端重试
+var idempotentMessages = map[uint32]bool{
+	MSG_GET_PROFILE:      true,
+	MSG_HEARTBEAT:        true,
+	MSG_LIST_SESSIONS:    true,
+	MSG_JWKS:             true,
+	MSG_ADMIN_LIST_USERS: true,
+	MSG_ADMIN_GET_USER:   true,
+	MSG_LIST_USERS:       true,
+}
+
+// IsIdempotent 消息类型是否可以安全重试
+func IsIdempotent(msgType uint32) bool {
+	return idempotentMessages[msgType]
+}
+
 // RPC协议层的结构体
 // RPC消息结构——封装所有HTTP server -> TCP server的请求
 type Message struct {
 	Type    uint32          `json:"type"`    // 确定消息类型，路由到对应的处理函数
 	ID      uint32          `json:"id"`      // 通过ID字段标识每个请求，支持并发处理
-	Payload json.RawMessage `json:"payload"` // Payload字段携带具体的业务数据
+	Payload json.RawMessage `json:"payload"` // Payload字段携带具体的业务数据，编码方式与所在连接的编解码器一致
+
+	RequestID string            `json:"request_id,omitempty"` // HTTP网关生成的请求ID，用于关联两端的日志
+	Metadata  map[string]string `json:"metadata,omitempty"`   // 随请求传递的上下文，如W3C Trace Context的traceparent
+
+	codec Codec // 消息解码时使用的编解码器，不参与序列化
 }
 
 // RPC响应结构: TCP Server返回给HTTP Server的响应，准确的说应该是返回给rpc client的响应
@@ -34,70 +126,62 @@ type Response struct {
 	Status  uint32          `json:"status"`  // 表示操作成功或失败
 	Message string          `json:"message"` // 提供详细的错误描述
 	Payload json.RawMessage `json:"payload"` // 返回业务数据
-}
 
-// 序列化消息
-func (m *Message) Serialize() ([]byte, error) {
-	// 协议的格式 [4字节长度前缀][JSON消息体]
-
-	// 1. 将消息序列化为JSON
-	data, err := json.Marshal(m)
-	if err != nil {
-		return nil, err
-	}
-
-	// 2. 添加4字节长度前缀（大端序）
-	length := uint32(len(data))
-	buf := make([]byte, 4+length)
-	binary.BigEndian.PutUint32(buf[:4], length)
-	copy(buf[4:], data)
+	codec Codec
+}
 
-	return buf, nil
+// 序列化消息（不含长度前缀，分帧由FrameWriter完成）
+func EncodeMessage(codec Codec, m *Message) ([]byte, error) {
+	return codec.Marshal(m)
 }
 
 // 反序列化消息
-func DeserializeMessage(data []byte) (*Message, error) {
-	if len(data) < 4 {
-		return nil, fmt.Errorf("invalid message length")
-	}
-
-	length := binary.BigEndian.Uint32(data[:4])
-	if len(data) < int(4+length) {
-		return nil, fmt.Errorf("incomplete message")
-	}
-
+func DecodeMessage(codec Codec, data []byte) (*Message, error) {
 	var msg Message
-	err := json.Unmarshal(data[4:4+length], &msg)
+	err := codec.Unmarshal(data, &msg)
 	if err != nil {
 		return nil, err
 	}
 
+	msg.codec = codec
 	return &msg, nil
 }
 
 // 序列化响应
-func (r *Response) Serialize() ([]byte, error) {
-	data, err := json.Marshal(r)
-	if err != nil {
-		return nil, err
-	}
-
-	// 添加长度前缀
-	length := uint32(len(data))
-	buf := make([]byte, 4+length)
-	binary.BigEndian.PutUint32(buf[:4], length)
-	copy(buf[4:], data)
-
-	return buf, nil
+func EncodeResponse(codec Codec, r *Response) ([]byte, error) {
+	return codec.Marshal(r)
 }
 
 // 反序列化响应
-func DeserializeResponse(data []byte) (*Response, error) {
+func DecodeResponse(codec Codec, data []byte) (*Response, error) {
 	var resp Response
-	err := json.Unmarshal(data, &resp)
+	err := codec.Unmarshal(data, &resp)
 	if err != nil {
 		return nil, err
 	}
 
+	resp.codec = codec
 	return &resp, nil
 }
+
+// DecodePayload 按消息所在连接的编解码器解析业务数据
+func (m *Message) DecodePayload(v interface{}) error {
+	return codecOrDefault(m.codec).Unmarshal(m.Payload, v)
+}
+
+// EncodePayload 按请求所在连接的编解码器序列化响应的业务数据
+func (m *Message) EncodePayload(v interface{}) ([]byte, error) {
+	return codecOrDefault(m.codec).Marshal(v)
+}
+
+// DecodePayload 解析响应中的业务数据
+func (r *Response) DecodePayload(v interface{}) error {
+	return codecOrDefault(r.codec).Unmarshal(r.Payload, v)
+}
+
+func codecOrDefault(codec Codec) Codec {
+	if codec == nil {
+		return DefaultCodec
+	}
+	return codec
+}
@@ -0,0 +1,218 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的自签名CA，签发的证书写入dir
+type testCA struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &testCA{dir: dir, cert: cert, key: key, file: filepath.Join(dir, name+".pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue 签发证书，返回证书和私钥文件路径
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(ca.dir, name+".pem")
+	keyFile := filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake 通过本机TCP连接完成一次TLS握手，返回服务端一侧的结果
+// TLS 1.3中客户端可能先于服务端完成握手，客户端证书被拒绝只体现在服务端
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) error {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		client := tls.Client(conn, clientConfig)
+		if client.Handshake() == nil {
+			// 等待服务端的数据或告警
+			client.Read(make([]byte, 1))
+		}
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	server := tls.Server(conn, serverConfig)
+	if err := server.Handshake(); err != nil {
+		return err
+	}
+	server.Write([]byte{0})
+	return nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	otherCA := newTestCA(t, dir, "other-ca")
+
+	serverCert, serverKey := ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+	gatewayCert, gatewayKey := ca.issue(t, "gateway", x509.ExtKeyUsageClientAuth)
+	intruderCert, intruderKey := ca.issue(t, "intruder", x509.ExtKeyUsageClientAuth)
+	foreignCert, foreignKey := otherCA.issue(t, "gateway-foreign", x509.ExtKeyUsageClientAuth)
+
+	serverConfig, err := ServerTLSConfig(serverCert, serverKey, ca.file, []string{"gateway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := func(certFile, keyFile string) *tls.Config {
+		t.Helper()
+		cfg, err := ClientTLSConfig(ca.file, certFile, keyFile, "localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name    string
+		client  *tls.Config
+		wantErr bool
+	}{
+		{"allowed gateway", client(gatewayCert, gatewayKey), false},
+		{"no client certificate", client("", ""), true},
+		{"signed by another CA", client(foreignCert, foreignKey), true},
+		{"name not in allowed clients", client(intruderCert, intruderKey), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handshake(t, serverConfig, tt.client)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 未设置白名单时，CA签发的任何客户端证书都可以连接
+	openConfig, err := ServerTLSConfig(serverCert, serverKey, ca.file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(t, openConfig, client(intruderCert, intruderKey)); err != nil {
+		t.Errorf("without allowed clients: %v", err)
+	}
+
+	// 客户端不信任服务端证书的签发者
+	untrusting, err := ClientTLSConfig(otherCA.file, gatewayCert, gatewayKey, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(t, serverConfig, untrusting); err == nil {
+		t.Error("client accepted a server certificate from an untrusted CA")
+	}
+}
+
+func TestVerifyClientName(t *testing.T) {
+	verify := verifyClientName([]string{"gateway", "gateway-2.internal"})
+
+	chain := func(cn string, dnsNames ...string) [][]*x509.Certificate {
+		return [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}}}
+	}
+	if err := verify(nil, chain("gateway")); err != nil {
+		t.Errorf("CN match: %v", err)
+	}
+	if err := verify(nil, chain("something", "gateway-2.internal")); err != nil {
+		t.Errorf("DNS SAN match: %v", err)
+	}
+	if err := verify(nil, chain("intruder", "intruder.internal")); err == nil {
+		t.Error("unlisted client accepted")
+	}
+	if err := verify(nil, nil); err == nil {
+		t.Error("missing verified chain accepted")
+	}
+	if verifyClientName(nil) != nil {
+		t.Error("empty allow list should not install a verifier")
+	}
+}
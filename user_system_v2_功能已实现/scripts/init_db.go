@@ -1,12 +1,12 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"log"
 	"time"
 	
+	"user_system_v1/auth"
 	"user_system_v1/config"
 	"user_system_v1/database"
 )
@@ -16,7 +16,10 @@ func main() {
 	fmt.Println("================")
 	
 	// 加载配置
-	cfg := config.LoadConfig()
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 	
 	// 连接数据库
 	mysqlDB, err := database.NewMySQLDB(cfg)
@@ -33,9 +36,9 @@ func main() {
 	defer redisDB.Close()
 	
 	// 创建表
-	fmt.Println("创建数据库表...")
-	if err := mysqlDB.CreateTables(); err != nil {
-		log.Fatalf("Failed to create tables: %v", err)
+	fmt.Println("执行数据库迁移...")
+	if _, err := mysqlDB.Migrate(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
 	}
 	fmt.Println("✓ 数据库表创建成功")
 	
@@ -65,10 +68,15 @@ func main() {
 	}
 	
 	// 插入测试数据
+	hasher, err := auth.NewPasswordHasher(cfg.PasswordHashAlgorithm)
+	if err != nil {
+		log.Fatalf("Failed to create password hasher: %v", err)
+	}
+	
 	fmt.Println("开始插入测试数据...")
 	start := time.Now()
 	
-	if err := mysqlDB.InsertTestUsers(10000000); err != nil {
+	if err := mysqlDB.InsertTestUsers(10000000, hasher); err != nil {
 		log.Fatalf("Failed to insert test users: %v", err)
 	}
 	
@@ -87,7 +95,7 @@ func main() {
 	// 测试几个用户
 	fmt.Println("测试用户数据:")
 	for i := 1; i <= 5; i++ {
-		user, err := mysqlDB.GetUserByUsername(fmt.Sprintf("user_%d", i))
+		user, err := mysqlDB.GetUserByUsername(context.Background(), fmt.Sprintf("user_%d", i))
 		if err != nil {
 			log.Printf("Failed to get user_%d: %v", i, err)
 			continue
@@ -113,9 +121,3 @@ func clearExistingData(mysqlDB *database.MySQLDB) error {
 	fmt.Println("请手动执行: DELETE FROM users;")
 	return nil
 }
-
-// 生成密码哈希（用于测试）
-func hashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
-} 
\ No newline at end of file
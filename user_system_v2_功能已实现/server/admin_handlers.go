@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"user_system_v1/database"
+	"user_system_v1/models"
+)
+
+type adminListUsersRequest struct {
+	tokenPayload
+	models.ListUsersRequest
+}
+
+// 分页列出用户并附带角色，分页和搜索方式与handleListUsers相同
+func (s *TCPServer) handleAdminListUsers(c *RPCContext, req *adminListUsersRequest) (*Result, error) {
+	users, nextCursor, err := s.listUsers(c, &req.ListUsersRequest)
+	if errors.Is(err, errInvalidCursor) {
+		return fail("无效的分页游标", nil)
+	}
+	if err != nil {
+		return fail("获取用户列表失败", err)
+	}
+
+	userIDs := make([]int64, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+	roles, err := s.users.GetRolesForUsers(c, userIDs)
+	if err != nil {
+		return fail("获取用户列表失败", err)
+	}
+
+	adminUsers := make([]*models.AdminUser, 0, len(users))
+	for _, user := range users {
+		adminUsers = append(adminUsers, newAdminUser(user, roles[user.ID]))
+	}
+
+	return success("获取成功", &models.AdminListUsersResponse{
+		Success:    true,
+		Message:    "获取成功",
+		Users:      adminUsers,
+		NextCursor: nextCursor,
+	})
+}
+
+type adminUserRequest struct {
+	tokenPayload
+	models.AdminUserRequest
+}
+
+func (s *TCPServer) handleAdminGetUser(c *RPCContext, req *adminUserRequest) (*Result, error) {
+	user, err := s.users.GetUserByID(c, req.UserID)
+	if err != nil {
+		return adminUserLookupFailed(err)
+	}
+
+	return s.adminUserResult(c, "获取成功", user)
+}
+
+type adminUpdateUserRequest struct {
+	tokenPayload
+	models.AdminUpdateUserRequest
+}
+
+// 修改用户资料和角色。角色和权限随会话保存，角色变更后注销该用户的所有会话，重新登录后生效
+func (s *TCPServer) handleAdminUpdateUser(c *RPCContext, req *adminUpdateUserRequest) (*Result, error) {
+	user, err := s.users.GetUserByID(c, req.UserID)
+	if err != nil {
+		return adminUserLookupFailed(err)
+	}
+
+	if req.Nickname != nil || req.ProfilePic != nil {
+		nickname, profilePic := user.Nickname, user.ProfilePic
+		if req.Nickname != nil {
+			nickname = *req.Nickname
+		}
+		if req.ProfilePic != nil {
+			profilePic = *req.ProfilePic
+		}
+		if err := s.users.UpdateUser(c, user.ID, nickname, profilePic); err != nil {
+			return fail("更新失败", err)
+		}
+		s.invalidateProfile(c, user.ID)
+	}
+
+	if req.Roles != nil {
+		before, _, err := s.users.GetUserRoles(c, user.ID)
+		if err != nil {
+			return fail("更新失败", err)
+		}
+		if err := s.users.SetUserRoles(c, user.ID, *req.Roles); err != nil {
+			if errors.Is(err, database.ErrUnknownRole) {
+				return fail("角色不存在", nil)
+			}
+			return fail("更新失败", err)
+		}
+		// 否则已登录的会话（包括刷新令牌换出的新令牌）仍带着旧的角色和权限
+		if !sameRoles(before, *req.Roles) {
+			if err := s.sessions.DeleteUserSessions(c, user.ID); err != nil {
+				return fail("角色已更新，但注销该用户的会话失败", err)
+			}
+		}
+	}
+
+	user, err = s.users.GetUserByID(c, user.ID)
+	if err != nil {
+		return fail("获取更新后的信息失败", err)
+	}
+
+	return s.adminUserResult(c, "更新成功", user)
+}
+
+// 两组角色是否相同，不考虑顺序和重复
+func sameRoles(a, b []string) bool {
+	seen := make(map[string]bool, len(a))
+	for _, role := range a {
+		seen[role] = false
+	}
+	for _, role := range b {
+		if _, ok := seen[role]; !ok {
+			return false
+		}
+		seen[role] = true
+	}
+	for _, ok := range seen {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type adminSetUserStatusRequest struct {
+	tokenPayload
+	models.AdminSetUserStatusRequest
+}
+
+// 禁用或启用用户，禁用时注销该用户的所有会话
+func (s *TCPServer) handleAdminSetUserStatus(c *RPCContext, req *adminSetUserStatusRequest) (*Result, error) {
+	if req.Status != models.UserStatusActive && req.Status != models.UserStatusDisabled {
+		return fail("无效的用户状态", nil)
+	}
+	if req.UserID == c.UserID && req.Status == models.UserStatusDisabled {
+		return fail("不能禁用自己", nil)
+	}
+
+	if err := s.users.SetUserStatus(c, req.UserID, req.Status); err != nil {
+		return adminUserLookupFailed(err)
+	}
+	s.invalidateProfile(c, req.UserID)
+
+	if req.Status == models.UserStatusDisabled {
+		if err := s.sessions.DeleteUserSessions(c, req.UserID); err != nil {
+			return fail("用户已禁用，但注销其会话失败", err)
+		}
+	}
+
+	user, err := s.users.GetUserByID(c, req.UserID)
+	if err != nil {
+		return fail("获取更新后的信息失败", err)
+	}
+
+	return s.adminUserResult(c, "更新成功", user)
+}
+
+// 查询用户失败：用户不存在或数据库错误
+func adminUserLookupFailed(err error) (*Result, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fail("用户不存在", nil)
+	}
+	return fail("获取用户信息失败", err)
+}
+
+func newAdminUser(user *models.User, roles []string) *models.AdminUser {
+	if roles == nil {
+		roles = []string{}
+	}
+	return &models.AdminUser{User: *user, Roles: roles}
+}
+
+func (s *TCPServer) adminUserResult(ctx context.Context, message string, user *models.User) (*Result, error) {
+	roles, _, err := s.users.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return fail("获取用户信息失败", err)
+	}
+
+	return success(message, &models.AdminUserResponse{
+		Success: true,
+		Message: message,
+		User:    newAdminUser(user, roles),
+	})
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// readinessTimeout 单次就绪检查中每项依赖的超时时间
+const readinessTimeout = 2 * time.Second
+
+// HealthCheck 检查一项依赖是否可用，返回nil表示可用
+type HealthCheck func(ctx context.Context) error
+
+type readinessCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// checkResult 就绪检查中一项依赖的结果
+type checkResult struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// health 存活与就绪检查，HTTP网关和OpsServer共用
+type health struct {
+	mutex    sync.Mutex
+	draining bool // 开始关闭后就绪检查返回503
+	checks   []readinessCheck
+}
+
+func (h *health) add(name string, check HealthCheck) {
+	h.checks = append(h.checks, readinessCheck{name: name, check: check})
+}
+
+// drain 标记为正在关闭
+func (h *health) drain() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.draining = true
+}
+
+func (h *health) isDraining() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.draining
+}
+
+// routes 注册健康检查路由，/api/health 与 /api/health/live 相同
+func (h *health) routes(router *mux.Router) {
+	router.HandleFunc("/api/health", h.handleLive).Methods("GET")
+	router.HandleFunc("/api/health/live", h.handleLive).Methods("GET")
+	router.HandleFunc("/api/health/ready", h.handleReady).Methods("GET")
+}
+
+// handleLive 存活检查：进程能处理请求即返回200，不检查依赖，避免依赖故障时进程被反复重启
+func (h *health) handleLive(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// handleReady 就绪检查：并发检查各项依赖，任一不可用或正在关闭时返回503，负载均衡据此摘除实例
+func (h *health) handleReady(w http.ResponseWriter, r *http.Request) {
+	if h.isDraining() {
+		writeHealth(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":    "shutting_down",
+			"timestamp": time.Now().Unix(),
+		})
+		return
+	}
+
+	results := make(map[string]*checkResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, rc := range h.checks {
+		wg.Add(1)
+		go func(rc readinessCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			defer cancel()
+			start := time.Now()
+			err := rc.check(ctx)
+
+			result := &checkResult{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "unavailable"
+				result.Error = err.Error()
+				slog.WarnContext(r.Context(), "Readiness check failed", "check", rc.name, "error", err)
+			}
+			mu.Lock()
+			results[rc.name] = result
+			mu.Unlock()
+		}(rc)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, code, map[string]interface{}{
+		"status":    status,
+		"checks":    results,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+func writeHealth(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
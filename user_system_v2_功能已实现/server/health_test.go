@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"user_system_v1/config"
+)
+
+func TestReadiness(t *testing.T) {
+	cfg := config.Default()
+	cfg.UploadDir = t.TempDir()
+	s := NewHTTPServer(cfg, nil)
+	s.AddReadinessCheck("mysql", func(ctx context.Context) error { return nil })
+	s.AddReadinessCheck("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	get := func(path string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return rec.Code, body
+	}
+
+	if code, _ := get("/api/health/live"); code != http.StatusOK {
+		t.Fatalf("live: status %d", code)
+	}
+
+	code, body := get("/api/health/ready")
+	checks := body["checks"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || body["status"] != "unavailable" {
+		t.Fatalf("ready with a failing dependency: status %d, body %v", code, body)
+	}
+	if checks["mysql"].(map[string]interface{})["status"] != "ok" || checks["redis"].(map[string]interface{})["status"] != "unavailable" {
+		t.Fatalf("unexpected checks: %v", checks)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := get("/api/health/ready"); code != http.StatusServiceUnavailable || body["status"] != "shutting_down" {
+		t.Fatalf("ready while shutting down: status %d, body %v", code, body)
+	}
+	if code, _ := get("/api/health/live"); code != http.StatusOK {
+		t.Fatalf("live while shutting down: status %d", code)
+	}
+}
@@ -1,41 +1,61 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"user_system_v1/client"
+	"user_system_v1/config"
+	"user_system_v1/metrics"
 	"user_system_v1/models"
 )
 
 type HTTPServer struct {
-	rpcClient *client.RPCClient
-	router    *mux.Router
-	uploadDir string
+	rpcClient     *client.RPCClient
+	router        *mux.Router
+	uploadDir     string
+	uploadMaxSize int64 // 字节
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+
+	srv    *http.Server
+	mutex  sync.Mutex
+	health health
 }
 
-func NewHTTPServer(rpcClient *client.RPCClient) *HTTPServer {
+func NewHTTPServer(cfg *config.Config, rpcClient *client.RPCClient) *HTTPServer {
 	// 创建上传目录
-	uploadDir := "uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Printf("Failed to create upload directory: %v", err)
+	if err := os.MkdirAll(cfg.UploadDir, 0755); err != nil {
+		slog.Error("Failed to create upload directory", "dir", cfg.UploadDir, "error", err)
 	}
 
 	server := &HTTPServer{
-		rpcClient: rpcClient,
-		router:    mux.NewRouter(),
-		uploadDir: uploadDir,
+		rpcClient:     rpcClient,
+		router:        mux.NewRouter(),
+		uploadDir:     cfg.UploadDir,
+		uploadMaxSize: cfg.UploadMaxSize,
+		readTimeout:   time.Duration(cfg.HTTPReadTimeout) * time.Second,
+		writeTimeout:  time.Duration(cfg.HTTPWriteTimeout) * time.Second,
+		idleTimeout:   time.Duration(cfg.HTTPIdleTimeout) * time.Second,
 	}
 
 	server.setupRoutes()
+	server.router.Use(httpTracing, httpMetrics)
 	return server
 }
 
@@ -44,36 +64,90 @@ func (s *HTTPServer) setupRoutes() {
 	s.router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
 	// 头像文件服务
-	s.router.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
+	s.router.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir(s.uploadDir))))
+
+	// Prometheus指标
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// 健康检查
+	s.health.routes(s.router)
 
 	// API路由
 	api := s.router.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/health", s.handleHealth).Methods("GET")
 	api.HandleFunc("/login", s.handleLogin).Methods("POST")
+	api.HandleFunc("/login/2fa", s.handleLogin2FA).Methods("POST")
+	api.HandleFunc("/token/refresh", s.handleRefreshToken).Methods("POST")
+	api.HandleFunc("/register", s.handleRegister).Methods("POST")
 	api.HandleFunc("/profile", s.handleGetProfile).Methods("GET")
 	api.HandleFunc("/profile", s.handleUpdateProfile).Methods("PUT")
 	api.HandleFunc("/logout", s.handleLogout).Methods("POST")
 	api.HandleFunc("/update-info", s.handleUpdateInfo).Methods("POST")
+	api.HandleFunc("/sessions", s.handleListSessions).Methods("GET")
+	api.HandleFunc("/sessions", s.handleRevokeAllSessions).Methods("DELETE")
+	api.HandleFunc("/sessions/{id}", s.handleRevokeSession).Methods("DELETE")
+	api.HandleFunc("/2fa/setup", s.handleTOTPSetup).Methods("POST")
+	api.HandleFunc("/2fa/confirm", s.handleTOTPConfirm).Methods("POST")
+	api.HandleFunc("/2fa/disable", s.handleTOTPDisable).Methods("POST")
+	api.HandleFunc("/password", s.handleChangePassword).Methods("POST")
+	api.HandleFunc("/password/forgot", s.handleForgotPassword).Methods("POST")
+	api.HandleFunc("/password/reset", s.handleResetPassword).Methods("POST")
+
+	// 管理接口
+	api.HandleFunc("/users", s.handleListUsers).Methods("GET")
+	api.HandleFunc("/admin/users", s.handleAdminListUsers).Methods("GET")
+	api.HandleFunc("/admin/users/{id:[0-9]+}", s.handleAdminGetUser).Methods("GET")
+	api.HandleFunc("/admin/users/{id:[0-9]+}", s.handleAdminUpdateUser).Methods("PUT")
+	api.HandleFunc("/admin/users/{id:[0-9]+}/disable", s.handleAdminSetUserStatus(models.UserStatusDisabled)).Methods("POST")
+	api.HandleFunc("/admin/users/{id:[0-9]+}/enable", s.handleAdminSetUserStatus(models.UserStatusActive)).Methods("POST")
 
 	// 页面路由
+	s.router.HandleFunc("/.well-known/jwks.json", s.handleJWKS).Methods("GET")
 	s.router.HandleFunc("/", s.handleIndex).Methods("GET")
 	s.router.HandleFunc("/login", s.handleLoginPage).Methods("GET")
 	s.router.HandleFunc("/profile", s.handleProfilePage).Methods("GET")
 }
 
+// Start 启动HTTP服务器，Shutdown后返回nil
 func (s *HTTPServer) Start(port string) error {
-	log.Printf("HTTP Server started on port %s", port)
-	return http.ListenAndServe(":"+port, s.router)
+	srv := &http.Server{
+		Addr:         ":" + port,
+		Handler:      requestLogging(s.router),
+		ReadTimeout:  s.readTimeout,
+		WriteTimeout: s.writeTimeout,
+		IdleTimeout:  s.idleTimeout,
+	}
+
+	s.mutex.Lock()
+	if s.health.isDraining() {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.srv = srv
+	s.mutex.Unlock()
+
+	slog.Info("HTTP Server started", "port", port)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
-// 健康检查端点
-func (s *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":    "ok",
-		"timestamp": time.Now().Unix(),
-	})
+// AddReadinessCheck 添加就绪检查的依赖，如MySQL、Redis和RPC后端；需在Start之前调用
+func (s *HTTPServer) AddReadinessCheck(name string, check HealthCheck) {
+	s.health.add(name, check)
+}
+
+// Shutdown 停止接受新请求并等待处理中的请求完成，ctx到期时返回其错误
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.health.drain()
+	srv := s.srv
+	s.mutex.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
 }
 
 // 处理首页
@@ -109,9 +183,31 @@ func (s *HTTPServer) handleIndex(w http.ResponseWriter, r *http.Request) {
                 <input type="password" id="password" placeholder="输入密码">
             </div>
             <button onclick="login()">登录</button>
+            <button onclick="register()">注册</button>
+            <button onclick="forgotPassword()">忘记密码</button>
             <div id="loginMessage"></div>
         </div>
         
+        <div id="resetForm" style="display:none;">
+            <h2>重置密码</h2>
+            <div class="form-group">
+                <label>新密码:</label>
+                <input type="password" id="resetPassword" placeholder="8-72位，需同时包含字母和数字">
+            </div>
+            <button onclick="resetPassword()">重置密码</button>
+            <div id="resetMessage"></div>
+        </div>
+        
+        <div id="twoFactorForm" style="display:none;">
+            <h2>两步验证</h2>
+            <div class="form-group">
+                <label>验证码:</label>
+                <input type="text" id="twoFactorCode" placeholder="输入验证器App中的6位验证码或恢复码">
+            </div>
+            <button onclick="login2fa()">验证</button>
+            <div id="twoFactorMessage"></div>
+        </div>
+        
         <div id="profileForm" style="display:none;">
             <h2>用户信息</h2>
             <div class="form-group">
@@ -134,12 +230,120 @@ func (s *HTTPServer) handleIndex(w http.ResponseWriter, r *http.Request) {
             </div>
             <button onclick="updateInfo()">更新信息</button>
             <button onclick="logout()">登出</button>
+            <button onclick="logoutAll()">退出所有设备</button>
             <div id="profileMessage"></div>
+            
+            <h2>两步验证</h2>
+            <button onclick="setupTOTP()">开启两步验证</button>
+            <button onclick="disableTOTP()">关闭两步验证</button>
+            <div id="totpSetup" style="display:none;">
+                <p>在验证器App中添加以下密钥，或使用该链接生成二维码：</p>
+                <div class="form-group">
+                    <label>密钥:</label>
+                    <input type="text" id="totpSecret" readonly>
+                </div>
+                <div class="form-group">
+                    <label>链接:</label>
+                    <input type="text" id="totpURI" readonly>
+                </div>
+                <div class="form-group">
+                    <label>验证码:</label>
+                    <input type="text" id="totpCode" placeholder="输入验证器App中的6位验证码">
+                </div>
+                <button onclick="confirmTOTP()">确认开启</button>
+            </div>
+            <div id="totpMessage"></div>
+            
+            <h2>修改密码</h2>
+            <div class="form-group">
+                <label>当前密码:</label>
+                <input type="password" id="currentPassword">
+            </div>
+            <div class="form-group">
+                <label>新密码:</label>
+                <input type="password" id="newPassword" placeholder="8-72位，需同时包含字母和数字">
+            </div>
+            <button onclick="changePassword()">修改密码</button>
+            <div id="passwordMessage"></div>
         </div>
     </div>
     
     <script>
         let currentToken = '';
+        let challengeToken = '';
+        let refreshToken = '';
+        let refreshTimer = null;
+        
+        // 从通知中的重置链接打开页面时显示重置表单
+        const resetToken = new URLSearchParams(window.location.search).get('reset_token');
+        if (resetToken) {
+            document.getElementById('loginForm').style.display = 'none';
+            document.getElementById('resetForm').style.display = 'block';
+        }
+        
+        async function forgotPassword() {
+            const username = document.getElementById('username').value;
+            if (!username) {
+                document.getElementById('loginMessage').innerHTML = '<span class="error">请先输入用户名</span>';
+                return;
+            }
+            
+            const response = await fetch('/api/password/forgot', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: JSON.stringify({username})
+            });
+            
+            const result = await response.json();
+            const cls = result.success ? 'success' : 'error';
+            document.getElementById('loginMessage').innerHTML = '<span class="' + cls + '">' + result.message + '</span>';
+        }
+        
+        async function resetPassword() {
+            const newPassword = document.getElementById('resetPassword').value;
+            
+            const response = await fetch('/api/password/reset', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: JSON.stringify({reset_token: resetToken, new_password: newPassword})
+            });
+            
+            const result = await response.json();
+            
+            if (result.success) {
+                // 重置链接只能使用一次，回到登录表单
+                history.replaceState(null, '', '/');
+                document.getElementById('resetForm').style.display = 'none';
+                document.getElementById('loginForm').style.display = 'block';
+                document.getElementById('loginMessage').innerHTML = '<span class="success">' + result.message + '</span>';
+            } else {
+                document.getElementById('resetMessage').innerHTML = '<span class="error">' + result.message + '</span>';
+            }
+        }
+        
+        async function changePassword() {
+            const currentPassword = document.getElementById('currentPassword').value;
+            const newPassword = document.getElementById('newPassword').value;
+            
+            const response = await fetch('/api/password', {
+                method: 'POST',
+                headers: {
+                    'Authorization': 'Bearer ' + currentToken,
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({current_password: currentPassword, new_password: newPassword})
+            });
+            
+            const result = await response.json();
+            
+            if (result.success) {
+                // 修改密码后所有会话失效，需要重新登录
+                resetLogin();
+                document.getElementById('loginMessage').innerHTML = '<span class="success">' + result.message + '</span>';
+            } else {
+                document.getElementById('passwordMessage').innerHTML = '<span class="error">' + result.message + '</span>';
+            }
+        }
         
         async function login() {
             const username = document.getElementById('username').value;
@@ -153,20 +357,166 @@ func (s *HTTPServer) handleIndex(w http.ResponseWriter, r *http.Request) {
             
             const result = await response.json();
             
+            if (result.two_factor_required) {
+                // 密码正确，继续输入两步验证码
+                challengeToken = result.challenge_token;
+                document.getElementById('loginForm').style.display = 'none';
+                document.getElementById('twoFactorForm').style.display = 'block';
+                document.getElementById('twoFactorCode').value = '';
+                document.getElementById('twoFactorMessage').innerHTML = '';
+            } else if (result.success) {
+                showProfile(result);
+            } else {
+                document.getElementById('loginMessage').innerHTML = '<span class="error">' + result.message + '</span>';
+            }
+        }
+        
+        async function login2fa() {
+            const code = document.getElementById('twoFactorCode').value.trim();
+            
+            const response = await fetch('/api/login/2fa', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: JSON.stringify({challenge_token: challengeToken, code})
+            });
+            
+            const result = await response.json();
+            
+            if (result.success) {
+                challengeToken = '';
+                document.getElementById('twoFactorForm').style.display = 'none';
+                showProfile(result);
+            } else {
+                document.getElementById('twoFactorMessage').innerHTML = '<span class="error">' + result.message + '</span>';
+            }
+        }
+        
+        function showProfile(result) {
+            currentToken = result.token;
+            scheduleRefresh(result);
+            document.getElementById('loginForm').style.display = 'none';
+            document.getElementById('profileForm').style.display = 'block';
+            document.getElementById('displayUsername').value = result.user.username;
+            document.getElementById('nickname').value = result.user.nickname || '';
+            // 显示现有头像
+            if (result.user.profile_pic) {
+                document.getElementById('avatarImage').src = result.user.profile_pic;
+                document.getElementById('avatarImage').style.display = 'block';
+            } else {
+                document.getElementById('avatarImage').style.display = 'none';
+            }
+            document.getElementById('loginMessage').innerHTML = '<span class="success">登录成功!</span>';
+        }
+        
+        // JWT模式下在访问令牌过期前用刷新令牌换取新的令牌对
+        function scheduleRefresh(result) {
+            clearTimeout(refreshTimer);
+            refreshToken = result.refresh_token || '';
+            if (!refreshToken) {
+                return;
+            }
+            const delay = Math.max(result.expires_in - 60, 10) * 1000;
+            refreshTimer = setTimeout(refreshTokens, delay);
+        }
+        
+        async function refreshTokens() {
+            const response = await fetch('/api/token/refresh', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: JSON.stringify({refresh_token: refreshToken})
+            });
+            
+            const result = await response.json();
+            
             if (result.success) {
                 currentToken = result.token;
-                document.getElementById('loginForm').style.display = 'none';
-                document.getElementById('profileForm').style.display = 'block';
-                document.getElementById('displayUsername').value = result.user.username;
-                document.getElementById('nickname').value = result.user.nickname || '';
-                // 显示现有头像
-                if (result.user.profile_pic) {
-                    document.getElementById('avatarImage').src = result.user.profile_pic;
-                    document.getElementById('avatarImage').style.display = 'block';
-                } else {
-                    document.getElementById('avatarImage').style.display = 'none';
+                scheduleRefresh(result);
+            } else {
+                resetLogin();
+                document.getElementById('loginMessage').innerHTML = '<span class="error">' + result.message + '</span>';
+            }
+        }
+        
+        async function setupTOTP() {
+            const response = await fetch('/api/2fa/setup', {
+                method: 'POST',
+                headers: {
+                    'Authorization': 'Bearer ' + currentToken
                 }
-                document.getElementById('loginMessage').innerHTML = '<span class="success">登录成功!</span>';
+            });
+            
+            const result = await response.json();
+            
+            if (result.success) {
+                document.getElementById('totpSecret').value = result.secret;
+                document.getElementById('totpURI').value = result.otpauth_uri;
+                document.getElementById('totpCode').value = '';
+                document.getElementById('totpSetup').style.display = 'block';
+                document.getElementById('totpMessage').innerHTML = '';
+            } else {
+                document.getElementById('totpMessage').innerHTML = '<span class="error">' + result.message + '</span>';
+            }
+        }
+        
+        async function confirmTOTP() {
+            const code = document.getElementById('totpCode').value.trim();
+            
+            const response = await fetch('/api/2fa/confirm', {
+                method: 'POST',
+                headers: {
+                    'Authorization': 'Bearer ' + currentToken,
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({code})
+            });
+            
+            const result = await response.json();
+            
+            if (result.success) {
+                document.getElementById('totpSetup').style.display = 'none';
+                // 恢复码只显示这一次
+                document.getElementById('totpMessage').innerHTML = '<span class="success">' + result.message + '</span>' +
+                    '<pre>' + result.recovery_codes.join('\n') + '</pre>';
+            } else {
+                document.getElementById('totpMessage').innerHTML = '<span class="error">' + result.message + '</span>';
+            }
+        }
+        
+        async function disableTOTP() {
+            const code = prompt('请输入验证码或恢复码');
+            if (!code) {
+                return;
+            }
+            
+            const response = await fetch('/api/2fa/disable', {
+                method: 'POST',
+                headers: {
+                    'Authorization': 'Bearer ' + currentToken,
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({code: code.trim()})
+            });
+            
+            const result = await response.json();
+            const cls = result.success ? 'success' : 'error';
+            document.getElementById('totpMessage').innerHTML = '<span class="' + cls + '">' + result.message + '</span>';
+        }
+        
+        async function register() {
+            const username = document.getElementById('username').value;
+            const password = document.getElementById('password').value;
+            
+            const response = await fetch('/api/register', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: JSON.stringify({username, password})
+            });
+            
+            const result = await response.json();
+            
+            if (result.success) {
+                // 注册成功后直接登录
+                await login();
             } else {
                 document.getElementById('loginMessage').innerHTML = '<span class="error">' + result.message + '</span>';
             }
@@ -249,12 +599,34 @@ func (s *HTTPServer) handleIndex(w http.ResponseWriter, r *http.Request) {
                 }
             });
             
+            resetLogin();
+        }
+        
+        async function logoutAll() {
+            await fetch('/api/sessions', {
+                method: 'DELETE',
+                headers: {
+                    'Authorization': 'Bearer ' + currentToken
+                }
+            });
+            
+            resetLogin();
+        }
+        
+        function resetLogin() {
             currentToken = '';
+            refreshToken = '';
+            clearTimeout(refreshTimer);
             document.getElementById('loginForm').style.display = 'block';
             document.getElementById('profileForm').style.display = 'none';
             document.getElementById('username').value = '';
             document.getElementById('password').value = '';
             document.getElementById('loginMessage').innerHTML = '';
+            document.getElementById('totpSetup').style.display = 'none';
+            document.getElementById('totpMessage').innerHTML = '';
+            document.getElementById('currentPassword').value = '';
+            document.getElementById('newPassword').value = '';
+            document.getElementById('passwordMessage').innerHTML = '';
         }
     </script>
 </body>
@@ -279,17 +651,17 @@ func (s *HTTPServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 	// 解析HTTP请求
 	var loginReq models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		log.Printf("Failed to decode login request: %v", err)
+		slog.InfoContext(r.Context(), "Failed to decode login request", "error", err)
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Login attempt for user: %s", loginReq.Username)
+	slog.InfoContext(r.Context(), "Login attempt", "username", loginReq.Username)
 
 	// 调用RPC服务
-	loginResp, err := s.rpcClient.Login(loginReq.Username, loginReq.Password)
+	loginResp, err := s.rpcClient.Login(r.Context(), loginReq.Username, loginReq.Password, clientInfo(r))
 	if err != nil {
-		log.Printf("RPC login failed: %v", err)
+		slog.ErrorContext(r.Context(), "RPC login failed", "error", err)
 
 		// 返回更友好的错误信息
 		errorResp := map[string]interface{}{
@@ -303,12 +675,106 @@ func (s *HTTPServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Login result: success=%v, message=%s", loginResp.Success, loginResp.Message)
+	slog.InfoContext(r.Context(), "Login result", "username", loginReq.Username, "success", loginResp.Success, "message", loginResp.Message)
 
+	writeLoginResponse(w, loginResp)
+}
+
+// 处理两步登录API
+func (s *HTTPServer) handleLogin2FA(w http.ResponseWriter, r *http.Request) {
+	var twoFactorReq models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&twoFactorReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// 调用RPC服务
+	loginResp, err := s.rpcClient.Login2FA(r.Context(), twoFactorReq.ChallengeToken, twoFactorReq.Code)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "RPC 2FA login failed", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeLoginResponse(w, loginResp)
+}
+
+// 处理刷新令牌API（JWT模式）
+func (s *HTTPServer) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refreshReq models.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&refreshReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// 调用RPC服务
+	refreshResp, err := s.rpcClient.RefreshToken(r.Context(), refreshReq.RefreshToken)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !refreshResp.Success {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	json.NewEncoder(w).Encode(refreshResp)
+}
+
+// 处理JWKS请求，其他服务据此校验访问令牌
+func (s *HTTPServer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	jwks, err := s.rpcClient.JWKS(r.Context())
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(jwks)
+}
+
+// 登录被限制时返回429及Retry-After
+func writeLoginResponse(w http.ResponseWriter, loginResp *models.LoginResponse) {
 	w.Header().Set("Content-Type", "application/json")
+	if loginResp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(loginResp.RetryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
 	json.NewEncoder(w).Encode(loginResp)
 }
 
+// 处理注册API
+func (s *HTTPServer) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var registerReq models.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&registerReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Register attempt", "username", registerReq.Username)
+
+	// 调用RPC服务
+	registerResp, err := s.rpcClient.Register(r.Context(), registerReq.Username, registerReq.Password, registerReq.Nickname)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "RPC register failed", "error", err)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "服务器连接失败，请稍后重试",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if registerResp.Success {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(registerResp)
+}
+
 // 处理获取个人资料API
 func (s *HTTPServer) handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	token := extractToken(r)
@@ -318,7 +784,7 @@ func (s *HTTPServer) handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 调用RPC服务
-	profileResp, err := s.rpcClient.GetProfile(token)
+	profileResp, err := s.rpcClient.GetProfile(r.Context(), token)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -343,7 +809,7 @@ func (s *HTTPServer) handleUpdateProfile(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 调用RPC服务
-	updateResp, err := s.rpcClient.UpdateProfile(token, updateReq.Nickname, updateReq.ProfilePic)
+	updateResp, err := s.rpcClient.UpdateProfile(r.Context(), token, updateReq.Nickname, updateReq.ProfilePic)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -376,7 +842,7 @@ func (s *HTTPServer) handleUpdateInfo(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// 先获取用户当前信息
-		currentProfileResp, err := s.rpcClient.GetProfile(token)
+		currentProfileResp, err := s.rpcClient.GetProfile(r.Context(), token)
 		if err != nil {
 			http.Error(w, "Failed to get current profile", http.StatusInternalServerError)
 			return
@@ -402,7 +868,7 @@ func (s *HTTPServer) handleUpdateInfo(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// 调用RPC服务更新用户信息，使用合并后的值
-		updateResp, err := s.rpcClient.UpdateProfile(token, currentNickname, currentProfilePic)
+		updateResp, err := s.rpcClient.UpdateProfile(r.Context(), token, currentNickname, currentProfilePic)
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -415,14 +881,21 @@ func (s *HTTPServer) handleUpdateInfo(w http.ResponseWriter, r *http.Request) {
 
 // 处理带文件上传的更新信息
 func (s *HTTPServer) handleUpdateInfoWithFile(w http.ResponseWriter, r *http.Request, token string) {
-	// 限制文件大小 (5MB)
-	r.ParseMultipartForm(5 << 20)
+	// 限制请求体大小，在头像上限之外为其他表单字段预留1MB
+	r.Body = http.MaxBytesReader(w, r.Body, s.uploadMaxSize+1<<20)
+	if err := r.ParseMultipartForm(5 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
 
 	// 获取昵称
 	nickname := r.FormValue("nickname")
 
 	// 先获取用户当前信息
-	currentProfileResp, err := s.rpcClient.GetProfile(token)
+	currentProfileResp, err := s.rpcClient.GetProfile(r.Context(), token)
 	if err != nil {
 		http.Error(w, "Failed to get current profile", http.StatusInternalServerError)
 		return
@@ -462,9 +935,9 @@ func (s *HTTPServer) handleUpdateInfoWithFile(w http.ResponseWriter, r *http.Req
 			return
 		}
 
-		// 检查文件大小 (限制为2MB)
-		if handler.Size > 2<<20 {
-			http.Error(w, "File too large. Please upload files smaller than 2MB.", http.StatusBadRequest)
+		// 检查文件大小
+		if handler.Size > s.uploadMaxSize {
+			http.Error(w, fmt.Sprintf("File too large. Please upload files smaller than %dKB.", s.uploadMaxSize>>10), http.StatusBadRequest)
 			return
 		}
 
@@ -476,7 +949,7 @@ func (s *HTTPServer) handleUpdateInfoWithFile(w http.ResponseWriter, r *http.Req
 		// 创建文件
 		dst, err := os.Create(filepath)
 		if err != nil {
-			log.Printf("Failed to create file: %v", err)
+			slog.ErrorContext(r.Context(), "Failed to create avatar file", "path", filepath, "error", err)
 			http.Error(w, "Failed to save file", http.StatusInternalServerError)
 			return
 		}
@@ -484,7 +957,7 @@ func (s *HTTPServer) handleUpdateInfoWithFile(w http.ResponseWriter, r *http.Req
 
 		// 复制文件内容
 		if _, err := io.Copy(dst, file); err != nil {
-			log.Printf("Failed to copy file: %v", err)
+			slog.ErrorContext(r.Context(), "Failed to copy avatar file", "path", filepath, "error", err)
 			http.Error(w, "Failed to save file", http.StatusInternalServerError)
 			return
 		}
@@ -494,7 +967,7 @@ func (s *HTTPServer) handleUpdateInfoWithFile(w http.ResponseWriter, r *http.Req
 	}
 
 	// 调用RPC服务更新用户信息，使用合并后的值
-	updateResp, err := s.rpcClient.UpdateProfile(token, currentNickname, currentProfilePic)
+	updateResp, err := s.rpcClient.UpdateProfile(r.Context(), token, currentNickname, currentProfilePic)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -513,7 +986,7 @@ func (s *HTTPServer) handleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 调用RPC服务
-	err := s.rpcClient.Logout(token)
+	err := s.rpcClient.Logout(r.Context(), token)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -526,6 +999,337 @@ func (s *HTTPServer) handleLogout(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// 处理会话列表API
+func (s *HTTPServer) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 调用RPC服务
+	sessionsResp, err := s.rpcClient.ListSessions(r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionsResp)
+}
+
+// 处理注销指定会话API
+func (s *HTTPServer) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 调用RPC服务
+	revokeResp, err := s.rpcClient.RevokeSession(r.Context(), token, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revokeResp)
+}
+
+// 处理退出所有设备API
+func (s *HTTPServer) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 调用RPC服务
+	revokeResp, err := s.rpcClient.RevokeAllSessions(r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revokeResp)
+}
+
+// 处理获取两步验证密钥API
+func (s *HTTPServer) handleTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 调用RPC服务
+	setupResp, err := s.rpcClient.SetupTOTP(r.Context(), token)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(setupResp)
+}
+
+// 处理确认开启两步验证API
+func (s *HTTPServer) handleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var codeReq models.TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&codeReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// 调用RPC服务
+	confirmResp, err := s.rpcClient.ConfirmTOTP(r.Context(), token, codeReq.Code)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(confirmResp)
+}
+
+// 处理关闭两步验证API
+func (s *HTTPServer) handleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var codeReq models.TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&codeReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// 调用RPC服务
+	disableResp, err := s.rpcClient.DisableTOTP(r.Context(), token, codeReq.Code)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(disableResp)
+}
+
+// 处理修改密码API
+func (s *HTTPServer) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var changeReq models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&changeReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// 调用RPC服务
+	changeResp, err := s.rpcClient.ChangePassword(r.Context(), token, changeReq.CurrentPassword, changeReq.NewPassword)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changeResp)
+}
+
+// 处理申请重置密码API
+func (s *HTTPServer) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgotReq models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&forgotReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// 调用RPC服务
+	forgotResp, err := s.rpcClient.RequestPasswordReset(r.Context(), forgotReq.Username)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forgotResp)
+}
+
+// 处理重置密码API
+func (s *HTTPServer) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetReq models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// 调用RPC服务
+	resetResp, err := s.rpcClient.ResetPassword(r.Context(), resetReq.ResetToken, resetReq.NewPassword)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resetResp)
+}
+
+// 处理用户列表与搜索API
+func (s *HTTPServer) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 调用RPC服务
+	listResp, err := s.rpcClient.ListUsers(r.Context(), token, listUsersQuery(r))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listResp)
+}
+
+// 处理管理端用户列表API
+func (s *HTTPServer) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 调用RPC服务
+	listResp, err := s.rpcClient.AdminListUsers(r.Context(), token, listUsersQuery(r))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listResp)
+}
+
+// listUsersQuery 从查询参数 q、match、cursor、limit 读取分页与搜索条件
+func listUsersQuery(r *http.Request) models.ListUsersRequest {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	return models.ListUsersRequest{
+		Query:  query.Get("q"),
+		Match:  query.Get("match"),
+		Cursor: query.Get("cursor"),
+		Limit:  limit,
+	}
+}
+
+// 处理管理端用户详情API
+func (s *HTTPServer) handleAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	// 调用RPC服务
+	userResp, err := s.rpcClient.AdminGetUser(r.Context(), token, userID)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResp)
+}
+
+// 处理管理端编辑用户API
+func (s *HTTPServer) handleAdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var updateReq models.AdminUpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	updateReq.UserID, _ = strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	// 调用RPC服务
+	userResp, err := s.rpcClient.AdminUpdateUser(r.Context(), token, &updateReq)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResp)
+}
+
+// 处理管理端禁用/启用用户API
+func (s *HTTPServer) handleAdminSetUserStatus(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := extractToken(r)
+		if token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+		// 调用RPC服务
+		userResp, err := s.rpcClient.AdminSetUserStatus(r.Context(), token, userID, status)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userResp)
+	}
+}
+
+// 管理接口的错误响应，权限不足时返回403
+func writeAdminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, client.ErrForbidden) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// 提取客户端信息，记录到Session中
+func clientInfo(r *http.Request) models.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return models.ClientInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
 // 从请求头中提取Token
 func extractToken(r *http.Request) string {
 	authHeader := r.Header.Get("Authorization")
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"user_system_v1/config"
+	"user_system_v1/database"
+)
+
+// loginBaseDelay 递增延迟的初始值，之后每多失败一次翻倍
+const loginBaseDelay = time.Second
+
+// loginGuard 登录防暴力破解：按用户名和客户端IP分别统计失败次数。
+// 同一用户名失败达到delayAfter次后，每次失败都要等待逐次翻倍的时间才能再试；
+// 用户名或IP失败达到上限后临时锁定。延迟与锁定都以SessionStore中带过期时间的锁定标记实现。
+type loginGuard struct {
+	store      database.SessionStore
+	userLimit  int64 // 0表示不限制
+	ipLimit    int64 // 0表示不限制
+	delayAfter int64 // 0表示不做递增延迟
+	window     time.Duration
+	lockout    time.Duration
+	maxDelay   time.Duration
+}
+
+func newLoginGuard(cfg *config.Config, store database.SessionStore) *loginGuard {
+	return &loginGuard{
+		store:      store,
+		userLimit:  int64(cfg.LoginMaxFailures),
+		ipLimit:    int64(cfg.LoginIPMaxFailures),
+		delayAfter: int64(cfg.LoginDelayAfter),
+		window:     time.Duration(cfg.LoginFailureWindow) * time.Second,
+		lockout:    time.Duration(cfg.LoginLockoutDuration) * time.Second,
+		maxDelay:   time.Duration(cfg.LoginMaxDelay) * time.Second,
+	}
+}
+
+// 用户名不区分大小写，避免通过变换大小写绕过计数
+func userSubject(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+func (g *loginGuard) subjects(username, ip string) []string {
+	subjects := []string{userSubject(username)}
+	if ip != "" {
+		subjects = append(subjects, ipSubject(ip))
+	}
+	return subjects
+}
+
+// loginAttempt 一次已预占用户名失败计数的尝试。校验失败时调用fail记录失败并设置延迟或锁定，
+// 校验通过或因服务端错误没有得出结果时调用release撤销预占
+type loginAttempt struct {
+	guard     *loginGuard
+	username  string
+	ip        string
+	userCount int64 // 含本次在内的用户名计数
+	locked    bool  // 本次失败会触发延迟或锁定，begin中已预先加锁
+}
+
+// begin 开始一次登录尝试，返回需要等待的时间，为0时允许本次尝试。
+// 是否允许只由锁定标记决定，被拒绝的尝试不计数，也不延长计数的有效期；
+// 锁定到期后的下一次尝试总能得到校验。
+// 为防止并发的猜测在第一次失败记录下来之前全部通过检查，begin先预占用户名计数：
+// 本次失败会触发延迟或锁定时，先以该时长加锁，并发的其他尝试因锁定被拒绝
+func (g *loginGuard) begin(ctx context.Context, username, ip string) (*loginAttempt, time.Duration, error) {
+	subjects := g.subjects(username, ip)
+	wait, err := g.store.LoginLockRemaining(ctx, subjects...)
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+
+	attempt := &loginAttempt{guard: g, username: username, ip: ip}
+	attempt.userCount, err = g.store.RecordLoginFailure(ctx, userSubject(username), g.window)
+	if err != nil {
+		return nil, 0, err
+	}
+	if wait := g.userWait(attempt.userCount); wait > 0 {
+		attempt.locked, err = g.store.TryLockLogin(ctx, userSubject(username), wait)
+		if err != nil || !attempt.locked {
+			attempt.release(ctx)
+			if err != nil {
+				return nil, 0, err
+			}
+			// 并发的尝试刚刚加锁
+			if wait, err = g.store.LoginLockRemaining(ctx, subjects...); err != nil || wait > 0 {
+				return nil, wait, err
+			}
+			return nil, loginBaseDelay, nil
+		}
+	}
+	return attempt, 0, nil
+}
+
+// fail 本次尝试失败：用户名计数已在begin中加过，按累计次数从现在起重新设置延迟或锁定；
+// IP计数在这里加一，达到上限时锁定该IP
+func (a *loginAttempt) fail(ctx context.Context) error {
+	g := a.guard
+	if wait := g.userWait(a.userCount); wait > 0 {
+		if err := g.store.LockLogin(ctx, userSubject(a.username), wait); err != nil {
+			return err
+		}
+	}
+	if a.ip == "" {
+		return nil
+	}
+	ipCount, err := g.store.RecordLoginFailure(ctx, ipSubject(a.ip), g.window)
+	if err != nil {
+		return err
+	}
+	if g.ipLimit > 0 && ipCount >= g.ipLimit {
+		return g.store.LockLogin(ctx, ipSubject(a.ip), g.lockout)
+	}
+	return nil
+}
+
+// release 撤销begin中预占的计数和加锁
+func (a *loginAttempt) release(ctx context.Context) error {
+	err := a.guard.store.RevertLoginFailure(ctx, userSubject(a.username))
+	if a.locked {
+		if unlockErr := a.guard.store.UnlockLogin(ctx, userSubject(a.username)); err == nil {
+			err = unlockErr
+		}
+	}
+	return err
+}
+
+// recordSuccess 登录成功后清除该用户名的失败记录；IP的计数保留，
+// 否则攻击者可以用自己的账号登录来重置IP上的计数
+func (g *loginGuard) recordSuccess(ctx context.Context, username string) error {
+	return g.store.ClearLoginFailures(ctx, userSubject(username))
+}
+
+// 用户名累计失败failures次后需要等待的时间
+func (g *loginGuard) userWait(failures int64) time.Duration {
+	if g.userLimit > 0 && failures >= g.userLimit {
+		return g.lockout
+	}
+	if g.delayAfter <= 0 || failures < g.delayAfter {
+		return 0
+	}
+
+	delay := loginBaseDelay
+	for i := g.delayAfter; i < failures && delay < g.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.maxDelay {
+		delay = g.maxDelay
+	}
+	return delay
+}
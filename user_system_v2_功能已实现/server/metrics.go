@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"user_system_v1/metrics"
+	"user_system_v1/rpc"
+)
+
+// httpMetrics 按路由模板统计请求数和耗时，作为mux中间件只作用于匹配到的路由，
+// 使用模板而不是实际路径，避免 /api/admin/users/{id} 之类的路由产生无限多的标签值
+func httpMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+	})
+}
+
+// routeTemplate 请求匹配到的路由模板
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unknown"
+}
+
+// rpcStatusNames RPCRequests的status标签
+var rpcStatusNames = map[uint32]string{
+	rpc.STATUS_SUCCESS:      "success",
+	rpc.STATUS_ERROR:        "error",
+	rpc.STATUS_RATE_LIMITED: "rate_limited",
+	rpc.STATUS_FORBIDDEN:    "forbidden",
+}
+
+// metricsInterceptor 按消息类型统计调用次数、结果和耗时，需放在recovery拦截器之外
+func metricsInterceptor(c *RPCContext, next HandlerFunc) (*Result, error) {
+	start := time.Now()
+	result, err := next(c)
+
+	msgType := rpc.MessageTypeName(c.Msg.Type)
+	var status uint32 = rpc.STATUS_SUCCESS
+	if err != nil {
+		status = rpc.STATUS_ERROR
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			status = rpcErr.status
+		}
+	}
+	metrics.RPCDuration.WithLabelValues(msgType).Observe(time.Since(start).Seconds())
+	metrics.RPCRequests.WithLabelValues(msgType, rpcStatusNames[status]).Inc()
+	return result, err
+}
+
+// countLogin 记录一次登录结果，成功或需要两步验证的登录在后续步骤出错时计为error
+func countLogin(result string, err error) {
+	if err != nil && (result == metrics.LoginSuccess || result == metrics.LoginTwoFactorRequired) {
+		result = metrics.LoginError
+	}
+	metrics.LoginAttempts.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"user_system_v1/metrics"
+)
+
+// OpsServer 只提供监控指标和健康检查的HTTP服务，供单独部署、没有HTTP网关的用户服务使用
+type OpsServer struct {
+	router *mux.Router
+	srv    *http.Server
+	mutex  sync.Mutex
+	health health
+}
+
+func NewOpsServer() *OpsServer {
+	s := &OpsServer{router: mux.NewRouter()}
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	s.health.routes(s.router)
+	return s
+}
+
+// AddReadinessCheck 添加就绪检查的依赖；需在Start之前调用
+func (s *OpsServer) AddReadinessCheck(name string, check HealthCheck) {
+	s.health.add(name, check)
+}
+
+// Start 启动HTTP服务，Shutdown后返回nil
+func (s *OpsServer) Start(port string) error {
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           s.router,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	s.mutex.Lock()
+	if s.health.isDraining() {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.srv = srv
+	s.mutex.Unlock()
+
+	slog.Info("Ops server started", "port", port)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 就绪检查改为返回503并停止HTTP服务
+func (s *OpsServer) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.health.drain()
+	srv := s.srv
+	s.mutex.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
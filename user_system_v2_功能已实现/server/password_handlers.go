@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"user_system_v1/database"
+	"user_system_v1/models"
+	"user_system_v1/notify"
+)
+
+const (
+	// 同一用户两次申请重置的最小间隔
+	passwordResetCooldown = time.Minute
+
+	// 无论用户是否存在都返回同样的提示，避免借此探测用户名
+	resetRequestedMessage = "如果该用户存在，重置链接已发送"
+)
+
+type changePasswordRequest struct {
+	tokenPayload
+	models.ChangePasswordRequest
+}
+
+// 修改密码：需要提交当前密码，成功后注销该用户的所有会话
+func (s *TCPServer) handleChangePassword(c *RPCContext, req *changePasswordRequest) (*Result, error) {
+	user, err := s.users.GetUserByID(c, c.UserID)
+	if err != nil {
+		return fail("获取用户信息失败", err)
+	}
+
+	// 与登录共用失败计数，防止持有Session的人穷举当前密码
+	attempt, wait, err := s.loginGuard.begin(c, user.Username, "")
+	if err != nil {
+		return fail("修改密码失败", err)
+	}
+	if wait > 0 {
+		return loginRateLimited(wait)
+	}
+
+	ok, err := s.hasher.Verify(req.CurrentPassword, user.PasswordHash)
+	if err != nil {
+		slog.ErrorContext(c, "Failed to verify password", "user_id", user.ID, "error", err)
+	}
+	if !ok {
+		s.recordLoginFailure(c, attempt)
+		return fail("当前密码错误", nil)
+	}
+	s.releaseLoginAttempt(c, attempt)
+
+	if err := s.users.SetPassword(c, user.ID, req.NewPassword, s.hasher); err != nil {
+		if errors.Is(err, database.ErrWeakPassword) {
+			return fail(passwordPolicyMessage, nil)
+		}
+		return fail("修改密码失败", err)
+	}
+
+	if err := s.sessions.DeleteUserSessions(c, user.ID); err != nil {
+		return fail("密码已修改，但注销已登录的设备失败，请退出所有设备", err)
+	}
+
+	s.sendNotification(c, &notify.Message{
+		To:      user.Username,
+		Subject: "密码已修改",
+		Body:    "您的密码刚刚被修改，所有设备均已退出登录。如果不是您本人操作，请立即重置密码。",
+	})
+
+	return success("密码已修改，请重新登录", nil)
+}
+
+// 申请重置密码：生成一次性重置Token，通过Notifier发送给用户
+func (s *TCPServer) handleRequestPasswordReset(c *RPCContext, req *models.ForgotPasswordRequest) (*Result, error) {
+	user, err := s.users.GetUserByUsername(c, req.Username)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return fail("申请重置失败，请重试", err)
+		}
+		return success(resetRequestedMessage, nil)
+	}
+
+	// 冷却期内的重复申请直接忽略，避免向用户连续发送通知
+	acquired, err := s.sessions.AcquirePasswordResetCooldown(c, user.ID, passwordResetCooldown)
+	if err != nil {
+		return fail("申请重置失败，请重试", err)
+	}
+	if !acquired {
+		return success(resetRequestedMessage, nil)
+	}
+
+	token, err := database.GenerateSessionToken()
+	if err != nil {
+		return fail("申请重置失败，请重试", err)
+	}
+	if err := s.sessions.StorePasswordResetToken(c, token, user.ID, s.resetExpiration); err != nil {
+		return fail("申请重置失败，请重试", err)
+	}
+
+	s.sendNotification(c, &notify.Message{
+		To:      user.Username,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("请在%d分钟内打开以下链接重置密码：\n%s%s\n如果不是您本人操作，请忽略此消息。",
+			int(s.resetExpiration.Minutes()), s.resetURL, token),
+	})
+
+	return success(resetRequestedMessage, nil)
+}
+
+// 凭重置Token设置新密码，成功后注销该用户的所有会话
+func (s *TCPServer) handleResetPassword(c *RPCContext, req *models.ResetPasswordRequest) (*Result, error) {
+	// 先校验新密码，避免密码不合规时白白消耗Token
+	if err := database.ValidatePassword(req.NewPassword); err != nil {
+		return fail(passwordPolicyMessage, nil)
+	}
+
+	// 密码修改成功后才删除Token，查询或写入出错时用户可以用同一链接重试
+	userID, err := s.sessions.GetPasswordResetToken(c, req.ResetToken)
+	if err != nil {
+		if errors.Is(err, database.ErrResetTokenInvalid) {
+			return fail("重置链接无效或已过期", nil)
+		}
+		return fail("重置密码失败，请重试", err)
+	}
+
+	user, err := s.users.GetUserByID(c, userID)
+	if err != nil {
+		return fail("重置密码失败，请重试", err)
+	}
+
+	if err := s.users.SetPassword(c, user.ID, req.NewPassword, s.hasher); err != nil {
+		return fail("重置密码失败，请重试", err)
+	}
+
+	// 密码已经修改，删除失败时Token到期后同样失效，只记录日志；
+	// 并发提交同一Token时密码都由持有Token的人设置
+	consumed, err := s.sessions.ConsumePasswordResetToken(c, req.ResetToken, user.ID)
+	if err != nil {
+		slog.WarnContext(c, "Failed to consume password reset token", "user_id", user.ID, "error", err)
+	} else if !consumed {
+		slog.WarnContext(c, "Password reset token already consumed by a concurrent request", "user_id", user.ID)
+	}
+
+	if err := s.sessions.DeleteUserSessions(c, user.ID); err != nil {
+		return fail("密码已重置，但注销已登录的设备失败，请登录后退出所有设备", err)
+	}
+
+	// 重置成功后解除该用户名的登录锁定
+	if err := s.loginGuard.recordSuccess(c, user.Username); err != nil {
+		slog.WarnContext(c, "Failed to clear login failures", "user_id", user.ID, "error", err)
+	}
+
+	s.sendNotification(c, &notify.Message{
+		To:      user.Username,
+		Subject: "密码已重置",
+		Body:    "您的密码已通过重置链接修改，所有设备均已退出登录。",
+	})
+
+	return success("密码已重置，请使用新密码登录", nil)
+}
+
+// 异步发送通知，投递失败只记录日志，也避免响应耗时暴露用户是否存在
+func (s *TCPServer) sendNotification(ctx context.Context, msg *notify.Message) {
+	// 保留请求ID，但不随请求结束而取消
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := s.notifier.Notify(ctx, msg); err != nil {
+			slog.ErrorContext(ctx, "Failed to send notification", "subject", msg.Subject, "to", msg.To, "error", err)
+		}
+	}()
+}
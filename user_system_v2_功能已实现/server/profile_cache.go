@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"user_system_v1/database"
+	"user_system_v1/models"
+)
+
+// profileLoadTimeout 合并后的回源不随任一调用方取消，单独限制耗时
+const profileLoadTimeout = 5 * time.Second
+
+// getProfile 按cache-aside方式读取用户资料：先查Redis，未命中时回源MySQL并写回缓存。
+// 同一用户的并发回源通过singleflight合并，避免热点用户缓存过期时大量请求同时打到MySQL。
+// 修改资料只删除缓存，写回缓存由回源负责，并通过版本号避免回源期间被修改的资料写回旧数据
+func (s *TCPServer) getProfile(ctx context.Context, userID int64) (*models.User, error) {
+	if s.profileCacheTTL <= 0 {
+		return s.users.GetUserByID(ctx, userID)
+	}
+
+	user, err := s.sessions.GetCachedUser(ctx, userID)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, database.ErrCacheMiss) {
+		// Redis异常时直接回源，不影响读取
+		slog.WarnContext(ctx, "Error reading profile cache", "user_id", userID, "error", err)
+	}
+
+	// 回源由第一个调用方发起、所有合并的调用方共享，不能随第一个调用方取消而让其他调用方一起失败；
+	// 每个调用方仍然只等到自己的ctx结束
+	ch := s.profileGroup.DoChan(strconv.FormatInt(userID, 10), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), profileLoadTimeout)
+		defer cancel()
+
+		// 版本号须在查询MySQL之前读取
+		version, versionErr := s.sessions.CachedUserVersion(ctx, userID)
+		user, err := s.users.GetUserByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if versionErr != nil {
+			slog.WarnContext(ctx, "Error reading profile cache version", "user_id", userID, "error", versionErr)
+		} else {
+			s.cacheProfile(ctx, user, version)
+		}
+		return user, nil
+	})
+
+	select {
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		// 合并的调用方共享同一个结果，各自返回一份拷贝
+		shared := *result.Val.(*models.User)
+		return &shared, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cacheProfile 把回源读到的用户资料写回缓存，version为回源前读到的版本号
+func (s *TCPServer) cacheProfile(ctx context.Context, user *models.User, version int64) {
+	if _, err := s.sessions.CacheUser(ctx, user, version, s.profileCacheTTL, s.profileCacheJitter); err != nil {
+		slog.WarnContext(ctx, "Error caching profile", "user_id", user.ID, "error", err)
+	}
+}
+
+// invalidateProfile 修改用户资料后删除缓存，下次读取时回源
+func (s *TCPServer) invalidateProfile(ctx context.Context, userID int64) {
+	if s.profileCacheTTL <= 0 {
+		return
+	}
+
+	if err := s.sessions.InvalidateCachedUser(ctx, userID); err != nil {
+		slog.WarnContext(ctx, "Error invalidating profile cache", "user_id", userID, "error", err)
+	}
+}
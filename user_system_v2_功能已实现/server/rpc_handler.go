@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"user_system_v1/models"
+	"user_system_v1/rpc"
+)
+
+// RPCContext 一次RPC调用的上下文，在拦截器与handler之间传递
+type RPCContext struct {
+	context.Context
+
+	Msg        *rpc.Message
+	RemoteAddr string
+	Request    interface{} // 解码后的请求体
+
+	// 由auth拦截器填充
+	Token   string
+	UserID  int64
+	Session *models.Session
+}
+
+// Result handler的成功结果，Data作为响应Payload返回
+type Result struct {
+	Message string
+	Data    interface{}
+}
+
+// HandlerFunc RPC业务处理函数
+type HandlerFunc func(c *RPCContext) (*Result, error)
+
+// Interceptor 拦截器，在调用next前后执行通用逻辑
+type Interceptor func(c *RPCContext, next HandlerFunc) (*Result, error)
+
+// rpcError 业务错误：Message返回给调用方，cause只记录在日志中
+type rpcError struct {
+	status  uint32
+	message string
+	cause   error
+	data    interface{} // 非nil时作为失败响应的Payload
+}
+
+func (e *rpcError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %v", e.message, e.cause)
+	}
+	return e.message
+}
+
+func (e *rpcError) Unwrap() error {
+	return e.cause
+}
+
+func success(message string, data interface{}) (*Result, error) {
+	return &Result{Message: message, Data: data}, nil
+}
+
+// fail 返回业务失败，cause非nil时会被logging拦截器记录
+func fail(message string, cause error) (*Result, error) {
+	return nil, &rpcError{status: rpc.STATUS_ERROR, message: message, cause: cause}
+}
+
+// forbidden 已登录但没有权限
+func forbidden(message string) (*Result, error) {
+	return nil, &rpcError{status: rpc.STATUS_FORBIDDEN, message: message}
+}
+
+// rateLimited 返回限流失败，data中可以携带重试等待时间
+func rateLimited(message string, data interface{}) (*Result, error) {
+	return nil, &rpcError{status: rpc.STATUS_RATE_LIMITED, message: message, data: data}
+}
+
+// handlerRegistry 按消息类型注册handler，替代handleMessage中的switch
+type handlerRegistry struct {
+	handlers     map[uint32]HandlerFunc
+	interceptors []Interceptor // 作用于所有handler的拦截器，在请求解码之前执行
+}
+
+func newHandlerRegistry(interceptors ...Interceptor) *handlerRegistry {
+	return &handlerRegistry{
+		handlers:     make(map[uint32]HandlerFunc),
+		interceptors: interceptors,
+	}
+}
+
+// register 注册handler，interceptors按顺序由外到内包裹handler
+func (r *handlerRegistry) register(msgType uint32, h HandlerFunc, interceptors ...Interceptor) {
+	if _, exists := r.handlers[msgType]; exists {
+		panic(fmt.Sprintf("rpc handler for %s registered twice", rpc.MessageTypeName(msgType)))
+	}
+	r.handlers[msgType] = chain(h, append(r.interceptors, interceptors...)...)
+}
+
+// handle 注册类型化handler：Payload按连接的编解码器解码为Req后再进入handler自身的拦截器
+func handle[Req any](r *handlerRegistry, msgType uint32, fn func(c *RPCContext, req *Req) (*Result, error), interceptors ...Interceptor) {
+	inner := chain(func(c *RPCContext) (*Result, error) {
+		return fn(c, c.Request.(*Req))
+	}, interceptors...)
+
+	r.register(msgType, func(c *RPCContext) (*Result, error) {
+		req := new(Req)
+		if len(c.Msg.Payload) > 0 {
+			if err := c.Msg.DecodePayload(req); err != nil {
+				return fail("Invalid request format", nil)
+			}
+		}
+		c.Request = req
+		return inner(c)
+	})
+}
+
+func chain(h HandlerFunc, interceptors ...Interceptor) HandlerFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(c *RPCContext) (*Result, error) {
+			return interceptor(c, next)
+		}
+	}
+	return h
+}
+
+// dispatch 调用handler并构造响应，响应沿用请求ID
+func (r *handlerRegistry) dispatch(c *RPCContext) *rpc.Response {
+	resp := &rpc.Response{
+		Type: c.Msg.Type,
+		ID:   c.Msg.ID,
+	}
+
+	h, ok := r.handlers[c.Msg.Type]
+	if !ok {
+		resp.Status = rpc.STATUS_ERROR
+		resp.Message = "Unknown message type"
+		return resp
+	}
+
+	result, err := h(c)
+	if err != nil {
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			resp.Status = rpcErr.status
+			resp.Message = rpcErr.message
+			setPayload(c, resp, rpcErr.data)
+		} else {
+			resp.Status = rpc.STATUS_ERROR
+			resp.Message = "Internal server error"
+		}
+		return resp
+	}
+
+	resp.Status = rpc.STATUS_SUCCESS
+	if result != nil {
+		resp.Message = result.Message
+		setPayload(c, resp, result.Data)
+	}
+
+	return resp
+}
+
+// setPayload 按连接的编解码器编码响应Payload，data为nil时不设置
+func setPayload(c *RPCContext, resp *rpc.Response, data interface{}) {
+	if data == nil {
+		return
+	}
+
+	payload, err := c.Msg.EncodePayload(data)
+	if err != nil {
+		slog.ErrorContext(c, "Error encoding response", "rpc", rpc.MessageTypeName(c.Msg.Type), "error", err)
+		resp.Status = rpc.STATUS_ERROR
+		resp.Message = "Response serialization failed"
+		return
+	}
+	resp.Payload = payload
+}
+
+// recoveryInterceptor 将handler中的panic转换为错误响应，避免拖垮整个连接
+func recoveryInterceptor(c *RPCContext, next HandlerFunc) (result *Result, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(c, "Panic in handler", "rpc", rpc.MessageTypeName(c.Msg.Type), "panic", p, "stack", string(debug.Stack()))
+			result, err = nil, &rpcError{status: rpc.STATUS_ERROR, message: "Internal server error"}
+		}
+	}()
+	return next(c)
+}
+
+// loggingInterceptor 记录带有内部原因的失败调用，密码错误等预期内的业务失败不记录
+func loggingInterceptor(c *RPCContext, next HandlerFunc) (*Result, error) {
+	result, err := next(c)
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) || rpcErr.cause != nil {
+			slog.ErrorContext(c, "RPC failed", "rpc", rpc.MessageTypeName(c.Msg.Type), "remote_addr", c.RemoteAddr, "user_id", c.UserID, "error", err)
+		}
+	}
+	return result, err
+}
+
+// slowCallThreshold 超过该耗时的调用会被timing拦截器记录
+const slowCallThreshold = 500 * time.Millisecond
+
+// timingInterceptor 记录慢调用，debug级别下记录所有调用的耗时
+func timingInterceptor(c *RPCContext, next HandlerFunc) (*Result, error) {
+	start := time.Now()
+	result, err := next(c)
+	elapsed := time.Since(start)
+	if elapsed > slowCallThreshold {
+		slog.WarnContext(c, "Slow RPC", "rpc", rpc.MessageTypeName(c.Msg.Type), "remote_addr", c.RemoteAddr, "elapsed", elapsed)
+	} else {
+		slog.DebugContext(c, "RPC handled", "rpc", rpc.MessageTypeName(c.Msg.Type), "remote_addr", c.RemoteAddr, "elapsed", elapsed)
+	}
+	return result, err
+}
+
+// tokenRequest 携带Session Token的请求
+type tokenRequest interface {
+	sessionToken() string
+}
+
+// tokenPayload 嵌入到需要登录的请求结构体中
+type tokenPayload struct {
+	Token string `json:"token"`
+}
+
+func (p *tokenPayload) sessionToken() string {
+	return p.Token
+}
+
+// authInterceptor 校验请求中的Session Token，并把用户信息写入上下文
+func (s *TCPServer) authInterceptor(c *RPCContext, next HandlerFunc) (*Result, error) {
+	req, ok := c.Request.(tokenRequest)
+	if !ok {
+		return nil, fmt.Errorf("%s request does not carry a token", rpc.MessageTypeName(c.Msg.Type))
+	}
+
+	session, err := s.validateToken(c, req.sessionToken())
+	if errors.Is(err, errInvalidSession) {
+		return fail("Invalid session", nil)
+	}
+	// 存储故障不代表会话失效，不能让客户端当作已登出
+	if err != nil {
+		return fail("校验会话失败，请重试", err)
+	}
+
+	c.Token = req.sessionToken()
+	c.UserID = session.UserID
+	c.Session = session
+	return next(c)
+}
+
+// requirePermission 要求会话拥有指定权限，需放在auth拦截器之后
+func requirePermission(permission string) Interceptor {
+	return func(c *RPCContext, next HandlerFunc) (*Result, error) {
+		if c.Session == nil || !c.Session.HasPermission(permission) {
+			return forbidden("权限不足")
+		}
+		return next(c)
+	}
+}
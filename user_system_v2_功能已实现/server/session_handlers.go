@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"sort"
+
+	"user_system_v1/database"
+	"user_system_v1/models"
+)
+
+// 列出当前用户在各设备上的有效会话
+func (s *TCPServer) handleListSessions(c *RPCContext, req *tokenPayload) (*Result, error) {
+	sessions, err := s.sessions.ListSessions(c, c.UserID)
+	if err != nil {
+		return fail("获取会话列表失败", err)
+	}
+
+	infos := make([]*models.SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, &models.SessionInfo{
+			Session: *session,
+			Current: session.ID == c.Session.ID,
+		})
+	}
+
+	// 最近登录的排在前面
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].CreatedAt.After(infos[j].CreatedAt)
+	})
+
+	return success("获取成功", &models.ListSessionsResponse{
+		Success:  true,
+		Message:  "获取成功",
+		Sessions: infos,
+	})
+}
+
+type revokeSessionRequest struct {
+	tokenPayload
+	models.RevokeSessionRequest
+}
+
+// 注销当前用户的指定会话
+func (s *TCPServer) handleRevokeSession(c *RPCContext, req *revokeSessionRequest) (*Result, error) {
+	if req.SessionID == "" {
+		return fail("缺少会话ID", nil)
+	}
+
+	if err := s.sessions.DeleteSessionByID(c, c.UserID, req.SessionID); err != nil {
+		if errors.Is(err, database.ErrSessionNotFound) {
+			return fail("会话不存在", nil)
+		}
+		return fail("注销会话失败", err)
+	}
+
+	return success("会话已注销", nil)
+}
+
+// 注销当前用户的所有会话（在所有设备上登出）
+func (s *TCPServer) handleRevokeAllSessions(c *RPCContext, req *tokenPayload) (*Result, error) {
+	if err := s.sessions.DeleteUserSessions(c, c.UserID); err != nil {
+		return fail("注销会话失败", err)
+	}
+
+	return success("已在所有设备上登出", nil)
+}
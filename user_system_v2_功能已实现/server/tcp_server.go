@@ -1,68 +1,242 @@
 package server
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"user_system_v1/auth"
+	"user_system_v1/config"
 	"user_system_v1/database"
+	"user_system_v1/logging"
+	"user_system_v1/metrics"
 	"user_system_v1/models"
+	"user_system_v1/notify"
 	"user_system_v1/rpc"
+	"user_system_v1/tracing"
 )
 
+// shutdownDrainTimeout 开始关闭后继续读取请求的时间，处理客户端在此之前已经发出、仍在网络或socket缓冲区中的请求
+const shutdownDrainTimeout = 100 * time.Millisecond
+
 type TCPServer struct {
-	mysqlDB    *database.MySQLDB
-	redisDB    *database.RedisDB
-	listener   net.Listener
-	clients    map[net.Conn]bool
-	mutex      sync.RWMutex
-	msgID      uint32
-	msgIDMutex sync.Mutex
+	handlers        *handlerRegistry
+	users           database.UserStore
+	sessions        database.SessionStore
+	hasher          auth.PasswordHasher
+	notifier        notify.Notifier
+	tokenSigner     *auth.JWTSigner // 非nil时开启JWT模式
+	loginGuard      *loginGuard
+	resetURL        string
+	resetExpiration time.Duration
+	sessionTTL      time.Duration // session模式下Session的有效期，每次校验时续期
+	accessTTL       time.Duration
+	refreshTTL      time.Duration
+	idleTimeout     time.Duration
+
+	// 用户资料缓存，TTL为0时不缓存
+	profileCacheTTL    time.Duration
+	profileCacheJitter time.Duration
+	profileGroup       singleflight.Group
+
+	maxFrame uint32
+	listener net.Listener
+	clients  map[net.Conn]bool
+	closing  bool           // 已开始关闭，不再接受新连接，各连接读完已发出的请求后停止读取
+	drainEnd time.Time      // 开始关闭后各连接停止读取的时间
+	conns    sync.WaitGroup // 处理中的连接，关闭时等待其在途请求完成
+	mutex    sync.RWMutex
 }
 
-func NewTCPServer(mysqlDB *database.MySQLDB, redisDB *database.RedisDB) *TCPServer {
-	return &TCPServer{
-		mysqlDB: mysqlDB,
-		redisDB: redisDB,
-		clients: make(map[net.Conn]bool),
-	}
+// NewTCPServer 创建TCP服务器，users和sessions通常为MySQLDB和RedisDB，测试时可使用内存实现
+func NewTCPServer(cfg *config.Config, users database.UserStore, sessions database.SessionStore, hasher auth.PasswordHasher, notifier notify.Notifier, tokenSigner *auth.JWTSigner) *TCPServer {
+	s := &TCPServer{
+		handlers:           newHandlerRegistry(metricsInterceptor, recoveryInterceptor),
+		users:              users,
+		sessions:           sessions,
+		hasher:             hasher,
+		notifier:           notifier,
+		tokenSigner:        tokenSigner,
+		loginGuard:         newLoginGuard(cfg, sessions),
+		resetURL:           cfg.PasswordResetURL,
+		resetExpiration:    time.Duration(cfg.PasswordResetExpiration) * time.Second,
+		sessionTTL:         time.Duration(cfg.SessionExpiration) * time.Second,
+		accessTTL:          time.Duration(cfg.JWTAccessTokenTTL) * time.Second,
+		refreshTTL:         time.Duration(cfg.RefreshTokenTTL) * time.Second,
+		idleTimeout:        time.Duration(cfg.RPCIdleTimeout) * time.Second,
+		profileCacheTTL:    time.Duration(cfg.ProfileCacheTTL) * time.Second,
+		profileCacheJitter: time.Duration(cfg.ProfileCacheJitter) * time.Second,
+		maxFrame:           uint32(cfg.RPCMaxFrameSize),
+		clients:            make(map[net.Conn]bool),
+	}
+	s.registerHandlers()
+	return s
 }
 
-func (s *TCPServer) Start(port string) error {
+// 注册所有RPC handler，需要登录的handler使用authInterceptor
+func (s *TCPServer) registerHandlers() {
+	r := s.handlers
+	withAuth := s.authInterceptor
+
+	handle(r, rpc.MSG_LOGIN, s.handleLogin, loggingInterceptor, timingInterceptor)
+	handle(r, rpc.MSG_REGISTER, s.handleRegister, loggingInterceptor, timingInterceptor)
+	handle(r, rpc.MSG_GET_PROFILE, s.handleGetProfile, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_UPDATE_PROFILE, s.handleUpdateProfile, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_LOGOUT, s.handleLogout, loggingInterceptor)
+	handle(r, rpc.MSG_HEARTBEAT, s.handleHeartbeat)
+	handle(r, rpc.MSG_LIST_SESSIONS, s.handleListSessions, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_REVOKE_SESSION, s.handleRevokeSession, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_REVOKE_ALL_SESSIONS, s.handleRevokeAllSessions, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_LOGIN_2FA, s.handleLogin2FA, loggingInterceptor, timingInterceptor)
+	handle(r, rpc.MSG_TOTP_SETUP, s.handleTOTPSetup, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_TOTP_CONFIRM, s.handleTOTPConfirm, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_TOTP_DISABLE, s.handleTOTPDisable, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_CHANGE_PASSWORD, s.handleChangePassword, loggingInterceptor, timingInterceptor, withAuth)
+	handle(r, rpc.MSG_REQUEST_PASSWORD_RESET, s.handleRequestPasswordReset, loggingInterceptor, timingInterceptor)
+	handle(r, rpc.MSG_RESET_PASSWORD, s.handleResetPassword, loggingInterceptor, timingInterceptor)
+	handle(r, rpc.MSG_REFRESH_TOKEN, s.handleRefreshToken, loggingInterceptor, timingInterceptor)
+	handle(r, rpc.MSG_JWKS, s.handleJWKS)
+
+	canRead := requirePermission(models.PermUsersRead)
+	canWrite := requirePermission(models.PermUsersWrite)
+	handle(r, rpc.MSG_ADMIN_LIST_USERS, s.handleAdminListUsers, loggingInterceptor, timingInterceptor, withAuth, canRead)
+	handle(r, rpc.MSG_ADMIN_GET_USER, s.handleAdminGetUser, loggingInterceptor, timingInterceptor, withAuth, canRead)
+	handle(r, rpc.MSG_ADMIN_UPDATE_USER, s.handleAdminUpdateUser, loggingInterceptor, timingInterceptor, withAuth, canWrite)
+	handle(r, rpc.MSG_ADMIN_SET_USER_STATUS, s.handleAdminSetUserStatus, loggingInterceptor, timingInterceptor, withAuth, canWrite)
+	handle(r, rpc.MSG_LIST_USERS, s.handleListUsers, loggingInterceptor, timingInterceptor, withAuth, canRead)
+}
+
+// Start 启动TCP服务器，tlsConfig为nil时使用明文连接；Shutdown或Stop后返回nil
+func (s *TCPServer) Start(port string, tlsConfig *tls.Config) error {
 	listener, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		return err
 	}
 
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		slog.Info("TCP Server started", "port", port, "tls", true)
+	} else {
+		slog.Info("TCP Server started", "port", port, "tls", false)
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve 在已创建的listener上接受连接，直到Shutdown或Stop
+func (s *TCPServer) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		listener.Close()
+		return nil
+	}
 	s.listener = listener
-	log.Printf("TCP Server started on port %s", port)
+	s.mutex.Unlock()
 
+	var backoff time.Duration
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("Error accepting connection: %v", err)
+			if s.isClosing() {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// 文件描述符耗尽等错误可能持续出现，逐次延长等待时间，避免空转刷日志
+			if backoff == 0 {
+				backoff = 5 * time.Millisecond
+			} else if backoff < time.Second {
+				backoff *= 2
+			}
+			slog.Error("Error accepting connection", "error", err, "retry_in", backoff)
+			time.Sleep(backoff)
 			continue
 		}
+		backoff = 0
 
-		// 添加客户端连接
+		// 添加客户端连接，关闭过程中到达的连接直接断开
 		s.mutex.Lock()
+		if s.closing {
+			s.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
 		s.clients[conn] = true
+		s.conns.Add(1)
 		s.mutex.Unlock()
 
 		go s.handleConnection(conn)
 	}
 }
 
+func (s *TCPServer) isClosing() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.closing
+}
+
+// drainDeadline 已开始关闭时返回连接停止读取的时间
+func (s *TCPServer) drainDeadline() (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.drainEnd, s.closing
+}
+
+// Shutdown 优雅关闭：停止接受新连接，各连接在shutdownDrainTimeout内继续读取客户端已发出的请求，
+// 然后停止读取，等在途请求写完响应后断开。ctx到期时强制关闭剩余连接并返回ctx的错误
+func (s *TCPServer) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closing {
+		s.closing = true
+		s.drainEnd = time.Now().Add(shutdownDrainTimeout)
+	}
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	// 阻塞在读取上的连接读完已到达的请求后超时返回，handleConnection随后等待在途请求
+	for conn := range s.clients {
+		conn.SetReadDeadline(s.drainEnd)
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+// Stop 立即关闭监听和所有连接，不等待在途请求
 func (s *TCPServer) Stop() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	s.closing = true
+
 	// 关闭所有客户端连接
 	for conn := range s.clients {
 		conn.Close()
@@ -70,405 +244,443 @@ func (s *TCPServer) Stop() error {
 	}
 
 	if s.listener != nil {
-		return s.listener.Close()
+		err := s.listener.Close()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		return err
 	}
 	return nil
 }
 
+// 处理一条长连接：循环读取请求，每个请求在独立协程中处理，
+// 响应携带请求原有的ID，客户端据此匹配并发中的多个请求
 func (s *TCPServer) handleConnection(conn net.Conn) {
+	var inflight sync.WaitGroup
+
 	defer func() {
+		// 等待在途请求写完响应后再关闭连接
+		inflight.Wait()
 		conn.Close()
 		s.mutex.Lock()
 		delete(s.clients, conn)
 		s.mutex.Unlock()
+		s.conns.Done()
 	}()
 
-	// 设置连接超时
-	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	reader := rpc.NewFrameReader(conn, s.maxFrame)
+	writer := rpc.NewFrameWriter(conn, s.maxFrame)
 
-	buffer := make([]byte, 4096)
+	// 未握手的连接按JSON处理
+	codec := rpc.DefaultCodec
+	firstFrame := true
 
 	for {
-		n, err := conn.Read(buffer)
+		// 空闲超时：客户端会定期发送心跳，长时间无数据说明对端已失联
+		if s.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
+		// 在设置deadline之后检查，Shutdown设置的读取期限不会被上面覆盖
+		if deadline, closing := s.drainDeadline(); closing {
+			if !time.Now().Before(deadline) {
+				return
+			}
+			conn.SetReadDeadline(deadline)
+		}
+
+		frame, err := reader.ReadFrame()
 		if err != nil {
-			if err != io.EOF {
-				log.Printf("Error reading from connection: %v", err)
+			if err != io.EOF && !s.isClosing() {
+				slog.Warn("Error reading from connection", "remote_addr", conn.RemoteAddr().String(), "error", err)
 			}
-			break
+			return
 		}
 
-		// 处理消息
-		response, err := s.handleMessage(buffer[:n])
+		// 连接的第一帧可以是编解码器握手
+		if firstFrame {
+			firstFrame = false
+			if rpc.IsHandshake(frame) {
+				codec = rpc.NegotiateCodec(rpc.ParseHandshake(frame))
+				if err := writer.WriteFrame(rpc.EncodeHandshake(codec.Name())); err != nil {
+					slog.Warn("Error writing handshake", "remote_addr", conn.RemoteAddr().String(), "error", err)
+					return
+				}
+				continue
+			}
+		}
+
+		msg, err := rpc.DecodeMessage(codec, frame)
 		if err != nil {
-			log.Printf("Error handling message: %v", err)
-			continue
+			// 无法得知消息ID，也就无法回复；断开连接让客户端上等待中的请求立即失败，而不是等到超时
+			slog.Warn("Error decoding message, closing connection", "remote_addr", conn.RemoteAddr().String(), "error", err)
+			return
 		}
 
-		// 发送响应
-		if response != nil {
-			responseData, err := response.Serialize()
+		inflight.Add(1)
+		go func() {
+			defer inflight.Done()
+
+			// 处理消息
+			response := s.handleMessage(msg, conn.RemoteAddr().String())
+
+			// 发送响应
+			responseData, err := rpc.EncodeResponse(codec, response)
 			if err != nil {
-				log.Printf("Error serializing response: %v", err)
-				continue
+				slog.Error("Error serializing response", "rpc", rpc.MessageTypeName(msg.Type), logging.RequestIDKey, msg.RequestID, "error", err)
+				return
 			}
 
-			_, err = conn.Write(responseData)
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			err = writer.WriteFrame(responseData)
+			// 响应超过最大帧大小时没有写出任何字节，改为回复错误，连接上的其他请求不受影响
+			if errors.Is(err, rpc.ErrFrameTooLarge) {
+				slog.Error("Response too large", "rpc", rpc.MessageTypeName(msg.Type), logging.RequestIDKey, msg.RequestID, "size", len(responseData))
+				responseData, err = rpc.EncodeResponse(codec, &rpc.Response{
+					Type:    msg.Type,
+					ID:      msg.ID,
+					Status:  rpc.STATUS_ERROR,
+					Message: "response too large",
+				})
+				if err == nil {
+					err = writer.WriteFrame(responseData)
+				}
+			}
 			if err != nil {
-				log.Printf("Error writing response: %v", err)
-				break
+				slog.Warn("Error writing response", "rpc", rpc.MessageTypeName(msg.Type), logging.RequestIDKey, msg.RequestID, "error", err)
+				conn.Close()
 			}
+		}()
+	}
+}
 
-			// 发送响应后关闭连接（每个请求一个连接）
-			break
-		}
+func (s *TCPServer) handleMessage(msg *rpc.Message, remoteAddr string) *rpc.Response {
+	// 延续网关一侧的trace，网关没有传递时作为新trace的根span
+	ctx := tracing.Extract(context.Background(), msg.Metadata)
+	ctx, span := tracer.Start(ctx, tracing.RPCSpanName(msg.Type),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.RPCAttributes(msg.Type)...),
+		trace.WithAttributes(semconv.NetworkPeerAddress(remoteAddr)),
+	)
+	defer span.End()
+	if msg.RequestID != "" {
+		span.SetAttributes(attribute.String(logging.RequestIDKey, msg.RequestID))
+	}
+
+	response := s.handlers.dispatch(&RPCContext{
+		Context:    logging.WithRequestID(ctx, msg.RequestID),
+		Msg:        msg,
+		RemoteAddr: remoteAddr,
+	})
+	span.SetAttributes(tracing.RPCStatusKey.Int(int(response.Status)))
+	if response.Status == rpc.STATUS_ERROR {
+		span.SetStatus(codes.Error, response.Message)
+	}
+	return response
+}
+
+func (s *TCPServer) handleLogin(c *RPCContext, req *models.LoginRequest) (result *Result, err error) {
+	outcome := metrics.LoginError
+	defer func() { countLogin(outcome, err) }()
 
-		// 重置超时
-		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	// 网关未传递客户端IP时，按直连的对端地址计数
+	info := req.ClientInfo
+	if info.IP == "" {
+		info.IP, _, _ = net.SplitHostPort(c.RemoteAddr)
 	}
-}
 
-func (s *TCPServer) handleMessage(data []byte) (*rpc.Response, error) {
-	// 解析消息
-	msg, err := rpc.DeserializeMessage(data)
+	// 处于递增延迟或锁定期内的请求直接拒绝，不再校验密码
+	attempt, wait, err := s.loginGuard.begin(c, req.Username, info.IP)
 	if err != nil {
-		return nil, err
+		return fail("登录失败，请重试", err)
+	}
+	if wait > 0 {
+		outcome = metrics.LoginRateLimited
+		return loginRateLimited(wait)
 	}
 
-	// 生成响应ID
-	s.msgIDMutex.Lock()
-	s.msgID++
-	responseID := s.msgID
-	s.msgIDMutex.Unlock()
-
-	// 根据消息类型处理
-	switch msg.Type {
-	case rpc.MSG_LOGIN:
-		return s.handleLogin(msg, responseID)
-	case rpc.MSG_GET_PROFILE:
-		return s.handleGetProfile(msg, responseID)
-	case rpc.MSG_UPDATE_PROFILE:
-		return s.handleUpdateProfile(msg, responseID)
-	case rpc.MSG_LOGOUT:
-		return s.handleLogout(msg, responseID)
-	case rpc.MSG_HEARTBEAT:
-		return s.handleHeartbeat(msg, responseID)
-	default:
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Unknown message type",
-		}, nil
+	// 获取用户信息
+	user, err := s.users.GetUserByUsername(c, req.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 不存在的用户名同样计数，避免借此探测用户名
+		s.recordLoginFailure(c, attempt)
+		outcome = metrics.LoginInvalidCredentials
+		return fail("用户名或密码错误", nil)
 	}
-}
+	if err != nil {
+		// 数据库出错不代表密码错误，不计入失败次数
+		s.releaseLoginAttempt(c, attempt)
+		return fail("登录失败，请重试", err)
+	}
+
+	// 验证密码
+	ok, err := s.hasher.Verify(req.Password, user.PasswordHash)
+	if err != nil {
+		slog.ErrorContext(c, "Failed to verify password", "user_id", user.ID, "error", err)
+	}
+	if !ok {
+		s.recordLoginFailure(c, attempt)
+		outcome = metrics.LoginInvalidCredentials
+		return fail("用户名或密码错误", nil)
+	}
+	s.releaseLoginAttempt(c, attempt)
 
-func (s *TCPServer) handleLogin(msg *rpc.Message, responseID uint32) (*rpc.Response, error) {
-	var loginReq struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+	// 密码校验通过后再提示账号状态，避免借此探测用户名
+	if user.Status == models.UserStatusDisabled {
+		outcome = metrics.LoginDisabled
+		return fail("账号已被禁用", nil)
 	}
 
-	if err := json.Unmarshal(msg.Payload, &loginReq); err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Invalid request format",
-		}, nil
+	// 旧算法或旧参数的哈希在登录成功时透明升级，失败不影响本次登录
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		s.rehashPassword(c, user.ID, req.Password)
 	}
 
-	// 获取用户信息
-	user, err := s.mysqlDB.GetUserByUsername(loginReq.Username)
+	// 开启了两步验证的用户还需提交验证码
+	_, enabled, err := s.users.GetTOTPSecret(c, user.ID)
 	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "用户名或密码错误",
-		}, nil
+		return fail("登录失败，请重试", err)
+	}
+	if enabled {
+		outcome = metrics.LoginTwoFactorRequired
+		return s.startTwoFactorLogin(c, user, info)
 	}
 
-	// 验证密码
-	if !s.verifyPassword(loginReq.Password, user.PasswordHash) {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "用户名或密码错误",
-		}, nil
+	outcome = metrics.LoginSuccess
+	return s.completeLogin(c, user, info)
+}
+
+// completeLogin 创建Session并返回登录成功响应
+func (s *TCPServer) completeLogin(ctx context.Context, user *models.User, info models.ClientInfo) (*Result, error) {
+	if err := s.loginGuard.recordSuccess(ctx, user.Username); err != nil {
+		slog.WarnContext(ctx, "Failed to clear login failures", "user_id", user.ID, "error", err)
 	}
 
 	// 生成Session Token
-	token, err := s.redisDB.GenerateSessionToken(user.ID)
+	token, err := database.GenerateSessionToken()
 	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "登录失败，请重试",
-		}, err
+		return fail("登录失败，请重试", err)
 	}
 
-	// 存储Session
-	expiration := time.Duration(3600) * time.Second // 1小时
-	err = s.redisDB.StoreSession(token, user.ID, expiration)
+	// 角色和权限随Session保存，鉴权时无需再查询数据库
+	roles, permissions, err := s.users.GetUserRoles(ctx, user.ID)
 	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "登录失败，请重试",
-		}, err
+		return fail("登录失败，请重试", err)
+	}
+
+	// 存储Session
+	session := &models.Session{
+		UserID:      user.ID,
+		UserAgent:   info.UserAgent,
+		IP:          info.IP,
+		Roles:       roles,
+		Permissions: permissions,
+	}
+
+	// JWT模式下Session Token不下发给客户端，只作为刷新令牌族的会话标识
+	if s.tokenSigner != nil {
+		if err := s.sessions.StoreSession(ctx, token, session, s.refreshTTL); err != nil {
+			return fail("登录失败，请重试", err)
+		}
+		resp, err := s.issueTokens(ctx, session)
+		if err != nil {
+			return fail("登录失败，请重试", err)
+		}
+		resp.Message = "登录成功"
+		resp.User = user
+		return success("登录成功", resp)
+	}
+
+	if err := s.sessions.StoreSession(ctx, token, session, s.sessionTTL); err != nil {
+		return fail("登录失败，请重试", err)
 	}
 
-	loginResp := &models.LoginResponse{
+	return success("登录成功", &models.LoginResponse{
 		Success: true,
 		Token:   token,
 		Message: "登录成功",
 		User:    user,
-	}
-
-	// 序列化响应数据
-	payload, err := json.Marshal(loginResp)
-	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Response serialization failed",
-		}, err
-	}
-
-	return &rpc.Response{
-		Type:    msg.Type,
-		ID:      responseID,
-		Status:  rpc.STATUS_SUCCESS,
-		Message: loginResp.Message,
-		Payload: payload,
-	}, nil
+	})
 }
 
-func (s *TCPServer) handleGetProfile(msg *rpc.Message, responseID uint32) (*rpc.Response, error) {
-	var profileReq struct {
-		Token string `json:"token"`
-	}
-
-	if err := json.Unmarshal(msg.Payload, &profileReq); err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Invalid request format",
-		}, nil
-	}
+// 登录被限制时的响应，Payload中携带重试等待时间
+func loginRateLimited(wait time.Duration) (*Result, error) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	message := fmt.Sprintf("登录失败次数过多，请%d秒后重试", retryAfter)
+	return rateLimited(message, &models.LoginResponse{
+		Success:    false,
+		Message:    message,
+		RetryAfter: retryAfter,
+	})
+}
 
-	// 验证Token
-	userID, err := s.validateToken(profileReq.Token)
+func (s *TCPServer) handleRegister(c *RPCContext, req *models.RegisterRequest) (*Result, error) {
+	// 创建用户
+	user, err := s.users.CreateUser(c, req.Username, req.Password, req.Nickname, s.hasher)
 	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Invalid session",
-		}, nil
+		switch {
+		case errors.Is(err, database.ErrUsernameTaken):
+			return fail("用户名已存在", nil)
+		case errors.Is(err, database.ErrInvalidUsername):
+			return fail("用户名需为3-50位字母、数字或下划线，且以字母开头", nil)
+		case errors.Is(err, database.ErrWeakPassword):
+			return fail(passwordPolicyMessage, nil)
+		default:
+			return fail("注册失败，请重试", err)
+		}
 	}
 
+	return success("注册成功", &models.RegisterResponse{
+		Success: true,
+		Message: "注册成功",
+		User:    user,
+	})
+}
+
+func (s *TCPServer) handleGetProfile(c *RPCContext, req *tokenPayload) (*Result, error) {
 	// 获取用户信息
-	user, err := s.mysqlDB.GetUserByID(userID)
+	user, err := s.getProfile(c, c.UserID)
 	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "获取用户信息失败",
-		}, err
+		return fail("获取用户信息失败", err)
 	}
 
-	profileResp := &models.GetProfileResponse{
+	return success("获取成功", &models.GetProfileResponse{
 		Success: true,
 		Message: "获取成功",
 		User:    user,
-	}
-
-	// 序列化响应数据
-	payload, err := json.Marshal(profileResp)
-	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Response serialization failed",
-		}, err
-	}
-
-	return &rpc.Response{
-		Type:    msg.Type,
-		ID:      responseID,
-		Status:  rpc.STATUS_SUCCESS,
-		Message: profileResp.Message,
-		Payload: payload,
-	}, nil
+	})
 }
 
-func (s *TCPServer) handleUpdateProfile(msg *rpc.Message, responseID uint32) (*rpc.Response, error) {
-	var updateReq struct {
-		Token      string `json:"token"`
-		Nickname   string `json:"nickname"`
-		ProfilePic string `json:"profile_pic"`
-	}
-
-	if err := json.Unmarshal(msg.Payload, &updateReq); err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Invalid request format",
-		}, nil
-	}
-
-	// 验证Token
-	userID, err := s.validateToken(updateReq.Token)
-	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Invalid session",
-		}, nil
-	}
+type updateProfileRequest struct {
+	tokenPayload
+	Nickname   string `json:"nickname"`
+	ProfilePic string `json:"profile_pic"`
+}
 
+func (s *TCPServer) handleUpdateProfile(c *RPCContext, req *updateProfileRequest) (*Result, error) {
 	// 更新用户信息
-	err = s.mysqlDB.UpdateUser(userID, updateReq.Nickname, updateReq.ProfilePic)
-	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "更新失败",
-		}, err
+	if err := s.users.UpdateUser(c, c.UserID, req.Nickname, req.ProfilePic); err != nil {
+		return fail("更新失败", err)
 	}
+	s.invalidateProfile(c, c.UserID)
 
 	// 获取更新后的用户信息
-	user, err := s.mysqlDB.GetUserByID(userID)
+	user, err := s.users.GetUserByID(c, c.UserID)
 	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "获取更新后的信息失败",
-		}, err
+		return fail("获取更新后的信息失败", err)
 	}
 
-	updateResp := &models.UpdateProfileResponse{
+	return success("更新成功", &models.UpdateProfileResponse{
 		Success: true,
 		Message: "更新成功",
 		User:    user,
-	}
-
-	// 序列化响应数据
-	payload, err := json.Marshal(updateResp)
-	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Response serialization failed",
-		}, err
-	}
-
-	return &rpc.Response{
-		Type:    msg.Type,
-		ID:      responseID,
-		Status:  rpc.STATUS_SUCCESS,
-		Message: updateResp.Message,
-		Payload: payload,
-	}, nil
+	})
 }
 
-func (s *TCPServer) handleLogout(msg *rpc.Message, responseID uint32) (*rpc.Response, error) {
-	var logoutReq struct {
-		Token string `json:"token"`
+func (s *TCPServer) handleLogout(c *RPCContext, req *tokenPayload) (*Result, error) {
+	// JWT访问令牌按其中的会话ID注销，注销后该会话签发的访问令牌随即失效
+	if s.tokenSigner != nil && auth.IsJWT(req.Token) {
+		claims, err := s.tokenSigner.Verify(req.Token, time.Now())
+		if err != nil {
+			return success("Logout successful", nil)
+		}
+		err = s.sessions.DeleteSessionByID(c, claims.UserID, claims.SessionID)
+		if err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+			return fail("Logout failed", err)
+		}
+		return success("Logout successful", nil)
 	}
 
-	if err := json.Unmarshal(msg.Payload, &logoutReq); err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Invalid request format",
-		}, nil
+	// 删除Session
+	if err := s.sessions.DeleteSession(c, req.Token); err != nil {
+		return fail("Logout failed", err)
 	}
 
-	// 删除Session
-	err := s.redisDB.DeleteSession(logoutReq.Token)
-	if err != nil {
-		return &rpc.Response{
-			Type:    msg.Type,
-			ID:      responseID,
-			Status:  rpc.STATUS_ERROR,
-			Message: "Logout failed",
-		}, err
-	}
-
-	return &rpc.Response{
-		Type:    msg.Type,
-		ID:      responseID,
-		Status:  rpc.STATUS_SUCCESS,
-		Message: "Logout successful",
-	}, nil
+	return success("Logout successful", nil)
 }
 
-func (s *TCPServer) handleHeartbeat(msg *rpc.Message, responseID uint32) (*rpc.Response, error) {
-	return &rpc.Response{
-		Type:    msg.Type,
-		ID:      responseID,
-		Status:  rpc.STATUS_SUCCESS,
-		Message: "Heartbeat received",
-	}, nil
+func (s *TCPServer) handleHeartbeat(c *RPCContext, req *struct{}) (*Result, error) {
+	return success("Heartbeat received", nil)
 }
 
-// 验证Token
-func (s *TCPServer) validateToken(token string) (int64, error) {
+// errInvalidSession Token不存在、已过期或已被注销，客户端需要重新登录
+var errInvalidSession = errors.New("invalid session")
+
+// 验证Token，Token无效时返回errInvalidSession，其他错误为存储故障
+func (s *TCPServer) validateToken(ctx context.Context, token string) (*models.Session, error) {
+	// JWT访问令牌校验签名和有效期，另外只查询会话是否已被注销（登出、修改密码等）
+	if s.tokenSigner != nil && auth.IsJWT(token) {
+		claims, err := s.tokenSigner.Verify(token, time.Now())
+		if err != nil {
+			return nil, errInvalidSession
+		}
+		revoked, err := s.sessions.IsSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, errInvalidSession
+		}
+		return &models.Session{
+			ID:          claims.SessionID,
+			UserID:      claims.UserID,
+			Roles:       claims.Roles,
+			Permissions: claims.Permissions,
+		}, nil
+	}
+
 	// 检查Session是否存在
-	exists, err := s.redisDB.SessionExists(token)
+	exists, err := s.sessions.SessionExists(ctx, token)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if !exists {
-		return 0, fmt.Errorf("invalid session")
+		return nil, errInvalidSession
 	}
 
-	// 获取用户ID
-	userID, err := s.redisDB.GetSession(token)
+	// 获取Session，检查存在之后可能恰好过期或被注销
+	session, err := s.sessions.GetSession(ctx, token)
+	if errors.Is(err, database.ErrSessionNotFound) {
+		return nil, errInvalidSession
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	// 刷新Session过期时间
-	expiration := time.Duration(3600) * time.Second
-	err = s.redisDB.RefreshSession(token, expiration)
+	err = s.sessions.RefreshSession(ctx, session, s.sessionTTL)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return userID, nil
+	return session, nil
 }
 
-// 验证密码（简化版本）
-func (s *TCPServer) verifyPassword(password, hash string) bool {
-	// 实际应用中应该使用bcrypt
-	hashedPassword := s.hashPassword(password)
-
-	// 添加调试信息
-	fmt.Printf("DEBUG: Comparing password '%s' with hash '%s' vs stored hash '%s'\n",
-		password, hashedPassword, hash)
+// 记录登录失败，计数出错只记录日志，不改变本次的失败结果
+func (s *TCPServer) recordLoginFailure(ctx context.Context, attempt *loginAttempt) {
+	if err := attempt.fail(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to record login failure", "username", attempt.username, "ip", attempt.ip, "error", err)
+	}
+}
 
-	return hashedPassword == hash
+// 撤销没有失败的登录尝试预占的计数，出错时计数在窗口期后自然过期
+func (s *TCPServer) releaseLoginAttempt(ctx context.Context, attempt *loginAttempt) {
+	if err := attempt.release(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to release login attempt", "username", attempt.username, "ip", attempt.ip, "error", err)
+	}
 }
 
-// 哈希密码（简化版本）
-func (s *TCPServer) hashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+const passwordPolicyMessage = "密码需为8-72位，且同时包含字母和数字"
+
+// 使用当前哈希算法重新生成并保存密码哈希
+func (s *TCPServer) rehashPassword(ctx context.Context, userID int64, password string) {
+	newHash, err := s.hasher.Hash(password)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to rehash password", "user_id", userID, "error", err)
+		return
+	}
+
+	if err := s.users.UpdatePasswordHash(ctx, userID, newHash); err != nil {
+		slog.ErrorContext(ctx, "Failed to store rehashed password", "user_id", userID, "error", err)
+	}
 }
@@ -0,0 +1,1071 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+	"user_system_v1/auth"
+	"user_system_v1/config"
+	"user_system_v1/database"
+	"user_system_v1/metrics"
+	"user_system_v1/models"
+	"user_system_v1/notify"
+	"user_system_v1/rpc"
+	"user_system_v1/tracing"
+)
+
+// newTestServer 使用内存存储创建TCP服务器，不需要MySQL和Redis
+func newTestServer(t *testing.T) (*TCPServer, *database.MemoryUserStore) {
+	t.Helper()
+
+	cfg := &config.Config{
+		SessionExpiration:  3600,
+		LoginMaxFailures:   5,
+		LoginDelayAfter:    3,
+		LoginMaxDelay:      30,
+		LoginFailureWindow: 900,
+		ProfileCacheTTL:    300,
+	}
+	users := database.NewMemoryUserStore()
+	hasher := auth.NewBcryptHasher(bcrypt.MinCost)
+	return NewTCPServer(cfg, users, database.NewMemorySessionStore(), hasher, notify.LogNotifier{}, nil), users
+}
+
+// call 以JSON编码发送一次RPC请求，成功时把响应Payload解码到out
+func call(t *testing.T, s *TCPServer, msgType uint32, req interface{}, out interface{}) *rpc.Response {
+	t.Helper()
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := s.handleMessage(&rpc.Message{Type: msgType, ID: 1, Payload: payload}, "127.0.0.1:50000")
+	if resp.Status == rpc.STATUS_SUCCESS && out != nil {
+		if err := resp.DecodePayload(out); err != nil {
+			t.Fatalf("decode %s response: %v", rpc.MessageTypeName(msgType), err)
+		}
+	}
+	return resp
+}
+
+func login(t *testing.T, s *TCPServer, username, password string) string {
+	t.Helper()
+
+	var loginResp models.LoginResponse
+	resp := call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: username, Password: password}, &loginResp)
+	if resp.Status != rpc.STATUS_SUCCESS || loginResp.Token == "" {
+		t.Fatalf("login %s: status %d, message %q", username, resp.Status, resp.Message)
+	}
+	return loginResp.Token
+}
+
+func TestLoginProfileFlow(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	var registerResp models.RegisterResponse
+	resp := call(t, s, rpc.MSG_REGISTER, models.RegisterRequest{Username: "alice", Password: "secret123", Nickname: "Alice"}, &registerResp)
+	if resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("register: %s", resp.Message)
+	}
+
+	resp = call(t, s, rpc.MSG_REGISTER, models.RegisterRequest{Username: "ALICE", Password: "secret123"}, nil)
+	if resp.Status == rpc.STATUS_SUCCESS {
+		t.Fatal("registering a taken username should fail")
+	}
+
+	resp = call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: "alice", Password: "wrong-password1"}, nil)
+	if resp.Status != rpc.STATUS_ERROR {
+		t.Fatalf("login with wrong password: status %d", resp.Status)
+	}
+
+	token := login(t, s, "alice", "secret123")
+
+	var profile models.GetProfileResponse
+	resp = call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, &profile)
+	if resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("get profile: %s", resp.Message)
+	}
+	if profile.User.ID != registerResp.User.ID || profile.User.Nickname != "Alice" {
+		t.Fatalf("unexpected profile: %+v", profile.User)
+	}
+
+	var updated models.UpdateProfileResponse
+	resp = call(t, s, rpc.MSG_UPDATE_PROFILE, updateProfileRequest{
+		tokenPayload: tokenPayload{Token: token},
+		Nickname:     "Alice W",
+		ProfilePic:   "/uploads/alice.png",
+	}, &updated)
+	if resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("update profile: %s", resp.Message)
+	}
+
+	// 更新后缓存中的资料同样是最新的
+	resp = call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, &profile)
+	if resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("get profile after update: %s", resp.Message)
+	}
+	if profile.User.Nickname != "Alice W" || profile.User.ProfilePic != "/uploads/alice.png" {
+		t.Fatalf("profile not updated: %+v", profile.User)
+	}
+
+	resp = call(t, s, rpc.MSG_LOGOUT, tokenPayload{Token: token}, nil)
+	if resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("logout: %s", resp.Message)
+	}
+
+	resp = call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, nil)
+	if resp.Status == rpc.STATUS_SUCCESS {
+		t.Fatal("token should be invalid after logout")
+	}
+}
+
+func TestLoginRejectsDisabledUser(t *testing.T) {
+	s, users := newTestServer(t)
+
+	user, err := users.CreateUser(context.Background(), "bob", "secret123", "", s.hasher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetUserStatus(context.Background(), user.ID, models.UserStatusDisabled); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: "bob", Password: "secret123"}, nil)
+	if resp.Status == rpc.STATUS_SUCCESS {
+		t.Fatal("disabled user should not be able to log in")
+	}
+}
+
+func TestConcurrentLoginGuessesAreLimited(t *testing.T) {
+	s, users := newTestServer(t)
+	if _, err := users.CreateUser(context.Background(), "frank", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同时提交的猜测在第一次失败记录下来之前也不能全部通过检查
+	const guesses = 20
+	statuses := make(chan *rpc.Response, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: "frank", Password: "wrong-password1"}, nil)
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	verified := 0
+	for resp := range statuses {
+		if resp.Message == "用户名或密码错误" {
+			verified++
+		} else if resp.Status != rpc.STATUS_RATE_LIMITED {
+			t.Errorf("unexpected response: status %d, message %q", resp.Status, resp.Message)
+		}
+	}
+	if verified == 0 || verified > int(s.loginGuard.delayAfter) {
+		t.Errorf("%d guesses were verified, want 1..%d", verified, s.loginGuard.delayAfter)
+	}
+}
+
+// loginWithWrongPassword 以错误密码登录，要求密码得到校验而不是被限流
+func loginWithWrongPassword(t *testing.T, s *TCPServer, username string) {
+	t.Helper()
+
+	resp := call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: username, Password: "wrong-password1"}, nil)
+	if resp.Message != "用户名或密码错误" {
+		t.Fatalf("wrong password for %s: status %d, message %q", username, resp.Status, resp.Message)
+	}
+}
+
+func expectRateLimited(t *testing.T, s *TCPServer, username, password string) {
+	t.Helper()
+
+	resp := call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: username, Password: password}, nil)
+	if resp.Status != rpc.STATUS_RATE_LIMITED {
+		t.Fatalf("login %s: status %d, message %q; want rate limited", username, resp.Status, resp.Message)
+	}
+}
+
+// 递增延迟到期后可以再次尝试，正确的密码可以登录，被拒绝的尝试不会延长延迟
+func TestLoginDelayExpires(t *testing.T) {
+	s, users := newTestServer(t)
+	if _, err := users.CreateUser(context.Background(), "ivan", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < int(s.loginGuard.delayAfter); i++ {
+		loginWithWrongPassword(t, s, "ivan")
+	}
+	expectRateLimited(t, s, "ivan", "secret123")
+	time.Sleep(loginBaseDelay / 2)
+	expectRateLimited(t, s, "ivan", "secret123")
+
+	time.Sleep(loginBaseDelay/2 + 100*time.Millisecond)
+	login(t, s, "ivan", "secret123")
+}
+
+// 锁定到期后再次失败会重新锁定，正确的密码可以登录
+func TestLoginLockoutExpires(t *testing.T) {
+	s, users := newTestServer(t)
+	s.loginGuard.delayAfter = 0
+	s.loginGuard.lockout = 200 * time.Millisecond
+	if _, err := users.CreateUser(context.Background(), "judy", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < int(s.loginGuard.userLimit); i++ {
+		loginWithWrongPassword(t, s, "judy")
+	}
+	expectRateLimited(t, s, "judy", "secret123")
+
+	time.Sleep(250 * time.Millisecond)
+	loginWithWrongPassword(t, s, "judy")
+	expectRateLimited(t, s, "judy", "secret123")
+
+	time.Sleep(250 * time.Millisecond)
+	login(t, s, "judy", "secret123")
+}
+
+func TestLoginIPLockoutExpires(t *testing.T) {
+	s, users := newTestServer(t)
+	s.loginGuard.ipLimit = 2
+	s.loginGuard.lockout = 200 * time.Millisecond
+	if _, err := users.CreateUser(context.Background(), "karl", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一IP上对不同用户名的猜测累计到上限后锁定该IP
+	loginWithWrongPassword(t, s, "nobody1")
+	loginWithWrongPassword(t, s, "nobody2")
+	expectRateLimited(t, s, "karl", "secret123")
+
+	time.Sleep(250 * time.Millisecond)
+	login(t, s, "karl", "secret123")
+}
+
+// failingUserStore 查询用户时返回数据库错误
+type failingUserStore struct {
+	*database.MemoryUserStore
+	err error
+}
+
+func (f *failingUserStore) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.MemoryUserStore.GetUserByID(ctx, id)
+}
+
+func (f *failingUserStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.MemoryUserStore.GetUserByUsername(ctx, username)
+}
+
+func TestLoginStorageErrorIsNotCounted(t *testing.T) {
+	s, memory := newTestServer(t)
+	users := &failingUserStore{MemoryUserStore: memory, err: errors.New("connection refused")}
+	s.users = users
+	if _, err := memory.CreateUser(context.Background(), "grace", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		resp := call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: "grace", Password: "secret123"}, nil)
+		if resp.Status != rpc.STATUS_ERROR || resp.Message != "登录失败，请重试" {
+			t.Fatalf("login during outage: status %d, message %q", resp.Status, resp.Message)
+		}
+	}
+
+	// 数据库恢复后不应处于锁定状态
+	users.err = nil
+	login(t, s, "grace", "secret123")
+}
+
+// failingSessionStore 查询Session时返回存储错误
+type failingSessionStore struct {
+	*database.MemorySessionStore
+	err error
+}
+
+func (f *failingSessionStore) SessionExists(ctx context.Context, token string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.MemorySessionStore.SessionExists(ctx, token)
+}
+
+// 存储故障时报告服务端错误，而不是让客户端当作会话失效
+func TestSessionStorageErrorIsNotInvalidSession(t *testing.T) {
+	s, users := newTestServer(t)
+	if _, err := users.CreateUser(context.Background(), "liam", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+	token := login(t, s, "liam", "secret123")
+
+	sessions := &failingSessionStore{MemorySessionStore: s.sessions.(*database.MemorySessionStore), err: errors.New("connection refused")}
+	s.sessions = sessions
+	resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, nil)
+	if resp.Status != rpc.STATUS_ERROR || resp.Message == "Invalid session" {
+		t.Fatalf("profile during outage: status %d, message %q", resp.Status, resp.Message)
+	}
+
+	sessions.err = nil
+	if resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, nil); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("profile after outage: %s", resp.Message)
+	}
+	if resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: "unknown-token"}, nil); resp.Message != "Invalid session" {
+		t.Fatalf("unknown token: status %d, message %q", resp.Status, resp.Message)
+	}
+}
+
+func TestResetPasswordKeepsTokenUntilPasswordIsSet(t *testing.T) {
+	s, memory := newTestServer(t)
+	users := &failingUserStore{MemoryUserStore: memory, err: errors.New("connection refused")}
+	s.users = users
+	user, err := memory.CreateUser(context.Background(), "heidi", "secret123", "", s.hasher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.sessions.StorePasswordResetToken(context.Background(), "reset-token", user.ID, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	req := models.ResetPasswordRequest{ResetToken: "reset-token", NewPassword: "newsecret456"}
+
+	// 出错时Token不被消耗，用户可以用同一链接重试
+	if resp := call(t, s, rpc.MSG_RESET_PASSWORD, req, nil); resp.Status != rpc.STATUS_ERROR {
+		t.Fatalf("reset during outage: status %d", resp.Status)
+	}
+	users.err = nil
+	if resp := call(t, s, rpc.MSG_RESET_PASSWORD, req, nil); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("retry reset: %s", resp.Message)
+	}
+	login(t, s, "heidi", "newsecret456")
+
+	// 成功后Token失效
+	if resp := call(t, s, rpc.MSG_RESET_PASSWORD, req, nil); resp.Status == rpc.STATUS_SUCCESS {
+		t.Fatal("reset token reused")
+	}
+}
+
+// capturingNotifier 用LogNotifier投递后把通知交给测试
+type capturingNotifier struct {
+	notify.LogNotifier
+	sent chan *notify.Message
+}
+
+func (n capturingNotifier) Notify(ctx context.Context, msg *notify.Message) error {
+	err := n.LogNotifier.Notify(ctx, msg)
+	n.sent <- msg
+	return err
+}
+
+// 默认的log通知方式不能把重置Token写入日志
+func TestResetTokenNotLogged(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	s, users := newTestServer(t)
+	s.resetURL = "http://localhost:8080/?reset_token="
+	notifier := capturingNotifier{sent: make(chan *notify.Message, 1)}
+	s.notifier = notifier
+	if _, err := users.CreateUser(context.Background(), "ivy", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := call(t, s, rpc.MSG_REQUEST_PASSWORD_RESET, models.ForgotPasswordRequest{Username: "ivy"}, nil); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("request reset: %s", resp.Message)
+	}
+	var msg *notify.Message
+	select {
+	case msg = <-notifier.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification sent")
+	}
+
+	_, link, ok := strings.Cut(msg.Body, s.resetURL)
+	token, _, _ := strings.Cut(link, "\n")
+	if !ok || token == "" {
+		t.Fatalf("no reset link in %q", msg.Body)
+	}
+	if strings.Contains(buf.String(), token) {
+		t.Fatalf("reset token logged:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Notification") {
+		t.Fatalf("notification not logged:\n%s", buf.String())
+	}
+}
+
+// newJWTTestServer 在newTestServer的基础上开启JWT模式
+func newJWTTestServer(t *testing.T) (*TCPServer, *database.MemoryUserStore) {
+	t.Helper()
+
+	s, users := newTestServer(t)
+	signer, err := auth.LoadJWTSigner("", "user_system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.tokenSigner = signer
+	s.accessTTL = 15 * time.Minute
+	s.refreshTTL = time.Hour
+	return s, users
+}
+
+func TestJWTRejectedAfterLogout(t *testing.T) {
+	s, users := newJWTTestServer(t)
+	if _, err := users.CreateUser(context.Background(), "ivan", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	token := login(t, s, "ivan", "secret123")
+	other := login(t, s, "ivan", "secret123")
+	if !auth.IsJWT(token) {
+		t.Fatalf("login returned %q, want a JWT", token)
+	}
+	if resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, nil); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("get profile: %s", resp.Message)
+	}
+
+	// 访问令牌尚未过期，但所属会话已注销
+	if resp := call(t, s, rpc.MSG_LOGOUT, tokenPayload{Token: token}, nil); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("logout: %s", resp.Message)
+	}
+	if resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, nil); resp.Status == rpc.STATUS_SUCCESS {
+		t.Fatal("access token still valid after logout")
+	}
+	if resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: other}, nil); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("other session affected by logout: %s", resp.Message)
+	}
+}
+
+// pausingUserStore 让下一次GetUserByID在读到用户后暂停，模拟回源期间资料被修改
+type pausingUserStore struct {
+	*database.MemoryUserStore
+	pause   chan struct{} // 非nil时下一次查询读到用户后关闭read并等待resume
+	read    chan struct{}
+	resume  chan struct{}
+	pausing sync.Mutex
+}
+
+func (p *pausingUserStore) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	user, err := p.MemoryUserStore.GetUserByID(ctx, id)
+
+	p.pausing.Lock()
+	pause := p.pause
+	p.pause = nil
+	p.pausing.Unlock()
+	if pause != nil {
+		close(p.read)
+		<-p.resume
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return user, err
+}
+
+func TestProfileCacheNotFilledWithStaleRead(t *testing.T) {
+	s, memory := newTestServer(t)
+	users := &pausingUserStore{MemoryUserStore: memory}
+	s.users = users
+	if _, err := memory.CreateUser(context.Background(), "kate", "secret123", "Old", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+	token := login(t, s, "kate", "secret123")
+
+	// 缓存未命中的读取先读到旧资料并暂停
+	users.pause, users.read, users.resume = make(chan struct{}), make(chan struct{}), make(chan struct{})
+	stale := make(chan *rpc.Response, 1)
+	go func() {
+		stale <- call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, nil)
+	}()
+	<-users.read
+
+	// 此时修改资料，之后旧的读取才写回缓存
+	update := updateProfileRequest{tokenPayload: tokenPayload{Token: token}, Nickname: "New"}
+	if resp := call(t, s, rpc.MSG_UPDATE_PROFILE, update, nil); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("update profile: %s", resp.Message)
+	}
+	close(users.resume)
+	if resp := <-stale; resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("get profile: %s", resp.Message)
+	}
+
+	var profile models.GetProfileResponse
+	if resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, &profile); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("get profile: %s", resp.Message)
+	}
+	if profile.User.Nickname != "New" {
+		t.Fatalf("cache holds stale nickname %q after update", profile.User.Nickname)
+	}
+}
+
+// 合并回源的第一个调用方取消后，其他调用方仍能拿到资料
+func TestProfileLoadSurvivesFirstCallerCancel(t *testing.T) {
+	s, memory := newTestServer(t)
+	users := &pausingUserStore{MemoryUserStore: memory}
+	s.users = users
+	user, err := memory.CreateUser(context.Background(), "leo", "secret123", "", s.hasher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		user *models.User
+		err  error
+	}
+	load := func(ctx context.Context) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			user, err := s.getProfile(ctx, user.ID)
+			ch <- result{user, err}
+		}()
+		return ch
+	}
+
+	users.pause, users.read, users.resume = make(chan struct{}), make(chan struct{}), make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	first := load(ctx)
+	<-users.read
+	second := load(context.Background())
+	time.Sleep(50 * time.Millisecond) // 让第二个调用方并入同一次回源
+
+	cancel()
+	close(users.resume)
+	if r := <-first; !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("cancelled caller: user %v, err %v", r.user, r.err)
+	}
+	if r := <-second; r.err != nil || r.user.Username != "leo" {
+		t.Fatalf("concurrent caller: user %v, err %v", r.user, r.err)
+	}
+}
+
+func TestAdminListRequiresPermission(t *testing.T) {
+	s, users := newTestServer(t)
+
+	for _, name := range []string{"admin", "carol", "dave"} {
+		if _, err := users.CreateUser(context.Background(), name, "secret123", "", s.hasher); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := users.GrantRoleByUsername(context.Background(), "admin", models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := call(t, s, rpc.MSG_LIST_USERS, listUsersRequest{tokenPayload: tokenPayload{Token: login(t, s, "carol", "secret123")}}, nil)
+	if resp.Status != rpc.STATUS_FORBIDDEN {
+		t.Fatalf("list users without permission: status %d", resp.Status)
+	}
+
+	// 角色在登录时写入会话
+	token := login(t, s, "admin", "secret123")
+	req := listUsersRequest{tokenPayload: tokenPayload{Token: token}}
+	req.Limit = 2
+
+	var page models.ListUsersResponse
+	if resp := call(t, s, rpc.MSG_LIST_USERS, req, &page); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("list users: %s", resp.Message)
+	}
+	if len(page.Users) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page: %d users, cursor %q", len(page.Users), page.NextCursor)
+	}
+
+	req.Cursor = page.NextCursor
+	var next models.ListUsersResponse
+	if resp := call(t, s, rpc.MSG_LIST_USERS, req, &next); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("list users: %s", resp.Message)
+	}
+	if len(next.Users) != 1 || next.Users[0].Username != "dave" || next.NextCursor != "" {
+		t.Fatalf("second page: %d users, cursor %q", len(next.Users), next.NextCursor)
+	}
+}
+
+func TestRoleChangeRevokesSessions(t *testing.T) {
+	servers := map[string]func(*testing.T) (*TCPServer, *database.MemoryUserStore){
+		"session": newTestServer,
+		"jwt":     newJWTTestServer,
+	}
+	for mode, newServer := range servers {
+		t.Run(mode, func(t *testing.T) {
+			s, users := newServer(t)
+			ctx := context.Background()
+			for _, name := range []string{"root", "judy"} {
+				if _, err := users.CreateUser(ctx, name, "secret123", "", s.hasher); err != nil {
+					t.Fatal(err)
+				}
+				if err := users.GrantRoleByUsername(ctx, name, models.RoleAdmin); err != nil {
+					t.Fatal(err)
+				}
+			}
+			judy, _ := users.GetUserByUsername(ctx, "judy")
+
+			rootToken := login(t, s, "root", "secret123")
+			judyToken := login(t, s, "judy", "secret123")
+			getUser := adminUserRequest{tokenPayload: tokenPayload{Token: judyToken}}
+			getUser.UserID = judy.ID
+			if resp := call(t, s, rpc.MSG_ADMIN_GET_USER, getUser, nil); resp.Status != rpc.STATUS_SUCCESS {
+				t.Fatalf("admin get user before demotion: %s", resp.Message)
+			}
+
+			// 只修改资料不影响已登录的会话
+			nickname := "Judy"
+			update := adminUpdateUserRequest{tokenPayload: tokenPayload{Token: rootToken}}
+			update.UserID = judy.ID
+			update.Nickname = &nickname
+			if resp := call(t, s, rpc.MSG_ADMIN_UPDATE_USER, update, nil); resp.Status != rpc.STATUS_SUCCESS {
+				t.Fatalf("update nickname: %s", resp.Message)
+			}
+			if resp := call(t, s, rpc.MSG_ADMIN_GET_USER, getUser, nil); resp.Status != rpc.STATUS_SUCCESS {
+				t.Fatalf("session revoked by a nickname change: %s", resp.Message)
+			}
+
+			// 撤销admin角色后，旧会话中的权限不能继续使用
+			roles := []string{}
+			update.Nickname = nil
+			update.Roles = &roles
+			if resp := call(t, s, rpc.MSG_ADMIN_UPDATE_USER, update, nil); resp.Status != rpc.STATUS_SUCCESS {
+				t.Fatalf("demote: %s", resp.Message)
+			}
+			if resp := call(t, s, rpc.MSG_ADMIN_GET_USER, getUser, nil); resp.Status == rpc.STATUS_SUCCESS {
+				t.Fatal("demoted user's session still has admin permissions")
+			}
+
+			getUser.Token = login(t, s, "judy", "secret123")
+			if resp := call(t, s, rpc.MSG_ADMIN_GET_USER, getUser, nil); resp.Status != rpc.STATUS_FORBIDDEN {
+				t.Fatalf("admin get user after re-login: status %d, want forbidden", resp.Status)
+			}
+		})
+	}
+}
+
+// listSessions 返回token所属用户的会话列表和token自己的会话ID
+func listSessions(t *testing.T, s *TCPServer, token string) ([]*models.SessionInfo, string) {
+	t.Helper()
+
+	var list models.ListSessionsResponse
+	if resp := call(t, s, rpc.MSG_LIST_SESSIONS, tokenPayload{Token: token}, &list); resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("list sessions: %s", resp.Message)
+	}
+	current := ""
+	for _, info := range list.Sessions {
+		if info.Current {
+			if current != "" {
+				t.Fatalf("more than one current session: %+v", list.Sessions)
+			}
+			current = info.ID
+		}
+	}
+	if current == "" {
+		t.Fatalf("current session not listed: %+v", list.Sessions)
+	}
+	return list.Sessions, current
+}
+
+// expectSessionValid 用token读取资料，检查会话是否仍然有效
+func expectSessionValid(t *testing.T, s *TCPServer, name, token string, valid bool) {
+	t.Helper()
+
+	resp := call(t, s, rpc.MSG_GET_PROFILE, tokenPayload{Token: token}, nil)
+	if got := resp.Status == rpc.STATUS_SUCCESS; got != valid {
+		t.Fatalf("%s session valid = %v, want %v (message %q)", name, got, valid, resp.Message)
+	}
+	if !valid && resp.Message != "Invalid session" {
+		t.Fatalf("%s session: message %q, want Invalid session", name, resp.Message)
+	}
+}
+
+func TestSessionManagement(t *testing.T) {
+	servers := map[string]func(*testing.T) (*TCPServer, *database.MemoryUserStore){
+		"session": newTestServer,
+		"jwt":     newJWTTestServer,
+	}
+	for mode, newServer := range servers {
+		t.Run(mode, func(t *testing.T) {
+			s, users := newServer(t)
+			for _, name := range []string{"mia", "ned"} {
+				if _, err := users.CreateUser(context.Background(), name, "secret123", "", s.hasher); err != nil {
+					t.Fatal(err)
+				}
+			}
+			laptop := login(t, s, "mia", "secret123")
+			phone := login(t, s, "mia", "secret123")
+			ned := login(t, s, "ned", "secret123")
+
+			sessions, laptopID := listSessions(t, s, laptop)
+			_, phoneID := listSessions(t, s, phone)
+			_, nedID := listSessions(t, s, ned)
+			if len(sessions) != 2 || laptopID == phoneID {
+				t.Fatalf("mia's sessions: %+v", sessions)
+			}
+			for _, info := range sessions {
+				if info.UserID == 0 || info.ID == nedID {
+					t.Fatalf("unexpected session in mia's list: %+v", info)
+				}
+			}
+
+			revoke := func(token, sessionID string) *rpc.Response {
+				req := revokeSessionRequest{tokenPayload: tokenPayload{Token: token}}
+				req.SessionID = sessionID
+				return call(t, s, rpc.MSG_REVOKE_SESSION, req, nil)
+			}
+
+			// 不能注销其他用户的会话，也不能借此判断会话ID是否存在
+			if resp := revoke(ned, phoneID); resp.Status != rpc.STATUS_ERROR || resp.Message != "会话不存在" {
+				t.Fatalf("revoke another user's session: status %d, message %q", resp.Status, resp.Message)
+			}
+			if resp := revoke(ned, "no-such-session"); resp.Message != "会话不存在" {
+				t.Fatalf("revoke unknown session: message %q", resp.Message)
+			}
+			if resp := revoke(ned, ""); resp.Message != "缺少会话ID" {
+				t.Fatalf("revoke without id: message %q", resp.Message)
+			}
+			expectSessionValid(t, s, "phone", phone, true)
+
+			// 注销单个会话，其他会话不受影响
+			if resp := revoke(laptop, phoneID); resp.Status != rpc.STATUS_SUCCESS {
+				t.Fatalf("revoke phone session: %s", resp.Message)
+			}
+			expectSessionValid(t, s, "phone", phone, false)
+			expectSessionValid(t, s, "laptop", laptop, true)
+			if sessions, _ := listSessions(t, s, laptop); len(sessions) != 1 || sessions[0].ID != laptopID {
+				t.Fatalf("sessions after revoking phone: %+v", sessions)
+			}
+			if resp := revoke(laptop, phoneID); resp.Message != "会话不存在" {
+				t.Fatalf("revoke phone session twice: message %q", resp.Message)
+			}
+
+			// 在所有设备上登出，只影响当前用户
+			tablet := login(t, s, "mia", "secret123")
+			if resp := call(t, s, rpc.MSG_REVOKE_ALL_SESSIONS, tokenPayload{Token: laptop}, nil); resp.Status != rpc.STATUS_SUCCESS {
+				t.Fatalf("revoke all sessions: %s", resp.Message)
+			}
+			expectSessionValid(t, s, "laptop", laptop, false)
+			expectSessionValid(t, s, "tablet", tablet, false)
+			expectSessionValid(t, s, "ned", ned, true)
+		})
+	}
+}
+
+func TestSameRoles(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{nil, []string{}, true},
+		{[]string{"admin", "support"}, []string{"support", "admin"}, true},
+		{[]string{"admin"}, []string{"admin", "admin"}, true},
+		{[]string{"admin"}, []string{"admin", "support"}, false},
+		{[]string{"admin", "support"}, []string{"admin"}, false},
+	}
+	for _, tt := range tests {
+		if got := sameRoles(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameRoles(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLoginMetrics(t *testing.T) {
+	s, users := newTestServer(t)
+	if _, err := users.CreateUser(context.Background(), "erin", "secret123", "", s.hasher); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := metrics.LoginAttempts.WithLabelValues(metrics.LoginInvalidCredentials)
+	successes := metrics.LoginAttempts.WithLabelValues(metrics.LoginSuccess)
+	rpcErrors := metrics.RPCRequests.WithLabelValues("login", "error")
+	beforeFailures, beforeSuccesses, beforeErrors := testutil.ToFloat64(failures), testutil.ToFloat64(successes), testutil.ToFloat64(rpcErrors)
+
+	call(t, s, rpc.MSG_LOGIN, models.LoginRequest{Username: "erin", Password: "wrong-password1"}, nil)
+	login(t, s, "erin", "secret123")
+
+	if got := testutil.ToFloat64(failures) - beforeFailures; got != 1 {
+		t.Errorf("invalid_credentials increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(successes) - beforeSuccesses; got != 1 {
+		t.Errorf("success increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(rpcErrors) - beforeErrors; got != 1 {
+		t.Errorf("login rpc errors increased by %v, want 1", got)
+	}
+}
+
+var (
+	testProviderOnce sync.Once
+	testProvider     *sdktrace.TracerProvider
+)
+
+// recordSpans 把测试用的TracerProvider设为全局，返回记录本测试span的recorder，测试结束后恢复原来的全局设置。
+// 包级的tracer只会委托给第一次设置的全局TracerProvider，所以所有测试共用同一个provider，各自注册recorder
+func recordSpans(t *testing.T) (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	testProviderOnce.Do(func() {
+		testProvider = sdktrace.NewTracerProvider()
+	})
+	recorder := tracetest.NewSpanRecorder()
+	testProvider.RegisterSpanProcessor(recorder)
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(testProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		testProvider.UnregisterSpanProcessor(recorder)
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return testProvider, recorder
+}
+
+func TestHandleMessageContinuesTrace(t *testing.T) {
+	provider, recorder := recordSpans(t)
+
+	s, _ := newTestServer(t)
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "gateway")
+	resp := s.handleMessage(&rpc.Message{Type: rpc.MSG_HEARTBEAT, ID: 1, Metadata: tracing.Inject(ctx)}, "127.0.0.1:50000")
+	parent.End()
+	if resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("heartbeat: %s", resp.Message)
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Name() != "RPC heartbeat" {
+			continue
+		}
+		if span.SpanKind() != trace.SpanKindServer || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("server span kind %v, parent %v; want a server span under %v", span.SpanKind(), span.Parent(), parent.SpanContext())
+		}
+		return
+	}
+	t.Fatal("no span recorded for the heartbeat")
+}
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	s, _ := newTestServer(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	s.handlers.register(99, func(c *RPCContext) (*Result, error) {
+		close(started)
+		<-release
+		return success("done", nil)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listener) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, err := rpc.EncodeMessage(rpc.DefaultCodec, &rpc.Message{Type: 99, ID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rpc.NewFrameWriter(conn, 0).WriteFrame(data); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(ctx) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before the in-flight request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := net.DialTimeout("tcp", listener.Addr().String(), time.Second); err == nil {
+		t.Fatal("new connections should be refused during shutdown")
+	}
+
+	close(release)
+	frame, err := rpc.NewFrameReader(conn, 0).ReadFrame()
+	if err != nil {
+		t.Fatalf("in-flight response lost: %v", err)
+	}
+	resp, err := rpc.DecodeResponse(rpc.DefaultCodec, frame)
+	if err != nil || resp.ID != 7 || resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("unexpected response %+v, err %v", resp, err)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+}
+
+// serve 在本机随机端口上启动TCP服务器，返回一条已连接的客户端连接
+func serve(t *testing.T, s *TCPServer) net.Conn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Stop() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// 开始关闭时客户端已经发出的请求仍然得到处理，而不是随连接一起丢弃
+func TestShutdownProcessesRequestsAlreadySent(t *testing.T) {
+	s, _ := newTestServer(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	s.handlers.register(99, func(c *RPCContext) (*Result, error) {
+		close(started)
+		<-release
+		return success("done", nil)
+	})
+	conn := serve(t, s)
+	reader, writer := rpc.NewFrameReader(conn, 0), rpc.NewFrameWriter(conn, 0)
+
+	send := func(msgType, id uint32) {
+		t.Helper()
+		data, _ := rpc.EncodeMessage(rpc.DefaultCodec, &rpc.Message{Type: msgType, ID: id, Payload: []byte("{}")})
+		if err := writer.WriteFrame(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(99, 1)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(ctx) }()
+	for !s.isClosing() {
+		time.Sleep(time.Millisecond)
+	}
+	send(rpc.MSG_HEARTBEAT, 2)
+	close(release)
+
+	got := map[uint32]bool{}
+	for len(got) < 2 {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatalf("responses received %v: %v", got, err)
+		}
+		resp, err := rpc.DecodeResponse(rpc.DefaultCodec, frame)
+		if err != nil || resp.Status != rpc.STATUS_SUCCESS {
+			t.Fatalf("unexpected response %+v, err %v", resp, err)
+		}
+		got[resp.ID] = true
+	}
+	if !got[1] || !got[2] {
+		t.Fatalf("responses for %v, want 1 and 2", got)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := reader.ReadFrame(); err != io.EOF {
+		t.Fatalf("connection still open after shutdown: %v", err)
+	}
+}
+
+func TestOversizedResponseFailsOnlyThatRequest(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.maxFrame = 512
+	s.handlers.register(98, func(c *RPCContext) (*Result, error) {
+		return success("big", strings.Repeat("x", 1024))
+	})
+	conn := serve(t, s)
+	reader, writer := rpc.NewFrameReader(conn, 0), rpc.NewFrameWriter(conn, 0)
+
+	for id, msgType := range []uint32{98, rpc.MSG_HEARTBEAT} {
+		data, _ := rpc.EncodeMessage(rpc.DefaultCodec, &rpc.Message{Type: msgType, ID: uint32(id + 1), Payload: []byte("{}")})
+		if err := writer.WriteFrame(data); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatalf("%s: connection closed: %v", rpc.MessageTypeName(msgType), err)
+		}
+		resp, _ := rpc.DecodeResponse(rpc.DefaultCodec, frame)
+		want := uint32(rpc.STATUS_SUCCESS)
+		if msgType == 98 {
+			want = rpc.STATUS_ERROR
+		}
+		if resp.ID != uint32(id+1) || resp.Status != want {
+			t.Errorf("%s: response %+v, want status %d", rpc.MessageTypeName(msgType), resp, want)
+		}
+	}
+}
+
+func TestUndecodableFrameClosesConnection(t *testing.T) {
+	s, _ := newTestServer(t)
+	conn := serve(t, s)
+
+	if err := rpc.NewFrameWriter(conn, 0).WriteFrame([]byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rpc.NewFrameReader(conn, 0).ReadFrame(); err != io.EOF {
+		t.Errorf("err = %v, want the server to close the connection", err)
+	}
+}
+
+func TestCodecHandshake(t *testing.T) {
+	s, _ := newTestServer(t)
+	conn := serve(t, s)
+	reader, writer := rpc.NewFrameReader(conn, 0), rpc.NewFrameWriter(conn, 0)
+
+	if err := writer.WriteFrame(rpc.EncodeHandshake("protobuf", rpc.CodecMsgpack)); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := rpc.NegotiateCodec(rpc.ParseHandshake(frame))
+	if codec.Name() != rpc.CodecMsgpack {
+		t.Fatalf("negotiated %s, want msgpack", codec.Name())
+	}
+
+	// 之后的消息按协商出的编解码器收发
+	data, _ := rpc.EncodeMessage(codec, &rpc.Message{Type: rpc.MSG_HEARTBEAT, ID: 3})
+	if err := writer.WriteFrame(data); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err = reader.ReadFrame(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rpc.DecodeResponse(codec, frame)
+	if err != nil || resp.ID != 3 || resp.Status != rpc.STATUS_SUCCESS {
+		t.Fatalf("response %+v, err %v", resp, err)
+	}
+}
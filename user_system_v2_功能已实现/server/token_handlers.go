@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"user_system_v1/auth"
+	"user_system_v1/database"
+	"user_system_v1/models"
+)
+
+// issueTokens 为已保存的会话签发访问令牌和新的刷新令牌
+func (s *TCPServer) issueTokens(ctx context.Context, session *models.Session) (*models.LoginResponse, error) {
+	jti, err := database.GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accessToken, err := s.tokenSigner.Sign(&auth.Claims{
+		Subject:   strconv.FormatInt(session.UserID, 10),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.accessTTL).Unix(),
+		ID:        jti,
+		SessionID: session.ID,
+		UserID:    session.UserID,
+
+		Roles:       session.Roles,
+		Permissions: session.Permissions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := database.GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	refresh := &models.RefreshToken{
+		SessionID: session.ID,
+		UserID:    session.UserID,
+	}
+	if err := s.sessions.StoreRefreshToken(ctx, refreshToken, refresh, s.refreshTTL); err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		Success:      true,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+	}, nil
+}
+
+// 用刷新令牌换取新的令牌对，旧的刷新令牌随即作废
+func (s *TCPServer) handleRefreshToken(c *RPCContext, req *models.RefreshTokenRequest) (*Result, error) {
+	if s.tokenSigner == nil {
+		return fail("未开启JWT模式", nil)
+	}
+
+	refresh, err := s.sessions.ConsumeRefreshToken(c, req.RefreshToken, s.refreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRefreshTokenReused):
+			// 已轮换的令牌再次出现，说明令牌可能已被盗用，注销整个令牌族所属的会话
+			slog.WarnContext(c, "Refresh token reuse detected, revoking session", "user_id", refresh.UserID, "session_id", refresh.SessionID)
+			if err := s.sessions.DeleteSessionByID(c, refresh.UserID, refresh.SessionID); err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+				return fail("刷新令牌已失效，请重新登录", err)
+			}
+			return fail("刷新令牌已失效，请重新登录", nil)
+		case errors.Is(err, database.ErrRefreshTokenInvalid):
+			return fail("刷新令牌已失效，请重新登录", nil)
+		default:
+			return fail("刷新失败，请重试", err)
+		}
+	}
+
+	// 会话已被注销（登出、修改密码等）时，该会话的刷新令牌一并失效
+	session, err := s.sessions.GetSessionByID(c, refresh.SessionID)
+	if err != nil {
+		if errors.Is(err, database.ErrSessionNotFound) {
+			return fail("刷新令牌已失效，请重新登录", nil)
+		}
+		return fail("刷新失败，请重试", err)
+	}
+
+	if err := s.sessions.RefreshSession(c, session, s.refreshTTL); err != nil {
+		return fail("刷新失败，请重试", err)
+	}
+
+	resp, err := s.issueTokens(c, session)
+	if err != nil {
+		return fail("刷新失败，请重试", err)
+	}
+	resp.Message = "刷新成功"
+
+	return success("刷新成功", resp)
+}
+
+// 返回校验访问令牌的公钥，供HTTP网关的JWKS端点使用
+func (s *TCPServer) handleJWKS(c *RPCContext, req *struct{}) (*Result, error) {
+	if s.tokenSigner == nil {
+		return fail("未开启JWT模式", nil)
+	}
+
+	return success("获取成功", s.tokenSigner.JWKS())
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"user_system_v1/auth"
+	"user_system_v1/database"
+	"user_system_v1/metrics"
+	"user_system_v1/models"
+)
+
+const (
+	totpIssuer = "User System"
+
+	loginChallengeExpiration  = 5 * time.Minute
+	loginChallengeMaxAttempts = 5 // 超过后挑战作废，需重新输入密码
+	totpEnrollmentExpiration  = 10 * time.Minute
+	recoveryCodeCount         = 10
+
+	// 验证码在前后各一个时间步内有效，记录已使用的时间步直到验证码失效
+	totpReplayWindow = 3 * auth.TOTPPeriod
+)
+
+// startTwoFactorLogin 密码校验通过后生成登录挑战，客户端凭挑战Token和验证码完成登录
+func (s *TCPServer) startTwoFactorLogin(ctx context.Context, user *models.User, info models.ClientInfo) (*Result, error) {
+	token, err := database.GenerateSessionToken()
+	if err != nil {
+		return fail("登录失败，请重试", err)
+	}
+
+	challenge := &models.LoginChallenge{
+		UserID:     user.ID,
+		Username:   user.Username,
+		ClientInfo: info,
+	}
+	if err := s.sessions.StoreLoginChallenge(ctx, token, challenge, loginChallengeExpiration); err != nil {
+		return fail("登录失败，请重试", err)
+	}
+
+	return success("请输入两步验证码", &models.LoginResponse{
+		Success:           false,
+		Message:           "请输入两步验证码",
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+	})
+}
+
+// 两步登录的第二步：校验验证码或恢复码
+func (s *TCPServer) handleLogin2FA(c *RPCContext, req *models.TwoFactorLoginRequest) (result *Result, err error) {
+	outcome := metrics.LoginError
+	defer func() { countLogin(outcome, err) }()
+
+	challenge, err := s.sessions.GetLoginChallenge(c, req.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, database.ErrChallengeNotFound) {
+			outcome = metrics.LoginInvalidCode
+			return fail("验证已过期，请重新登录", nil)
+		}
+		return fail("登录失败，请重试", err)
+	}
+
+	attempt, wait, err := s.loginGuard.begin(c, challenge.Username, challenge.IP)
+	if err != nil {
+		return fail("登录失败，请重试", err)
+	}
+	if wait > 0 {
+		outcome = metrics.LoginRateLimited
+		return loginRateLimited(wait)
+	}
+
+	attempts, err := s.sessions.IncrLoginChallengeAttempts(c, req.ChallengeToken, loginChallengeExpiration)
+	if err != nil {
+		s.releaseLoginAttempt(c, attempt)
+		return fail("登录失败，请重试", err)
+	}
+	if attempts > loginChallengeMaxAttempts {
+		s.releaseLoginAttempt(c, attempt)
+		if _, err := s.sessions.DeleteLoginChallenge(c, req.ChallengeToken); err != nil {
+			slog.WarnContext(c, "Failed to delete login challenge", "user_id", challenge.UserID, "error", err)
+		}
+		outcome = metrics.LoginInvalidCode
+		return fail("验证码错误次数过多，请重新登录", nil)
+	}
+
+	ok, err := s.verifySecondFactor(c, challenge.UserID, req.Code)
+	if err != nil {
+		s.releaseLoginAttempt(c, attempt)
+		return fail("登录失败，请重试", err)
+	}
+	if !ok {
+		s.recordLoginFailure(c, attempt)
+		outcome = metrics.LoginInvalidCode
+		return fail("验证码错误", nil)
+	}
+	s.releaseLoginAttempt(c, attempt)
+
+	// 挑战只能使用一次，并发提交时只有成功删除挑战的请求可以继续
+	deleted, err := s.sessions.DeleteLoginChallenge(c, req.ChallengeToken)
+	if err != nil {
+		return fail("登录失败，请重试", err)
+	}
+	if !deleted {
+		outcome = metrics.LoginInvalidCode
+		return fail("验证已过期，请重新登录", nil)
+	}
+
+	user, err := s.users.GetUserByID(c, challenge.UserID)
+	if err != nil {
+		return fail("登录失败，请重试", err)
+	}
+
+	outcome = metrics.LoginSuccess
+	return s.completeLogin(c, user, challenge.ClientInfo)
+}
+
+// 生成TOTP密钥，确认前只保存在Redis中
+func (s *TCPServer) handleTOTPSetup(c *RPCContext, req *tokenPayload) (*Result, error) {
+	_, enabled, err := s.users.GetTOTPSecret(c, c.UserID)
+	if err != nil {
+		return fail("获取两步验证状态失败", err)
+	}
+	if enabled {
+		return fail("两步验证已开启", nil)
+	}
+
+	user, err := s.users.GetUserByID(c, c.UserID)
+	if err != nil {
+		return fail("获取用户信息失败", err)
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return fail("生成密钥失败", err)
+	}
+	if err := s.sessions.StorePendingTOTPSecret(c, c.UserID, secret, totpEnrollmentExpiration); err != nil {
+		return fail("生成密钥失败", err)
+	}
+
+	return success("请使用验证器App扫描并输入验证码", &models.TOTPSetupResponse{
+		Success:    true,
+		Message:    "请使用验证器App扫描并输入验证码",
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, user.Username, secret),
+	})
+}
+
+type totpCodeRequest struct {
+	tokenPayload
+	models.TOTPCodeRequest
+}
+
+// 用验证App生成的验证码确认绑定，成功后开启两步验证并返回恢复码
+func (s *TCPServer) handleTOTPConfirm(c *RPCContext, req *totpCodeRequest) (*Result, error) {
+	secret, err := s.sessions.GetPendingTOTPSecret(c, c.UserID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoPendingTOTP) {
+			return fail("请先获取两步验证密钥", nil)
+		}
+		return fail("开启两步验证失败", err)
+	}
+
+	step, ok := auth.VerifyTOTP(secret, req.Code, time.Now())
+	if !ok {
+		return fail("验证码错误", nil)
+	}
+	// 与登录一致，同一时间步的验证码只能使用一次
+	fresh, err := s.sessions.MarkTOTPStepUsed(c, c.UserID, step, totpReplayWindow)
+	if err != nil {
+		return fail("开启两步验证失败", err)
+	}
+	if !fresh {
+		return fail("验证码错误", nil)
+	}
+
+	// 恢复码只在此时返回一次，数据库中只保存哈希
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return fail("开启两步验证失败", err)
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	if err := s.users.EnableTOTP(c, c.UserID, secret, hashes); err != nil {
+		return fail("开启两步验证失败", err)
+	}
+	if err := s.sessions.DeletePendingTOTPSecret(c, c.UserID); err != nil {
+		slog.WarnContext(c, "Failed to delete pending TOTP secret", "user_id", c.UserID, "error", err)
+	}
+
+	return success("两步验证已开启，请妥善保存恢复码", &models.TOTPConfirmResponse{
+		Success:       true,
+		Message:       "两步验证已开启，请妥善保存恢复码",
+		RecoveryCodes: codes,
+	})
+}
+
+// 关闭两步验证，需要提交当前的验证码或恢复码
+func (s *TCPServer) handleTOTPDisable(c *RPCContext, req *totpCodeRequest) (*Result, error) {
+	user, err := s.users.GetUserByID(c, c.UserID)
+	if err != nil {
+		return fail("获取用户信息失败", err)
+	}
+
+	// 与登录共用失败计数，防止持有Session的人穷举验证码
+	attempt, wait, err := s.loginGuard.begin(c, user.Username, "")
+	if err != nil {
+		return fail("关闭两步验证失败", err)
+	}
+	if wait > 0 {
+		return loginRateLimited(wait)
+	}
+
+	ok, err := s.verifySecondFactor(c, c.UserID, req.Code)
+	if err != nil {
+		s.releaseLoginAttempt(c, attempt)
+		return fail("关闭两步验证失败", err)
+	}
+	if !ok {
+		s.recordLoginFailure(c, attempt)
+		return fail("验证码错误", nil)
+	}
+	s.releaseLoginAttempt(c, attempt)
+
+	if err := s.users.DisableTOTP(c, c.UserID); err != nil {
+		return fail("关闭两步验证失败", err)
+	}
+
+	return success("两步验证已关闭", nil)
+}
+
+// verifySecondFactor 校验TOTP验证码或恢复码，两者均为一次性使用
+func (s *TCPServer) verifySecondFactor(ctx context.Context, userID int64, code string) (bool, error) {
+	secret, enabled, err := s.users.GetTOTPSecret(ctx, userID)
+	if err != nil || !enabled {
+		return false, err
+	}
+
+	if len(code) == auth.TOTPDigits {
+		step, ok := auth.VerifyTOTP(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// 同一验证码在有效期内只能使用一次
+		return s.sessions.MarkTOTPStepUsed(ctx, userID, step, totpReplayWindow)
+	}
+
+	return s.users.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(code))
+}
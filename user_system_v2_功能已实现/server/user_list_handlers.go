@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"user_system_v1/database"
+	"user_system_v1/models"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeUserCursor 游标是上一页最后一行的排序位置，编码后对调用方不透明
+func encodeUserCursor(cursor *database.UserCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeUserCursor(cursor string) (database.UserCursor, error) {
+	var after database.UserCursor
+	if cursor == "" {
+		return after, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return after, errInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &after); err != nil || !after.Valid() {
+		return after, errInvalidCursor
+	}
+	return after, nil
+}
+
+// listUsers 校验分页参数并查询一页用户，返回下一页的游标
+func (s *TCPServer) listUsers(ctx context.Context, req *models.ListUsersRequest) ([]*models.User, string, error) {
+	after, err := decodeUserCursor(req.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultUserPageSize
+	}
+	if limit > maxUserPageSize {
+		limit = maxUserPageSize
+	}
+
+	users, next, err := s.users.ListUsers(ctx, req.Query, req.Match, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return users, encodeUserCursor(next), nil
+}
+
+type listUsersRequest struct {
+	tokenPayload
+	models.ListUsersRequest
+}
+
+// 按ID游标分页列出用户，支持按用户名或昵称前缀/子串搜索
+func (s *TCPServer) handleListUsers(c *RPCContext, req *listUsersRequest) (*Result, error) {
+	users, nextCursor, err := s.listUsers(c, &req.ListUsersRequest)
+	if errors.Is(err, errInvalidCursor) {
+		return fail("无效的分页游标", nil)
+	}
+	if err != nil {
+		return fail("获取用户列表失败", err)
+	}
+
+	if users == nil {
+		users = []*models.User{}
+	}
+	return success("获取成功", &models.ListUsersResponse{
+		Success:    true,
+		Message:    "获取成功",
+		Users:      users,
+		NextCursor: nextCursor,
+	})
+}
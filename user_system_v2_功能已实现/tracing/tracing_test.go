@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtract(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	if metadata := Inject(context.Background()); metadata != nil {
+		t.Fatalf("expected no metadata without a span, got %v", metadata)
+	}
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+
+	metadata := Inject(ctx)
+	if metadata["traceparent"] == "" {
+		t.Fatalf("traceparent not injected: %v", metadata)
+	}
+
+	remote := trace.SpanContextFromContext(Extract(context.Background(), metadata))
+	if !remote.IsRemote() || remote.TraceID() != span.SpanContext().TraceID() || remote.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("extracted %v, want the parent span %v", remote, span.SpanContext())
+	}
+}